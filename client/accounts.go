@@ -1,26 +1,36 @@
 package client
 
-import "github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+import (
+	"context"
+
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
 
 // NewAccount is used to create a new account with an optional label
-func (c *Client) NewAccount(walletName, label string) (*wallet.ResponseCreateAccount, error) {
-	if err := c.OpenWallet(walletName); err != nil {
-		return nil, err
-	}
-	return c.mw.CreateAccount(&wallet.RequestCreateAccount{
-		Label: label,
+func (c *Client) NewAccount(ctx context.Context, walletName, label string) (*wallet.ResponseCreateAccount, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
+	var resp *wallet.ResponseCreateAccount
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.CreateAccount(&wallet.RequestCreateAccount{
+			Label: label,
+		})
+		return err
 	})
+	return resp, err
 }
 
 // NewAddress creates a new address under the given account index
-func (c *Client) NewAddress(walletName string, accountIndex uint64) (string, error) {
-	if err := c.OpenWallet(walletName); err != nil {
-		return "", err
-	}
-	resp, err := c.mw.CreateAddress(&wallet.RequestCreateAddress{AccountIndex: accountIndex})
-	if err != nil {
-		return "", err
-	}
+func (c *Client) NewAddress(ctx context.Context, walletName string, accountIndex uint64) (string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
+	var resp *wallet.ResponseCreateAddress
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.CreateAddress(&wallet.RequestCreateAddress{AccountIndex: accountIndex})
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -28,32 +38,46 @@ func (c *Client) NewAddress(walletName string, accountIndex uint64) (string, err
 }
 
 // GetAccounts returns all accounts under the wallet
-func (c *Client) GetAccounts(walletName string) (*wallet.ResponseGetAccounts, error) {
-	if err := c.OpenWallet(walletName); err != nil {
-		return nil, err
-	}
-	return c.mw.GetAccounts(&wallet.RequestGetAccounts{})
+func (c *Client) GetAccounts(ctx context.Context, walletName string) (*wallet.ResponseGetAccounts, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	var resp *wallet.ResponseGetAccounts
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.GetAccounts(&wallet.RequestGetAccounts{})
+		return err
+	})
+	return resp, err
 }
 
 // GetAddress returns address information for a given account index optionally filtered by subaddress index
-func (c *Client) GetAddress(walletName string, accountIndex uint64, addressIndex ...uint64) (*wallet.ResponseGetAddress, error) {
-	if err := c.OpenWallet(walletName); err != nil {
-		return nil, err
-	}
-	return c.mw.GetAddress(&wallet.RequestGetAddress{
-		AccountIndex: accountIndex,
-		AddressIndex: addressIndex,
+func (c *Client) GetAddress(ctx context.Context, walletName string, accountIndex uint64, addressIndex ...uint64) (*wallet.ResponseGetAddress, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	var resp *wallet.ResponseGetAddress
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.GetAddress(&wallet.RequestGetAddress{
+			AccountIndex: accountIndex,
+			AddressIndex: addressIndex,
+		})
+		return err
 	})
+	return resp, err
 }
 
 // AddressBalance returns the unlocked funds for the given address
 // TODO(bonedaddy): accept account and subaddress index
 // look up balance for the given address (not the wallet)
-func (c *Client) AddressBalance(walletName string, address string, accountIndex uint64, addressIndex ...uint64) (uint64, error) {
-	if err := c.OpenWallet(walletName); err != nil {
-		return 0, err
-	}
-	resp, err := c.mw.GetBalance(&wallet.RequestGetBalance{AccountIndex: accountIndex, AddressIndices: addressIndex})
+func (c *Client) AddressBalance(ctx context.Context, walletName string, address string, accountIndex uint64, addressIndex ...uint64) (uint64, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	var resp *wallet.ResponseGetBalance
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.GetBalance(&wallet.RequestGetBalance{AccountIndex: accountIndex, AddressIndices: addressIndex})
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
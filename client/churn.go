@@ -1,5 +1,7 @@
 package client
 
+import "context"
+
 // ChurnableSubAdddress defines a given address that we can churn funds from
 type ChurnableSubAdddress struct {
 	AddressIndex uint64
@@ -22,11 +24,17 @@ type ChurnableAccounts struct {
 // GetChurnableAddresses is used to get addresses that we can churn by sending to ourselves.
 // The account index matching churnAccountIndex is skipped, as this is the account for which
 // we will use to send churned funds to
-func (c *Client) GetChurnableAddresses(walletName string, churnAccountIndex, minBalance uint64) (*ChurnableAccounts, error) {
-	if err := c.OpenWallet(walletName); err != nil {
+func (c *Client) GetChurnableAddresses(ctx context.Context, walletName string, churnAccountIndex, minBalance uint64) (*ChurnableAccounts, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	return getChurnableAddresses(ctx, c, walletName, churnAccountIndex, minBalance)
+}
+
+func getChurnableAddresses(ctx context.Context, c WalletRPC, walletName string, churnAccountIndex, minBalance uint64) (*ChurnableAccounts, error) {
+	if err := c.OpenWallet(ctx, walletName); err != nil {
 		return nil, err
 	}
-	accts, err := c.GetAccounts(walletName)
+	accts, err := c.GetAccounts(ctx, walletName)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +53,7 @@ func (c *Client) GetChurnableAddresses(walletName string, churnAccountIndex, min
 	}
 	for i, acct := range churns.Accounts {
 		acct.Subaddresses = make([]ChurnableSubAdddress, 0)
-		addrs, err := c.GetAddress(walletName, acct.AccountIndex)
+		addrs, err := c.GetAddress(ctx, walletName, acct.AccountIndex)
 		if err != nil {
 			return nil, err
 		}
@@ -58,7 +66,7 @@ func (c *Client) GetChurnableAddresses(walletName string, churnAccountIndex, min
 			//	continue
 			//}
 			if addr.Used {
-				bal, err := c.AddressBalance(walletName, addr.Address, acct.AccountIndex, addr.AddressIndex)
+				bal, err := c.AddressBalance(ctx, walletName, addr.Address, acct.AccountIndex, addr.AddressIndex)
 				if err != nil {
 					return nil, err
 				}
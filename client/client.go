@@ -1,45 +1,131 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"net/url"
 
 	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
 )
 
 // Client is a wrapper around the monero wallet rpc
 type Client struct {
-	mw wallet.Client
+	addr      string
+	transport http.RoundTripper
+	timeouts  Timeouts
+	ringSize  uint64
+	session   session
+}
+
+// Option is used to configure optional client settings
+type Option func(*options)
+
+type options struct {
+	username   string
+	password   string
+	tls        *TLSOptions
+	proxy      string
+	timeouts   Timeouts
+	walletFile bool
+	ringSize   uint64
+}
+
+// WithDigestAuth authenticates against a monero-wallet-rpc started with --rpc-login username:password.
+// An empty username disables authentication
+func WithDigestAuth(username, password string) Option {
+	return func(opts *options) {
+		opts.username = username
+		opts.password = password
+	}
 }
 
 // NewClient returns a new initialized rpc client wrapper
-func NewClient(rpcAddr string) (*Client, error) {
-	mclient := wallet.New(wallet.Config{
-		Address: rpcAddr,
-	})
-	return &Client{mw: mclient}, nil
+func NewClient(rpcAddr string, opts ...Option) (*Client, error) {
+	var cfg options
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	transport, err := newTransport(rpcAddr, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		addr:      rpcAddr,
+		transport: transport,
+		timeouts:  cfg.timeouts,
+		ringSize:  cfg.ringSize,
+		session:   session{fixed: cfg.walletFile},
+	}, nil
 }
 
-// Close terminates the RPC client
+// newTransport returns the http transport used to reach rpcAddr, honouring
+// the proxy, tls and authentication settings of cfg
+func newTransport(rpcAddr string, cfg *options) (http.RoundTripper, error) {
+	u, err := url.Parse(rpcAddr)
+	if err != nil {
+		return nil, err
+	}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.proxy != "" {
+		proxyURL, err := parseProxy(cfg.proxy)
+		if err != nil {
+			return nil, err
+		}
+		base.Proxy = http.ProxyURL(proxyURL)
+	} else if isOnion(u) {
+		// never fall back to a direct connection, or one through the environment's proxy
+		return nil, errors.New("onion rpc addresses require a proxy")
+	}
+	if cfg.tls.enabled() {
+		if u.Scheme != "https" {
+			return nil, errors.New("tls options require an https rpc address")
+		}
+		tlsCfg, err := cfg.tls.config()
+		if err != nil {
+			return nil, err
+		}
+		base.TLSClientConfig = tlsCfg
+	}
+	var transport http.RoundTripper = base
+	if cfg.username != "" {
+		transport = newDigestTransport(cfg.username, cfg.password, transport)
+	}
+	return transport, nil
+}
+
+// Close terminates the RPC client, saving and closing the open wallet.
+// A wallet given with --wallet-file is saved but left open
 func (c *Client) Close() error {
-	if err := c.mw.Store(); err != nil {
+	ctx, cancel := withTimeout(context.Background(), c.timeouts.Scan)
+	defer cancel()
+	c.session.mux.Lock()
+	defer c.session.mux.Unlock()
+	if err := c.mw(ctx).Store(); err != nil {
 		log.Println("failed to save wallet: ", err)
 	}
-	return c.mw.CloseWallet()
+	if c.session.fixed {
+		return nil
+	}
+	c.session.opened = ""
+	return wrapError(c.mw(ctx).CloseWallet())
 }
 
-func (c *Client) Rescan(walletName string) error {
-	if err := c.OpenWallet(walletName); err != nil {
-		return err
-	}
-	return c.mw.RescanBlockchain()
+// Rescan rescans the entire blockchain, this is not bounded by any timeout
+func (c *Client) Rescan(ctx context.Context, walletName string) error {
+	return c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		return mw.RescanBlockchain()
+	})
 }
 
 // Refresh triggles a total refresh of a wallet scanning
 // all addresses for incoming transactions
-func (c *Client) Refresh(walletName string) error {
-	if err := c.OpenWallet(walletName); err != nil {
+func (c *Client) Refresh(ctx context.Context, walletName string) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	return c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		_, err := mw.Refresh(&wallet.RequestRefresh{})
 		return err
-	}
-	_, err := c.mw.Refresh(&wallet.RequestRefresh{})
-	return err
+	})
 }
@@ -1,61 +1,424 @@
-package client
+package client_test
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/random"
+	"github.com/bonedaddy/mychurnero/testenv/walletrpc"
 	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
 	"github.com/segmentio/ksuid"
 	"github.com/stretchr/testify/require"
 )
 
 var (
-	testNetRPC    = "http://127.0.0.1:6061/json_rpc"
 	testNetWallet = "testnetwallet123"
 )
 
 func TestClient(t *testing.T) {
-	client, err := NewClient(testNetRPC)
+	ctx := context.Background()
+	srv := walletrpc.New()
+	t.Cleanup(srv.Close)
+
+	cl, err := client.NewClient(srv.URL())
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		client.StopMining(testNetWallet)
-		require.NoError(t, client.Close())
+		cl.StopMining(ctx, testNetWallet)
+		require.NoError(t, cl.Close())
 	})
 
 	// ignore since this will likely always error
-	client.CreateWallet(testNetWallet)
+	cl.CreateWallet(ctx, testNetWallet)
+	require.Error(t, cl.CreateWallet(ctx, testNetWallet))
 	// create random wallet to test no error
 	kid, err := ksuid.NewRandom()
 	require.NoError(t, err)
-	require.NoError(t, client.CreateWallet(kid.String()))
+	require.NoError(t, cl.CreateWallet(ctx, kid.String()))
 
 	// start mining
-	client.StartMining(testNetWallet, 2)
-	client.StartMining(testNetWallet, 2)
+	require.NoError(t, cl.StartMining(ctx, testNetWallet, 2))
 
-	time.Sleep(time.Second * 1)
+	// fund the wallet and wait for the funds to unlock
+	require.NoError(t, srv.Wallet(testNetWallet).Fund(0, 0, wallet.Float64ToXMR(1)))
+	srv.MineBlocks(client.FakeUnlockBlocks)
 
-	bal, err := client.WalletBalance(testNetWallet)
+	bal, err := cl.WalletBalance(ctx, testNetWallet)
 	require.NoError(t, err)
-	t.Log("balance: ", bal)
+	require.Equal(t, wallet.Float64ToXMR(1), bal)
 
-	addr, err := client.NewAddress(testNetWallet, 0)
+	addr, err := cl.NewAddress(ctx, testNetWallet, 0)
 	require.NoError(t, err)
 	fmt.Printf("new address: %s\n", addr)
 
-	resp, err := client.SweepDust(testNetWallet)
+	addrs, err := cl.GetAddress(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.Len(t, addrs.Addresses, 2)
+	addrBal, err := cl.AddressBalance(ctx, testNetWallet, addrs.Addresses[0].Address, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, wallet.Float64ToXMR(1), addrBal)
+
+	resp, err := cl.SweepDust(ctx, testNetWallet)
 	require.NoError(t, err)
 	fmt.Printf("%#v\n", resp)
-	txResp, err := client.Transfer(TransferOpts{
+	priority, err := client.WeightedPriority{Weights: client.DefaultPriorityWeights, Rand: random.NewSecure()}.Priority(ctx)
+	require.NoError(t, err)
+	txResp, err := cl.Transfer(ctx, client.TransferOpts{
 		WalletName:     testNetWallet,
 		Destinations:   map[string]uint64{addr: wallet.Float64ToXMR(0.1)},
-		Priority:       RandomPriority(),
+		Priority:       priority,
 		AccountIndex:   0,
 		SubaddrIndices: nil,
+		DoNotRelay:     true,
 	})
 	require.NoError(t, err)
 	t.Logf("%#v\n", txResp)
+
+	txHash, err := cl.Relay(ctx, testNetWallet, txResp.TxMetadata)
+	require.NoError(t, err)
+	require.Equal(t, txResp.TxHash, txHash)
+
+	status, err := cl.TxStatus(ctx, testNetWallet, txHash)
+	require.NoError(t, err)
+	require.Equal(t, client.TxPending, status.State)
+	require.False(t, status.Final())
+	srv.MineBlocks(client.FakeConfirmationThreshold + 1)
+	status, err = cl.TxStatus(ctx, testNetWallet, txHash)
+	require.NoError(t, err)
+	require.Equal(t, client.TxConfirmed, status.State)
+	require.Equal(t, client.FakeConfirmationThreshold, status.Confirmations)
+	require.True(t, status.Final())
+	status, err = cl.TxStatus(ctx, testNetWallet, "unknown")
+	require.NoError(t, err)
+	require.Equal(t, client.TxUnknown, status.State)
+	transfers, err := cl.GetTransfers(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.Len(t, transfers.Out, 1)
+	require.Equal(t, txHash, transfers.Out[0].TxID)
+	require.Empty(t, transfers.Pending)
+
+	// injected errors are returned to the client
+	srv.InjectError("relay_tx", wallet.ErrGenericTransferError, "Failed to commit tx.", 1)
+	_, err = cl.Relay(ctx, testNetWallet, txResp.TxMetadata)
+	require.Error(t, err)
+	rpcErr, ok := client.AsRPCError(err)
+	require.True(t, ok)
+	require.Equal(t, wallet.ErrGenericTransferError, rpcErr.Code)
+	require.Equal(t, 2, srv.Calls("relay_tx"))
+}
+
+func TestClientDigestAuth(t *testing.T) {
+	ctx := context.Background()
+	srv := walletrpc.New()
+	t.Cleanup(srv.Close)
+	srv.AddWallet(testNetWallet)
+	srv.SetLogin("user", "pass")
+
+	// no credentials
+	cl, err := client.NewClient(srv.URL())
+	require.NoError(t, err)
+	err = cl.OpenWallet(ctx, testNetWallet)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401")
+
+	// wrong credentials
+	cl, err = client.NewClient(srv.URL(), client.WithDigestAuth("user", "wrong"))
+	require.NoError(t, err)
+	require.Error(t, cl.OpenWallet(ctx, testNetWallet))
+
+	cl, err = client.NewClient(srv.URL(), client.WithDigestAuth("user", "pass"))
+	require.NoError(t, err)
+	require.NoError(t, cl.OpenWallet(ctx, testNetWallet))
+	_, err = cl.NewAddress(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+
+	// an expired nonce is renegotiated transparently
+	srv.ExpireNonce()
+	_, err = cl.GetAccounts(ctx, testNetWallet)
+	require.NoError(t, err)
+}
+
+func TestClientTLS(t *testing.T) {
+	ctx := context.Background()
+	srv := walletrpc.NewTLS()
+	t.Cleanup(srv.Close)
+	srv.AddWallet(testNetWallet)
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}), 0600))
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		opts    client.TLSOptions
+		wantErr bool
+	}{
+		{"untrusted", client.TLSOptions{}, true},
+		{"ca", client.TLSOptions{CACertPath: caPath}, false},
+		{"pinned", client.TLSOptions{Fingerprints: []string{fingerprint}}, false},
+		{"pinned-upper-colons", client.TLSOptions{Fingerprints: []string{colonHex(fingerprint)}}, false},
+		{"ca-and-pinned", client.TLSOptions{CACertPath: caPath, Fingerprints: []string{fingerprint}}, false},
+		{"wrong-pin", client.TLSOptions{Fingerprints: []string{hex.EncodeToString(make([]byte, 32))}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl, err := client.NewClient(srv.URL(), client.WithTLS(tt.opts))
+			require.NoError(t, err)
+			err = cl.OpenWallet(ctx, testNetWallet)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	// tls options can not be used with plain http
+	_, err := client.NewClient("http://127.0.0.1:6061/json_rpc", client.WithTLS(client.TLSOptions{CACertPath: caPath}))
+	require.Error(t, err)
+	// invalid fingerprints are rejected
+	_, err = client.NewClient(srv.URL(), client.WithTLS(client.TLSOptions{Fingerprints: []string{"abcd"}}))
+	require.Error(t, err)
+	// missing client certificates are rejected
+	_, err = client.NewClient(srv.URL(), client.WithTLS(client.TLSOptions{CertPath: "missing.pem", KeyPath: "missing.key"}))
+	require.Error(t, err)
+}
+
+func TestClientSession(t *testing.T) {
+	ctx := context.Background()
+	srv := walletrpc.New()
+	t.Cleanup(srv.Close)
+	fw := srv.AddWallet(testNetWallet)
+	srv.AddWallet("otherwallet")
+	require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+	srv.MineBlocks(client.FakeUnlockBlocks)
+
+	cl, err := client.NewClient(srv.URL())
+	require.NoError(t, err)
+
+	// the wallet is only opened once
+	_, err = cl.GetChurnableAddresses(ctx, testNetWallet, 1, 0)
+	require.NoError(t, err)
+	_, err = cl.GetAccounts(ctx, testNetWallet)
+	require.NoError(t, err)
+	require.Equal(t, 1, srv.Calls("open_wallet"))
+
+	// switching wallets opens the other wallet
+	_, err = cl.GetAccounts(ctx, "otherwallet")
+	require.NoError(t, err)
+	require.Equal(t, "otherwallet", srv.Opened())
+	_, err = cl.GetAccounts(ctx, testNetWallet)
+	require.NoError(t, err)
+	require.Equal(t, 3, srv.Calls("open_wallet"))
+
+	// a wallet closed behind our back is reopened
+	srv.CloseWallet()
+	bal, err := cl.WalletBalance(ctx, testNetWallet)
+	require.NoError(t, err)
+	require.Equal(t, wallet.Float64ToXMR(1), bal)
+	require.Equal(t, 4, srv.Calls("open_wallet"))
+
+	// failing to open a wallet is not remembered as it being open
+	require.Error(t, cl.OpenWallet(ctx, "notawallet"))
+	require.NoError(t, cl.OpenWallet(ctx, testNetWallet))
+	require.Equal(t, 6, srv.Calls("open_wallet"))
+
+	require.NoError(t, cl.Close())
+	require.Equal(t, "", srv.Opened())
+}
+
+func TestClientWalletFile(t *testing.T) {
+	ctx := context.Background()
+	srv := walletrpc.New()
+	t.Cleanup(srv.Close)
+	srv.SetWalletFile(testNetWallet)
+
+	// open_wallet is unavailable with --wallet-file
+	cl, err := client.NewClient(srv.URL())
+	require.NoError(t, err)
+	_, err = cl.GetAccounts(ctx, testNetWallet)
+	require.Error(t, err)
+
+	cl, err = client.NewClient(srv.URL(), client.WithWalletFile())
+	require.NoError(t, err)
+	require.NoError(t, cl.OpenWallet(ctx, testNetWallet))
+	_, err = cl.NewAddress(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, srv.Calls("open_wallet"))
+
+	// the wallet is saved but left open
+	require.NoError(t, cl.Close())
+	require.Equal(t, testNetWallet, srv.Opened())
+	require.Equal(t, 0, srv.Calls("close_wallet"))
+}
+
+func TestClientOutputs(t *testing.T) {
+	ctx := context.Background()
+	srv := walletrpc.New()
+	t.Cleanup(srv.Close)
+	fw := srv.AddWallet(testNetWallet)
+	cl, err := client.NewClient(srv.URL())
+	require.NoError(t, err)
+	_, err = cl.NewAccount(ctx, testNetWallet, "churn-account")
+	require.NoError(t, err)
+	dest, err := cl.NewAddress(ctx, testNetWallet, 1)
+	require.NoError(t, err)
+
+	// outputs received at the same subaddress are listed separately, once unlocked
+	require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+	require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(0.5)))
+	require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(0.01)))
+	outputs, err := cl.UnspentOutputs(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.Len(t, outputs, 3)
+	for _, out := range outputs {
+		require.NotEmpty(t, out.KeyImage)
+		require.False(t, out.Unlocked)
+		require.Equal(t, client.SubaddressIndex{Major: 0, Minor: 0}, out.Subaddress)
+	}
+	churns, err := cl.GetChurnableOutputs(ctx, testNetWallet, 1, wallet.Float64ToXMR(0.1))
+	require.NoError(t, err)
+	require.Len(t, churns, 0)
+	srv.MineBlocks(client.FakeUnlockBlocks)
+	churns, err = cl.GetChurnableOutputs(ctx, testNetWallet, 1, wallet.Float64ToXMR(0.1))
+	require.NoError(t, err)
+	require.Len(t, churns, 2)
+	addrs, err := cl.GetAddress(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.Equal(t, addrs.Addresses[0].Address, churns[0].Address)
+
+	// estimating the fee of a sweep spends nothing
+	fee, err := cl.EstimateFee(ctx, client.TransferOpts{
+		WalletName:     testNetWallet,
+		Destinations:   map[string]uint64{dest: 0},
+		SubaddrIndices: []uint64{0},
+	})
+	require.NoError(t, err)
+	require.Equal(t, client.FakeBaseFee, fee)
+	outputs, err = cl.UnspentOutputs(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.Len(t, outputs, 3)
+
+	// sweeping a single output leaves the others untouched
+	resp, err := cl.SweepSingle(ctx, client.TransferOpts{
+		WalletName:   testNetWallet,
+		Destinations: map[string]uint64{dest: 0},
+		KeyImage:     churns[1].KeyImage,
+	})
+	require.NoError(t, err)
+	require.Equal(t, churns[1].Amount-resp.Fee, resp.Amount)
+	require.NotEmpty(t, resp.TxHash)
+	outputs, err = cl.UnspentOutputs(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.Len(t, outputs, 2)
+	_, err = cl.SweepSingle(ctx, client.TransferOpts{
+		WalletName:   testNetWallet,
+		Destinations: map[string]uint64{dest: 0},
+		KeyImage:     churns[1].KeyImage,
+	})
+	require.True(t, errors.Is(err, client.ErrInvalidKeyImage), err)
+
+	// frozen outputs are not churnable until thawed
+	require.NoError(t, cl.Freeze(ctx, testNetWallet, churns[0].KeyImage))
+	frozen, err := cl.Frozen(ctx, testNetWallet, churns[0].KeyImage)
+	require.NoError(t, err)
+	require.True(t, frozen)
+	churns, err = cl.GetChurnableOutputs(ctx, testNetWallet, 1, wallet.Float64ToXMR(0.1))
+	require.NoError(t, err)
+	require.Len(t, churns, 0)
+	outputs, err = cl.UnspentOutputs(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	for _, out := range outputs {
+		if out.Frozen {
+			require.NoError(t, cl.Thaw(ctx, testNetWallet, out.KeyImage))
+		}
+	}
+	churns, err = cl.GetChurnableOutputs(ctx, testNetWallet, 1, wallet.Float64ToXMR(0.1))
+	require.NoError(t, err)
+	require.Len(t, churns, 1)
+	err = cl.Freeze(ctx, testNetWallet, "unknown")
+	require.True(t, errors.Is(err, client.ErrInvalidKeyImage), err)
+
+	// locked coinbase outputs are found among the incoming transfers
+	height, err := cl.GetHeight(ctx, testNetWallet)
+	require.NoError(t, err)
+	require.Equal(t, fw.Height(), height)
+	_, err = cl.NewAddress(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.NoError(t, fw.FundCoinbase(0, 1, wallet.Float64ToXMR(2)))
+	srv.MineBlocks(client.UnlockBlocks)
+	outputs, err = cl.UnspentOutputs(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+	require.Len(t, outputs, 3)
+	for _, out := range outputs {
+		require.Equal(t, out.Subaddress.Minor == 1, out.Coinbase)
+		require.Equal(t, !out.Coinbase, out.Unlocked)
+		if out.Coinbase {
+			require.Equal(t, height, out.BlockHeight)
+			require.Equal(t, height+client.CoinbaseUnlockBlocks, out.UnlockHeight())
+		}
+	}
+
+	// errors are classified like those of any other call
+	_, err = cl.UnspentOutputs(ctx, testNetWallet, 5)
+	require.True(t, errors.Is(err, client.ErrInvalidIndex), err)
+}
+
+func TestClientTimeouts(t *testing.T) {
+	ctx := context.Background()
+	srv := walletrpc.New()
+	t.Cleanup(srv.Close)
+	srv.AddWallet(testNetWallet)
+	srv.Delay("get_accounts", time.Minute)
+
+	cl, err := client.NewClient(srv.URL(), client.WithTimeouts(client.Timeouts{
+		Scan:  time.Millisecond * 100,
+		Relay: time.Minute,
+	}))
+	require.NoError(t, err)
+
+	// the scan timeout abandons a hung call
+	start := time.Now()
+	_, err = cl.GetAccounts(ctx, testNetWallet)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	require.True(t, time.Since(start) < time.Minute)
+
+	// other operation classes are unaffected by the scan timeout
+	_, err = cl.NewAddress(ctx, testNetWallet, 0)
+	require.NoError(t, err)
+
+	// cancelling the context interrupts calls without a timeout
+	srv.Delay("relay_tx", time.Minute)
+	cctx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(time.Millisecond*100, cancel)
+	_, err = cl.Relay(cctx, testNetWallet, "metadata")
+	require.True(t, errors.Is(err, context.Canceled), err)
+
+	// an already cancelled context never reaches the wallet
+	_, err = cl.GetAddress(cctx, testNetWallet, 0)
+	require.True(t, errors.Is(err, context.Canceled), err)
+	require.Equal(t, 0, srv.Calls("get_address"))
+}
+
+func colonHex(s string) string {
+	var parts []string
+	for i := 0; i < len(s); i += 2 {
+		parts = append(parts, strings.ToUpper(s[i:i+2]))
+	}
+	return strings.Join(parts, ":")
 }
@@ -0,0 +1,332 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/rpc/v2/json2"
+)
+
+// Daemon is a client for the rpc interface of monerod, used for the network
+// state that monero-wallet-rpc does not expose
+type Daemon struct {
+	addr     string
+	httpcl   *http.Client
+	timeouts Timeouts
+}
+
+// HardForkInfo is the response of the hard_fork_info daemon rpc method
+type HardForkInfo struct {
+	EarliestHeight uint64 `json:"earliest_height"`
+	Enabled        bool   `json:"enabled"`
+	State          uint   `json:"state"`
+	Status         string `json:"status"`
+	Threshold      uint   `json:"threshold"`
+	Version        uint   `json:"version"`
+	Votes          uint   `json:"votes"`
+	Voting         uint   `json:"voting"`
+	Window         uint   `json:"window"`
+}
+
+// FeeEstimate is the response of the get_fee_estimate daemon rpc method
+type FeeEstimate struct {
+	// the fee per byte of the lowest priority
+	Fee uint64 `json:"fee"`
+	// the fee per byte of each priority from unimportant to highest, empty for daemons before v0.17
+	Fees             []uint64 `json:"fees"`
+	QuantizationMask uint64   `json:"quantization_mask"`
+	Status           string   `json:"status"`
+}
+
+// PoolTx is a transaction in the daemon's transaction pool
+type PoolTx struct {
+	IDHash          string `json:"id_hash"`
+	BlobSize        uint64 `json:"blob_size"`
+	Weight          uint64 `json:"weight"`
+	Fee             uint64 `json:"fee"`
+	ReceiveTime     int64  `json:"receive_time"`
+	Relayed         bool   `json:"relayed"`
+	DoNotRelay      bool   `json:"do_not_relay"`
+	DoubleSpendSeen bool   `json:"double_spend_seen"`
+	KeptByBlock     bool   `json:"kept_by_block"`
+}
+
+// DaemonInfo is the response of the get_info daemon rpc method
+type DaemonInfo struct {
+	Height                   uint64 `json:"height"`
+	TargetHeight             uint64 `json:"target_height"`
+	Synchronized             bool   `json:"synchronized"`
+	BusySyncing              bool   `json:"busy_syncing"`
+	Offline                  bool   `json:"offline"`
+	Nettype                  string `json:"nettype"`
+	TopBlockHash             string `json:"top_block_hash"`
+	TxPoolSize               uint64 `json:"tx_pool_size"`
+	IncomingConnectionsCount uint64 `json:"incoming_connections_count"`
+	OutgoingConnectionsCount uint64 `json:"outgoing_connections_count"`
+	Version                  string `json:"version"`
+	Untrusted                bool   `json:"untrusted"`
+	Status                   string `json:"status"`
+}
+
+// Synced returns true if the daemon has caught up with the rest of the network
+func (di *DaemonInfo) Synced() bool {
+	return di.Synchronized && !di.BusySyncing && di.Height >= di.TargetHeight
+}
+
+// DaemonTx is a transaction returned by the get_transactions daemon rpc method
+type DaemonTx struct {
+	TxHash          string   `json:"tx_hash"`
+	AsHex           string   `json:"as_hex"`
+	InPool          bool     `json:"in_pool"`
+	DoubleSpendSeen bool     `json:"double_spend_seen"`
+	BlockHeight     uint64   `json:"block_height"`
+	BlockTimestamp  int64    `json:"block_timestamp"`
+	OutputIndices   []uint64 `json:"output_indices"`
+}
+
+// Confirmations returns the number of blocks that have confirmed the transaction
+// given the current height of the chain, 0 while it is in the pool
+func (tx *DaemonTx) Confirmations(height uint64) uint64 {
+	if tx.InPool || height <= tx.BlockHeight {
+		return 0
+	}
+	return height - tx.BlockHeight
+}
+
+// NewDaemon returns a client for the monerod rpc server at daemonAddr, for example
+// http://127.0.0.1:18081. The proxy, tls, authentication and timeout options are honoured
+func NewDaemon(daemonAddr string, opts ...Option) (*Daemon, error) {
+	var cfg options
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	transport, err := newTransport(daemonAddr, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Daemon{
+		addr:     strings.TrimSuffix(strings.TrimSuffix(daemonAddr, "/"), "/json_rpc"),
+		httpcl:   &http.Client{Transport: transport},
+		timeouts: cfg.timeouts,
+	}, nil
+}
+
+// call invokes a json_rpc method of the daemon, decoding the result into out
+func (d *Daemon) call(ctx context.Context, method string, in, out interface{}) error {
+	payload, err := json2.EncodeClientRequest(method, in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.addr+"/json_rpc", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.httpcl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status %v", resp.StatusCode)
+	}
+	if err := json2.DecodeClientResponse(resp.Body, out); err != nil {
+		// daemon error codes overlap with those of the wallet, so they are not classified
+		if jerr, ok := err.(*json2.Error); ok {
+			return fmt.Errorf("daemon rpc error %d: %s", jerr.Code, jerr.Message)
+		}
+		return err
+	}
+	return nil
+}
+
+// post invokes one of the daemon's other rpc endpoints, which take and return plain json
+func (d *Daemon) post(ctx context.Context, path string, in, out interface{}) error {
+	if in == nil {
+		in = struct{}{}
+	}
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.addr+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.httpcl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status %v", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkStatus converts the status field of a daemon response into an error
+func checkStatus(status string) error {
+	switch status {
+	case "OK":
+		return nil
+	case "BUSY":
+		return ErrDaemonBusy
+	default:
+		return fmt.Errorf("daemon returned status %q", status)
+	}
+}
+
+// HardForkInfo returns the current hard fork version and voting state of the network
+func (d *Daemon) HardForkInfo(ctx context.Context) (*HardForkInfo, error) {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Scan)
+	defer cancel()
+	var resp HardForkInfo
+	if err := d.call(ctx, "hard_fork_info", nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FeeEstimate returns the fee per byte transactions of each priority are expected to pay
+func (d *Daemon) FeeEstimate(ctx context.Context) (*FeeEstimate, error) {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Scan)
+	defer cancel()
+	var resp FeeEstimate
+	if err := d.call(ctx, "get_fee_estimate", nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// TransactionPool returns the transactions in the daemon's transaction pool
+func (d *Daemon) TransactionPool(ctx context.Context) ([]PoolTx, error) {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Scan)
+	defer cancel()
+	var resp struct {
+		Transactions []PoolTx `json:"transactions"`
+		Status       string   `json:"status"`
+	}
+	if err := d.post(ctx, "/get_transaction_pool", nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	return resp.Transactions, nil
+}
+
+// Info returns the sync state and general information about the daemon
+func (d *Daemon) Info(ctx context.Context) (*DaemonInfo, error) {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Scan)
+	defer cancel()
+	var resp DaemonInfo
+	if err := d.call(ctx, "get_info", nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Height returns the number of blocks in the daemon's chain
+func (d *Daemon) Height(ctx context.Context) (uint64, error) {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Scan)
+	defer cancel()
+	var resp struct {
+		Height uint64 `json:"height"`
+		Status string `json:"status"`
+	}
+	if err := d.post(ctx, "/get_height", nil, &resp); err != nil {
+		return 0, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return 0, err
+	}
+	return resp.Height, nil
+}
+
+// Transactions looks up transactions by hash in the chain and the transaction pool,
+// also returning the hashes the daemon does not know about
+func (d *Daemon) Transactions(ctx context.Context, txHashes []string) ([]DaemonTx, []string, error) {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Confirm)
+	defer cancel()
+	var resp struct {
+		Txs      []DaemonTx `json:"txs"`
+		MissedTx []string   `json:"missed_tx"`
+		Status   string     `json:"status"`
+	}
+	req := map[string]interface{}{"txs_hashes": txHashes}
+	if err := d.post(ctx, "/get_transactions", req, &resp); err != nil {
+		return nil, nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, nil, err
+	}
+	return resp.Txs, resp.MissedTx, nil
+}
+
+// SendRawTransaction submits a hex encoded transaction to the daemon. When doNotRelay is set
+// the daemon keeps it in its pool without broadcasting it. Rejected double spends are
+// reported as ErrDoubleSpend
+func (d *Daemon) SendRawTransaction(ctx context.Context, txHex string, doNotRelay bool) error {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Relay)
+	defer cancel()
+	var resp struct {
+		DoubleSpend       bool   `json:"double_spend"`
+		FeeTooLow         bool   `json:"fee_too_low"`
+		InvalidInput      bool   `json:"invalid_input"`
+		InvalidOutput     bool   `json:"invalid_output"`
+		LowMixin          bool   `json:"low_mixin"`
+		NotRelayed        bool   `json:"not_relayed"`
+		Overspend         bool   `json:"overspend"`
+		TooBig            bool   `json:"too_big"`
+		SanityCheckFailed bool   `json:"sanity_check_failed"`
+		Reason            string `json:"reason"`
+		Status            string `json:"status"`
+	}
+	req := map[string]interface{}{"tx_as_hex": txHex, "do_not_relay": doNotRelay}
+	if err := d.post(ctx, "/send_raw_transaction", req, &resp); err != nil {
+		return err
+	}
+	if resp.Status == "OK" {
+		return nil
+	}
+	if resp.DoubleSpend {
+		return fmt.Errorf("%w: %s", ErrDoubleSpend, resp.Reason)
+	}
+	var reasons []string
+	for reason, set := range map[string]bool{
+		"fee too low":         resp.FeeTooLow,
+		"invalid input":       resp.InvalidInput,
+		"invalid output":      resp.InvalidOutput,
+		"ring size too low":   resp.LowMixin,
+		"overspend":           resp.Overspend,
+		"too big":             resp.TooBig,
+		"sanity check failed": resp.SanityCheckFailed,
+	} {
+		if set {
+			reasons = append(reasons, reason)
+		}
+	}
+	sort.Strings(reasons)
+	if resp.Reason != "" {
+		reasons = append(reasons, resp.Reason)
+	}
+	if err := checkStatus(resp.Status); err != nil && len(reasons) == 0 {
+		return err
+	}
+	return fmt.Errorf("transaction rejected: %s", strings.Join(reasons, ", "))
+}
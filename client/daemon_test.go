@@ -0,0 +1,80 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/testenv/daemonrpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemon(t *testing.T) {
+	ctx := context.Background()
+	srv := daemonrpc.New()
+	t.Cleanup(srv.Close)
+	// the json_rpc path monero-wallet-rpc addresses are usually given with is accepted
+	daemon, err := client.NewDaemon(srv.URL() + "/json_rpc")
+	require.NoError(t, err)
+
+	t.Run("Info", func(t *testing.T) {
+		info, err := daemon.Info(ctx)
+		require.NoError(t, err)
+		require.True(t, info.Synced())
+		require.Equal(t, srv.Height(), info.Height)
+
+		srv.SetTargetHeight(srv.Height() + 100)
+		info, err = daemon.Info(ctx)
+		require.NoError(t, err)
+		require.False(t, info.Synced())
+		srv.SetTargetHeight(0)
+
+		height, err := daemon.Height(ctx)
+		require.NoError(t, err)
+		require.Equal(t, srv.Height(), height)
+	})
+	t.Run("Transactions", func(t *testing.T) {
+		txHex := "0201000102"
+		require.NoError(t, daemon.SendRawTransaction(ctx, txHex, false))
+		// resubmitting a transaction still in the pool is harmless
+		require.NoError(t, daemon.SendRawTransaction(ctx, txHex, false))
+		txHash := daemonrpc.TxHash(txHex)
+
+		pool, err := daemon.TransactionPool(ctx)
+		require.NoError(t, err)
+		require.Len(t, pool, 1)
+		require.Equal(t, txHash, pool[0].IDHash)
+
+		txs, missed, err := daemon.Transactions(ctx, []string{txHash, "missing"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"missing"}, missed)
+		require.Len(t, txs, 1)
+		require.True(t, txs[0].InPool)
+		require.Equal(t, uint64(0), txs[0].Confirmations(srv.Height()))
+
+		srv.MineBlocks(10)
+		height, err := daemon.Height(ctx)
+		require.NoError(t, err)
+		txs, _, err = daemon.Transactions(ctx, []string{txHash})
+		require.NoError(t, err)
+		require.False(t, txs[0].InPool)
+		require.Equal(t, uint64(10), txs[0].Confirmations(height))
+
+		err = daemon.SendRawTransaction(ctx, txHex, false)
+		require.True(t, errors.Is(err, client.ErrDoubleSpend), err)
+		err = daemon.SendRawTransaction(ctx, "not hex", false)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "transaction rejected")
+	})
+	t.Run("Busy", func(t *testing.T) {
+		srv.SetStatus("BUSY")
+		t.Cleanup(func() { srv.SetStatus("OK") })
+		_, err := daemon.Info(ctx)
+		require.True(t, errors.Is(err, client.ErrDaemonBusy), err)
+		_, err = daemon.Height(ctx)
+		require.True(t, errors.Is(err, client.ErrDaemonBusy), err)
+		_, _, err = daemon.Transactions(ctx, nil)
+		require.True(t, errors.Is(err, client.ErrDaemonBusy), err)
+	})
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestTransport is an http.RoundTripper implementing HTTP digest authentication
+// as used by monero-wallet-rpc when started with --rpc-login
+type digestTransport struct {
+	username string
+	password string
+	base     http.RoundTripper
+
+	mux       sync.Mutex
+	challenge *digestChallenge
+	nc        uint64
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+}
+
+func newDigestTransport(username, password string, base http.RoundTripper) *digestTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &digestTransport{username: username, password: password, base: base}
+}
+
+// RoundTrip sends the request, answering a digest challenge if the server responds with one
+func (dt *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	// reuse the last challenge if we have one, saving a round trip
+	dt.mux.Lock()
+	challenge := dt.challenge
+	dt.mux.Unlock()
+	resp, err := dt.send(req, body, challenge)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// either this is the first request, or the nonce has expired
+	challenge, err = parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	dt.mux.Lock()
+	dt.challenge = challenge
+	dt.nc = 0
+	dt.mux.Unlock()
+	return dt.send(req, body, challenge)
+}
+
+// send sends a copy of the request, authorizing it if challenge is not nil
+func (dt *digestTransport) send(req *http.Request, body []byte, challenge *digestChallenge) (*http.Response, error) {
+	authReq := cloneRequest(req, body)
+	if challenge != nil {
+		dt.mux.Lock()
+		dt.nc++
+		nc := dt.nc
+		dt.mux.Unlock()
+		auth, err := challenge.authorization(dt.username, dt.password, req.Method, req.URL.RequestURI(), nc)
+		if err != nil {
+			return nil, err
+		}
+		authReq.Header.Set("Authorization", auth)
+	}
+	return dt.base.RoundTrip(authReq)
+}
+
+func cloneRequest(req *http.Request, body []byte) *http.Request {
+	clone := req.Clone(req.Context())
+	if body != nil {
+		clone.Body = ioutil.NopCloser(bytes.NewReader(body))
+		clone.ContentLength = int64(len(body))
+	}
+	return clone
+}
+
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	if !strings.HasPrefix(strings.ToLower(header), "digest ") {
+		return nil, errors.New("not a digest challenge")
+	}
+	params := parseDigestParams(header[len("digest "):])
+	challenge := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+	}
+	if challenge.nonce == "" {
+		return nil, errors.New("digest challenge is missing nonce")
+	}
+	if challenge.algorithm != "" && !strings.EqualFold(challenge.algorithm, "MD5") {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", challenge.algorithm)
+	}
+	for _, qop := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			challenge.qop = "auth"
+		}
+	}
+	return challenge, nil
+}
+
+// parseDigestParams parses a comma separated list of key=value or key="value" pairs
+func parseDigestParams(input string) map[string]string {
+	params := make(map[string]string)
+	for len(input) > 0 {
+		input = strings.TrimLeft(input, " ,")
+		eq := strings.IndexByte(input, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(input[:eq]))
+		input = input[eq+1:]
+		var value string
+		if strings.HasPrefix(input, `"`) {
+			end := strings.IndexByte(input[1:], '"')
+			if end < 0 {
+				value, input = input[1:], ""
+			} else {
+				value, input = input[1:end+1], input[end+2:]
+			}
+		} else if comma := strings.IndexByte(input, ','); comma >= 0 {
+			value, input = input[:comma], input[comma:]
+		} else {
+			value, input = input, ""
+		}
+		params[key] = strings.TrimSpace(value)
+	}
+	return params
+}
+
+func md5Hex(parts ...string) string {
+	sum := md5.Sum([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (dc *digestChallenge) authorization(username, password, method, uri string, nc uint64) (string, error) {
+	ha1 := md5Hex(username, dc.realm, password)
+	ha2 := md5Hex(method, uri)
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, username),
+		fmt.Sprintf(`realm="%s"`, dc.realm),
+		fmt.Sprintf(`nonce="%s"`, dc.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		"algorithm=MD5",
+	}
+	if dc.qop == "" {
+		fields = append(fields, fmt.Sprintf(`response="%s"`, md5Hex(ha1, dc.nonce, ha2)))
+	} else {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		cnonce := hex.EncodeToString(buf)
+		ncValue := fmt.Sprintf("%08x", nc)
+		fields = append(fields,
+			fmt.Sprintf(`response="%s"`, md5Hex(ha1, dc.nonce, ncValue, cnonce, dc.qop, ha2)),
+			"qop="+dc.qop,
+			"nc="+ncValue,
+			fmt.Sprintf(`cnonce="%s"`, cnonce),
+		)
+	}
+	if dc.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, dc.opaque))
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/rpc/v2/json2"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+// monero-wallet-rpc error codes not defined by the wallet package
+const (
+	ErrCodeAccountIndexOutOfBounds wallet.ErrorCode = -14
+	ErrCodeAddressIndexOutOfBounds wallet.ErrorCode = -15
+	ErrCodeTxNotPossible           wallet.ErrorCode = -16
+	ErrCodeNotEnoughMoney          wallet.ErrorCode = -17
+	ErrCodeTxTooLarge              wallet.ErrorCode = -18
+	ErrCodeNotEnoughOutsToMix      wallet.ErrorCode = -19
+	ErrCodeZeroDestination         wallet.ErrorCode = -20
+	ErrCodeWalletAlreadyExists     wallet.ErrorCode = -21
+	ErrCodeNoWalletDir             wallet.ErrorCode = -23
+	ErrCodeBadTxMetadata           wallet.ErrorCode = -27
+	ErrCodeNotEnoughUnlockedMoney  wallet.ErrorCode = -37
+	ErrCodeNoDaemonConnection      wallet.ErrorCode = -38
+)
+
+// Errors returned by monero-wallet-rpc are classified as one of the following,
+// and can be checked for with errors.Is
+var (
+	// ErrNotEnoughUnlockedMoney means the funds exist but are still locked
+	ErrNotEnoughUnlockedMoney = errors.New("not enough unlocked money")
+	// ErrNotEnoughMoney means the funds do not exist, including any locked funds
+	ErrNotEnoughMoney = errors.New("not enough money")
+	// ErrTxTooBig means the transfer needs to be split into multiple transactions
+	ErrTxTooBig = errors.New("transaction too big")
+	// ErrTxNotPossible means the transaction can not be created as requested, for example
+	// because the amount does not cover the fee or there are not enough decoys
+	ErrTxNotPossible = errors.New("transaction not possible")
+	// ErrWalletNotOpen means monero-wallet-rpc has no wallet open
+	ErrWalletNotOpen = errors.New("wallet not open")
+	// ErrWalletExists means a wallet of the same name already exists
+	ErrWalletExists = errors.New("wallet already exists")
+	// ErrNoWalletDir means monero-wallet-rpc was started with --wallet-file, so wallets can not be opened or created
+	ErrNoWalletDir = errors.New("no wallet dir configured")
+	// ErrDaemonBusy means the daemon monero-wallet-rpc uses is busy, usually syncing
+	ErrDaemonBusy = errors.New("daemon busy")
+	// ErrNoDaemonConnection means monero-wallet-rpc is unable to reach its daemon
+	ErrNoDaemonConnection = errors.New("no daemon connection")
+	// ErrDoubleSpend means the transaction spends outputs that were already spent
+	ErrDoubleSpend = errors.New("double spend")
+	// ErrInvalidAddress means a destination address is invalid
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrInvalidIndex means an account or subaddress index does not exist
+	ErrInvalidIndex = errors.New("invalid index")
+	// ErrInvalidKeyImage means the key image is malformed or not owned by the wallet
+	ErrInvalidKeyImage = errors.New("invalid key image")
+	// ErrTxNotFound means the wallet has no transaction with the given hash
+	ErrTxNotFound = errors.New("transaction not found")
+	// ErrBadTxMetadata means the transaction metadata given to relay is invalid
+	ErrBadTxMetadata = errors.New("bad transaction metadata")
+)
+
+// RPCError is an error returned by monero-wallet-rpc. Kind is one of the errors above,
+// or nil if the error could not be classified
+type RPCError struct {
+	Kind    error
+	Code    wallet.ErrorCode
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("wallet rpc error %d: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the kind of error, allowing errors.Is(err, ErrTxTooBig) and friends
+func (e *RPCError) Unwrap() error {
+	return e.Kind
+}
+
+// AsRPCError returns the RPCError wrapped by err if there is one
+func AsRPCError(err error) (*RPCError, bool) {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr, true
+	}
+	return nil, false
+}
+
+// IsTemporary returns whether or not err is a wallet error that is likely to go away on its own
+func IsTemporary(err error) bool {
+	return errors.Is(err, ErrDaemonBusy) || errors.Is(err, ErrNoDaemonConnection)
+}
+
+// NewRPCError returns a classified error for the given monero-wallet-rpc error code and message
+func NewRPCError(code wallet.ErrorCode, message string) *RPCError {
+	return &RPCError{Kind: classify(code, message), Code: code, Message: message}
+}
+
+// wrapError converts errors returned by monero-wallet-rpc into an RPCError,
+// leaving any other error such as those from the transport as is
+func wrapError(err error) error {
+	if jerr, ok := err.(*json2.Error); ok {
+		return NewRPCError(wallet.ErrorCode(jerr.Code), jerr.Message)
+	}
+	return err
+}
+
+// classify maps an error code and message to an error kind. Older versions of monero-wallet-rpc
+// report most transfer errors as generic, so the message is consulted when the code is not specific
+func classify(code wallet.ErrorCode, message string) error {
+	switch code {
+	case wallet.ErrWrongAddress:
+		return ErrInvalidAddress
+	case wallet.ErrDaemonIsBusy:
+		return ErrDaemonBusy
+	case wallet.ErrWrongTxID:
+		return ErrTxNotFound
+	case wallet.ErrWrongKeyImage:
+		return ErrInvalidKeyImage
+	case wallet.ErrWrongIndex, ErrCodeAccountIndexOutOfBounds, ErrCodeAddressIndexOutOfBounds:
+		return ErrInvalidIndex
+	case wallet.ErrNotOpen:
+		return ErrWalletNotOpen
+	case ErrCodeTxNotPossible, ErrCodeNotEnoughOutsToMix, ErrCodeZeroDestination:
+		return ErrTxNotPossible
+	case ErrCodeNotEnoughMoney:
+		return ErrNotEnoughMoney
+	case ErrCodeTxTooLarge:
+		return ErrTxTooBig
+	case ErrCodeWalletAlreadyExists:
+		return ErrWalletExists
+	case ErrCodeNoWalletDir:
+		return ErrNoWalletDir
+	case ErrCodeBadTxMetadata:
+		return ErrBadTxMetadata
+	case ErrCodeNotEnoughUnlockedMoney:
+		return ErrNotEnoughUnlockedMoney
+	case ErrCodeNoDaemonConnection:
+		return ErrNoDaemonConnection
+	}
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "try /transfer_split"), strings.Contains(msg, "too large"), strings.Contains(msg, "too big"):
+		return ErrTxTooBig
+	case strings.Contains(msg, "not enough unlocked money"), strings.Contains(msg, "no unlocked balance"):
+		return ErrNotEnoughUnlockedMoney
+	case strings.Contains(msg, "not enough money"):
+		return ErrNotEnoughMoney
+	case strings.Contains(msg, "double spend"):
+		return ErrDoubleSpend
+	case strings.Contains(msg, "no connection to daemon"):
+		return ErrNoDaemonConnection
+	case strings.Contains(msg, "daemon is busy"):
+		return ErrDaemonBusy
+	case strings.Contains(msg, "failed to parse tx metadata"):
+		return ErrBadTxMetadata
+	case strings.Contains(msg, "not enough outputs"), strings.Contains(msg, "amount must be more than zero"),
+		strings.Contains(msg, "no destinations"):
+		return ErrTxNotPossible
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/testenv/walletrpc"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPCErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    wallet.ErrorCode
+		message string
+		want    error
+	}{
+		{"not-enough-unlocked", client.ErrCodeNotEnoughUnlockedMoney, "not enough unlocked money", client.ErrNotEnoughUnlockedMoney},
+		{"not-enough-unlocked-generic", wallet.ErrGenericTransferError, "No unlocked balance in the specified account", client.ErrNotEnoughUnlockedMoney},
+		{"not-enough-money", client.ErrCodeNotEnoughMoney, "not enough money", client.ErrNotEnoughMoney},
+		{"not-enough-money-generic", wallet.ErrGenericTransferError, "not enough money", client.ErrNotEnoughMoney},
+		{"tx-too-large", client.ErrCodeTxTooLarge, "Transaction would be too large.  try /transfer_split.", client.ErrTxTooBig},
+		{"tx-too-large-generic", wallet.ErrGenericTransferError, "transaction would be too large.  try /transfer_split.", client.ErrTxTooBig},
+		{"not-possible", client.ErrCodeNotEnoughOutsToMix, "not enough outputs for specified ring size", client.ErrTxNotPossible},
+		{"not-open", wallet.ErrNotOpen, "No wallet file", client.ErrWalletNotOpen},
+		{"daemon-busy", wallet.ErrDaemonIsBusy, "daemon is busy. Please try again later.", client.ErrDaemonBusy},
+		{"no-daemon", wallet.ErrGenericTransferError, "No connection to daemon", client.ErrNoDaemonConnection},
+		{"double-spend", wallet.ErrGenericTransferError, "transaction abc was rejected by daemon with status: Failed. Reason: double spend", client.ErrDoubleSpend},
+		{"invalid-address", wallet.ErrWrongAddress, "WALLET_RPC_ERROR_CODE_WRONG_ADDRESS", client.ErrInvalidAddress},
+		{"invalid-index", client.ErrCodeAccountIndexOutOfBounds, "account index is out of bound", client.ErrInvalidIndex},
+		{"bad-metadata", client.ErrCodeBadTxMetadata, "Failed to parse tx metadata.", client.ErrBadTxMetadata},
+		{"unknown", wallet.ErrUnknown, "something else", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.NewRPCError(tt.code, tt.message)
+			require.Equal(t, tt.want, err.Kind)
+			if tt.want != nil {
+				require.True(t, errors.Is(err, tt.want))
+			}
+			require.Contains(t, err.Error(), tt.message)
+		})
+	}
+
+	// errors returned by monero-wallet-rpc are classified by the client
+	srv := walletrpc.New()
+	t.Cleanup(srv.Close)
+	srv.AddWallet(testNetWallet)
+	cl, err := client.NewClient(srv.URL())
+	require.NoError(t, err)
+	srv.InjectError("relay_tx", wallet.ErrGenericTransferError, "Reason: double spend", 1)
+	_, err = cl.Relay(context.Background(), testNetWallet, "metadata")
+	require.True(t, errors.Is(err, client.ErrDoubleSpend), err)
+	_, err = cl.Relay(context.Background(), testNetWallet, "metadata")
+	require.True(t, errors.Is(err, client.ErrBadTxMetadata), err)
+	require.False(t, client.IsTemporary(err))
+
+	srv.InjectError("get_accounts", wallet.ErrDaemonIsBusy, "daemon is busy", 1)
+	_, err = cl.GetAccounts(context.Background(), testNetWallet)
+	require.True(t, client.IsTemporary(err))
+}
@@ -0,0 +1,1106 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+const (
+	// FakeUnlockBlocks is the number of blocks an output received by a FakeWallet stays locked for,
+	// coinbase outputs stay locked for CoinbaseUnlockBlocks
+	FakeUnlockBlocks = UnlockBlocks
+	// FakeConfirmationThreshold is the number of confirmations after which a FakeWallet transaction is confirmed
+	FakeConfirmationThreshold = uint64(10)
+	// FakeBaseFee is the fee charged by a FakeWallet for a default priority transaction
+	FakeBaseFee = uint64(30000000)
+)
+
+// fee multipliers used by the wallet for each priority level
+var fakeFeeMultipliers = []uint64{1, 1, 5, 25, 1000}
+
+type fakeOutput struct {
+	keyImage string
+	amount   uint64
+	height   uint64 // height the output was mined at, 0 while in the pool
+	spent    bool
+	frozen   bool
+	coinbase bool
+	txHash   string
+}
+
+type fakeSubaddress struct {
+	address string
+	label   string
+	outputs []*fakeOutput
+}
+
+type fakeAccount struct {
+	label        string
+	subaddresses []*fakeSubaddress
+}
+
+type fakeTx struct {
+	hash         string
+	metadata     string
+	accountIndex uint64
+	inputs       []*fakeOutput
+	destinations map[string]uint64
+	amount       uint64
+	fee          uint64
+	relayed      bool
+	failed       bool   // dropped from the pool before being mined
+	height       uint64 // height the transaction was mined at, 0 while in the pool
+}
+
+// FakeWallet is an in-memory WalletRPC modelling accounts, subaddresses, outputs,
+// unrelayed transactions and confirmations. It is intended for use in tests where
+// a monero-wallet-rpc node is not available
+type FakeWallet struct {
+	// SplitThreshold when non-zero causes Transfer to fail for amounts above it,
+	// requiring callers to fall back to TransferSplit
+	SplitThreshold uint64
+	// RingSize is the ring size required by consensus, transfers and sweeps
+	// giving any other ring size fail. Defaults to DefaultRingSize
+	RingSize uint64
+
+	mux      sync.Mutex
+	name     string
+	height   uint64
+	accounts []*fakeAccount
+	txs      map[string]*fakeTx // maps tx hash to transaction
+}
+
+// NewFakeWallet returns an empty in-memory wallet with a single primary account
+func NewFakeWallet(walletName string) *FakeWallet {
+	fw := &FakeWallet{
+		name:     walletName,
+		height:   1,
+		txs:      make(map[string]*fakeTx),
+		RingSize: DefaultRingSize,
+	}
+	fw.newAccount("Primary account")
+	return fw
+}
+
+func fakeRandomHex(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func fakeWalletError(code wallet.ErrorCode, msg string) error {
+	return NewRPCError(code, msg)
+}
+
+// newAccount must be called with the lock held
+func (fw *FakeWallet) newAccount(label string) uint64 {
+	fw.accounts = append(fw.accounts, &fakeAccount{label: label})
+	index := uint64(len(fw.accounts) - 1)
+	fw.newSubaddress(index, label)
+	return index
+}
+
+// newSubaddress must be called with the lock held
+func (fw *FakeWallet) newSubaddress(accountIndex uint64, label string) *fakeSubaddress {
+	acct := fw.accounts[accountIndex]
+	sub := &fakeSubaddress{
+		address: fmt.Sprintf("fake-%s-%d-%d-%s", fw.name, accountIndex, len(acct.subaddresses), fakeRandomHex(8)),
+		label:   label,
+	}
+	acct.subaddresses = append(acct.subaddresses, sub)
+	return sub
+}
+
+// check must be called with the lock held
+func (fw *FakeWallet) check(walletName string, accountIndex uint64) error {
+	if walletName != fw.name {
+		return fakeWalletError(wallet.ErrUnknown, "Failed to open wallet")
+	}
+	if accountIndex >= uint64(len(fw.accounts)) {
+		return fakeWalletError(wallet.ErrWrongIndex, "account index is out of bound")
+	}
+	return nil
+}
+
+// findSubaddress must be called with the lock held
+func (fw *FakeWallet) findSubaddress(address string) *fakeSubaddress {
+	for _, acct := range fw.accounts {
+		for _, sub := range acct.subaddresses {
+			if sub.address == address {
+				return sub
+			}
+		}
+	}
+	return nil
+}
+
+// unlocked must be called with the lock held
+func (fw *FakeWallet) unlocked(out *fakeOutput) bool {
+	lock := FakeUnlockBlocks
+	if out.coinbase {
+		lock = CoinbaseUnlockBlocks
+	}
+	return !out.spent && out.height > 0 && out.height+lock <= fw.height
+}
+
+func (sub *fakeSubaddress) balances(fw *FakeWallet) (balance, unlocked uint64) {
+	for _, out := range sub.outputs {
+		// like monero-wallet-rpc frozen outputs are left out of balances
+		if out.spent || out.frozen {
+			continue
+		}
+		balance += out.amount
+		if fw.unlocked(out) {
+			unlocked += out.amount
+		}
+	}
+	return
+}
+
+// Fund deposits an already mined output of amount into the given subaddress. The output
+// remains locked until FakeUnlockBlocks blocks have been mined
+func (fw *FakeWallet) Fund(accountIndex, addressIndex, amount uint64) error {
+	return fw.fund(accountIndex, addressIndex, amount, false)
+}
+
+// FundCoinbase deposits a coinbase output of amount into the given subaddress, as if mined to
+// it. The output remains locked until CoinbaseUnlockBlocks blocks have been mined
+func (fw *FakeWallet) FundCoinbase(accountIndex, addressIndex, amount uint64) error {
+	return fw.fund(accountIndex, addressIndex, amount, true)
+}
+
+func (fw *FakeWallet) fund(accountIndex, addressIndex, amount uint64, coinbase bool) error {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := fw.check(fw.name, accountIndex); err != nil {
+		return err
+	}
+	acct := fw.accounts[accountIndex]
+	if addressIndex >= uint64(len(acct.subaddresses)) {
+		return fakeWalletError(wallet.ErrWrongIndex, "address index is out of bound")
+	}
+	acct.subaddresses[addressIndex].outputs = append(acct.subaddresses[addressIndex].outputs, &fakeOutput{
+		keyImage: fakeRandomHex(32),
+		amount:   amount,
+		height:   fw.height,
+		coinbase: coinbase,
+		txHash:   fakeRandomHex(32),
+	})
+	return nil
+}
+
+// MineBlocks advances the chain by the given number of blocks, including all
+// relayed transactions in the first mined block
+func (fw *FakeWallet) MineBlocks(count uint64) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	for i := uint64(0); i < count; i++ {
+		fw.height++
+		for _, tx := range fw.txs {
+			if !tx.relayed || tx.failed || tx.height != 0 {
+				continue
+			}
+			tx.height = fw.height
+			for _, acct := range fw.accounts {
+				for _, sub := range acct.subaddresses {
+					for _, out := range sub.outputs {
+						if out.txHash == tx.hash && out.height == 0 {
+							out.height = fw.height
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Height returns the current height of the fake chain
+func (fw *FakeWallet) Height() uint64 {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	return fw.height
+}
+
+// Incoming returns the mined incoming transfers of an account, as get_transfers does when
+// asked for them. Coinbase outputs are of type block
+func (fw *FakeWallet) Incoming(accountIndex uint64) []*wallet.Transfer {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if accountIndex >= uint64(len(fw.accounts)) {
+		return nil
+	}
+	var transfers []*wallet.Transfer
+	for i, sub := range fw.accounts[accountIndex].subaddresses {
+		for _, out := range sub.outputs {
+			if out.height == 0 {
+				continue
+			}
+			transfer := &wallet.Transfer{
+				Address: sub.address,
+				Amount:  out.amount,
+				Height:  out.height,
+				TxID:    out.txHash,
+				Type:    "in",
+			}
+			if out.coinbase {
+				transfer.Type = "block"
+			}
+			transfer.SubaddrIndex.Major, transfer.SubaddrIndex.Minor = accountIndex, uint64(i)
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
+
+// Unrelayed returns the number of created transactions which have not been relayed
+func (fw *FakeWallet) Unrelayed() int {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	var count int
+	for _, tx := range fw.txs {
+		if !tx.relayed {
+			count++
+		}
+	}
+	return count
+}
+
+// OpenWallet checks that walletName matches the fake wallet
+func (fw *FakeWallet) OpenWallet(ctx context.Context, walletName string) error {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fw.check(walletName, 0)
+}
+
+// GetAccounts returns all accounts under the wallet
+func (fw *FakeWallet) GetAccounts(ctx context.Context, walletName string) (*wallet.ResponseGetAccounts, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(walletName, 0); err != nil {
+		return nil, err
+	}
+	resp := &wallet.ResponseGetAccounts{}
+	resp.SubaddressAccounts = make([]struct {
+		AccountIndex    uint64 `json:"account_index"`
+		Balance         uint64 `json:"balance"`
+		BaseAddress     string `json:"base_address"`
+		Label           string `json:"label"`
+		Tag             string `json:"tag"`
+		UnlockedBalance uint64 `json:"unlocked_balance"`
+	}, len(fw.accounts))
+	for i, acct := range fw.accounts {
+		entry := &resp.SubaddressAccounts[i]
+		entry.AccountIndex = uint64(i)
+		entry.BaseAddress = acct.subaddresses[0].address
+		entry.Label = acct.label
+		for _, sub := range acct.subaddresses {
+			bal, unlocked := sub.balances(fw)
+			entry.Balance += bal
+			entry.UnlockedBalance += unlocked
+		}
+		resp.TotalBalance += entry.Balance
+		resp.TotalUnlockedBalance += entry.UnlockedBalance
+	}
+	return resp, nil
+}
+
+// GetAddress returns address information for a given account index optionally filtered by subaddress index
+func (fw *FakeWallet) GetAddress(ctx context.Context, walletName string, accountIndex uint64, addressIndex ...uint64) (*wallet.ResponseGetAddress, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(walletName, accountIndex); err != nil {
+		return nil, err
+	}
+	acct := fw.accounts[accountIndex]
+	indices := addressIndex
+	if len(indices) == 0 {
+		for i := range acct.subaddresses {
+			indices = append(indices, uint64(i))
+		}
+	}
+	resp := &wallet.ResponseGetAddress{Address: acct.subaddresses[0].address}
+	resp.Addresses = make([]struct {
+		Address      string `json:"address"`
+		Label        string `json:"label"`
+		AddressIndex uint64 `json:"address_index"`
+		Used         bool   `json:"used"`
+	}, len(indices))
+	for i, index := range indices {
+		if index >= uint64(len(acct.subaddresses)) {
+			return nil, fakeWalletError(wallet.ErrWrongIndex, "address index is out of bound")
+		}
+		sub := acct.subaddresses[index]
+		resp.Addresses[i].Address = sub.address
+		resp.Addresses[i].Label = sub.label
+		resp.Addresses[i].AddressIndex = index
+		resp.Addresses[i].Used = len(sub.outputs) > 0
+	}
+	return resp, nil
+}
+
+// AddressBalance returns the unlocked funds for the given address
+func (fw *FakeWallet) AddressBalance(ctx context.Context, walletName string, address string, accountIndex uint64, addressIndex ...uint64) (uint64, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := fw.check(walletName, accountIndex); err != nil {
+		return 0, err
+	}
+	for _, sub := range fw.accounts[accountIndex].subaddresses {
+		if sub.address == address {
+			_, unlocked := sub.balances(fw)
+			return unlocked, nil
+		}
+	}
+	return 0, nil
+}
+
+// NewAddress creates a new address under the given account index
+func (fw *FakeWallet) NewAddress(ctx context.Context, walletName string, accountIndex uint64) (string, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := fw.check(walletName, accountIndex); err != nil {
+		return "", err
+	}
+	return fw.newSubaddress(accountIndex, "").address, nil
+}
+
+// NewAccount is used to create a new account with an optional label
+func (fw *FakeWallet) NewAccount(ctx context.Context, walletName, label string) (*wallet.ResponseCreateAccount, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(walletName, 0); err != nil {
+		return nil, err
+	}
+	index := fw.newAccount(label)
+	return &wallet.ResponseCreateAccount{
+		AccountIndex: index,
+		Address:      fw.accounts[index].subaddresses[0].address,
+	}, nil
+}
+
+// GetChurnableAddresses returns addresses outside of the churn account that we can churn funds from
+func (fw *FakeWallet) GetChurnableAddresses(ctx context.Context, walletName string, churnAccountIndex, minBalance uint64) (*ChurnableAccounts, error) {
+	return getChurnableAddresses(ctx, fw, walletName, churnAccountIndex, minBalance)
+}
+
+// GetHeight returns the current height of the fake chain
+func (fw *FakeWallet) GetHeight(ctx context.Context, walletName string) (uint64, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := fw.check(walletName, 0); err != nil {
+		return 0, err
+	}
+	return fw.height, nil
+}
+
+// UnspentOutputs returns the mined, unspent outputs of the account
+func (fw *FakeWallet) UnspentOutputs(ctx context.Context, walletName string, accountIndex uint64) ([]Output, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(walletName, accountIndex); err != nil {
+		return nil, err
+	}
+	var outputs []Output
+	for i, sub := range fw.accounts[accountIndex].subaddresses {
+		for _, out := range sub.outputs {
+			if out.spent || out.height == 0 {
+				continue
+			}
+			outputs = append(outputs, Output{
+				Amount:      out.amount,
+				KeyImage:    out.keyImage,
+				TxHash:      out.txHash,
+				BlockHeight: out.height,
+				Subaddress:  SubaddressIndex{Major: accountIndex, Minor: uint64(i)},
+				Frozen:      out.frozen,
+				Unlocked:    fw.unlocked(out),
+				Coinbase:    out.coinbase,
+			})
+		}
+	}
+	return outputs, nil
+}
+
+// GetChurnableOutputs returns unlocked outputs outside of the churn account that we can churn funds from
+func (fw *FakeWallet) GetChurnableOutputs(ctx context.Context, walletName string, churnAccountIndex, minAmount uint64) ([]ChurnableOutput, error) {
+	return getChurnableOutputs(ctx, fw, walletName, churnAccountIndex, minAmount)
+}
+
+// Freeze marks the output with the given key image as frozen, so that it is not spent
+func (fw *FakeWallet) Freeze(ctx context.Context, walletName, keyImage string) error {
+	return fw.setFrozen(ctx, walletName, keyImage, true)
+}
+
+// Thaw marks the output with the given key image as no longer frozen
+func (fw *FakeWallet) Thaw(ctx context.Context, walletName, keyImage string) error {
+	return fw.setFrozen(ctx, walletName, keyImage, false)
+}
+
+// Frozen returns whether the output with the given key image is frozen
+func (fw *FakeWallet) Frozen(ctx context.Context, walletName, keyImage string) (bool, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if err := fw.check(walletName, 0); err != nil {
+		return false, err
+	}
+	out := fw.findOutput(keyImage)
+	if out == nil {
+		return false, fakeWalletError(wallet.ErrWrongKeyImage, "Key image not found")
+	}
+	return out.frozen, nil
+}
+
+func (fw *FakeWallet) setFrozen(ctx context.Context, walletName, keyImage string, frozen bool) error {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := fw.check(walletName, 0); err != nil {
+		return err
+	}
+	out := fw.findOutput(keyImage)
+	if out == nil {
+		return fakeWalletError(wallet.ErrWrongKeyImage, "Key image not found")
+	}
+	out.frozen = frozen
+	return nil
+}
+
+// findOutput must be called with the lock held
+func (fw *FakeWallet) findOutput(keyImage string) *fakeOutput {
+	for _, acct := range fw.accounts {
+		for _, sub := range acct.subaddresses {
+			for _, out := range sub.outputs {
+				if out.keyImage == keyImage {
+					return out
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fee returns the fee charged for a transaction of the given priority
+func (fw *FakeWallet) fee(priority wallet.Priority) uint64 {
+	multiplier := fakeFeeMultipliers[0]
+	if int(priority) < len(fakeFeeMultipliers) {
+		multiplier = fakeFeeMultipliers[priority]
+	}
+	return FakeBaseFee * multiplier
+}
+
+// spendable returns all unlocked outputs that are not frozen of the account. Like monero-wallet-rpc, outputs used
+// by transactions created with DoNotRelay remain spendable until one of them is relayed.
+// must be called with the lock held
+func (fw *FakeWallet) spendable(accountIndex uint64, subaddrIndices []uint64) ([]*fakeOutput, error) {
+	acct := fw.accounts[accountIndex]
+	indices := subaddrIndices
+	if len(indices) == 0 {
+		for i := range acct.subaddresses {
+			indices = append(indices, uint64(i))
+		}
+	}
+	var outputs []*fakeOutput
+	for _, index := range indices {
+		if index >= uint64(len(acct.subaddresses)) {
+			return nil, fakeWalletError(wallet.ErrWrongIndex, "address index is out of bound")
+		}
+		for _, out := range acct.subaddresses[index].outputs {
+			if fw.unlocked(out) && !out.frozen {
+				outputs = append(outputs, out)
+			}
+		}
+	}
+	return outputs, nil
+}
+
+// locked returns the balance of outputs that are neither unlocked nor spent. must be called with the lock held
+func (fw *FakeWallet) locked(accountIndex uint64, subaddrIndices []uint64) uint64 {
+	acct := fw.accounts[accountIndex]
+	var total uint64
+	for i, sub := range acct.subaddresses {
+		if len(subaddrIndices) > 0 && !containsIndex(subaddrIndices, uint64(i)) {
+			continue
+		}
+		for _, out := range sub.outputs {
+			if !out.spent && !out.frozen && !fw.unlocked(out) {
+				total += out.amount
+			}
+		}
+	}
+	return total
+}
+
+func containsIndex(indices []uint64, index uint64) bool {
+	for _, i := range indices {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDestinations must be called with the lock held
+func (fw *FakeWallet) checkDestinations(destinations map[string]uint64) error {
+	if len(destinations) == 0 {
+		return fakeWalletError(ErrCodeZeroDestination, "No destinations for this transfer")
+	}
+	for addr := range destinations {
+		if addr == "" {
+			return fakeWalletError(wallet.ErrWrongAddress, "WALLET_RPC_ERROR_CODE_WRONG_ADDRESS")
+		}
+	}
+	return nil
+}
+
+// newTx records an unrelayed transaction. must be called with the lock held
+func (fw *FakeWallet) newTx(accountIndex uint64, inputs []*fakeOutput, destinations map[string]uint64, amount, fee uint64) *fakeTx {
+	tx := &fakeTx{
+		hash:         fakeRandomHex(32),
+		metadata:     fakeRandomHex(64),
+		accountIndex: accountIndex,
+		inputs:       inputs,
+		destinations: destinations,
+		amount:       amount,
+		fee:          fee,
+	}
+	fw.txs[tx.hash] = tx
+	return tx
+}
+
+// checkRingSize fails for ring sizes other than the one required by consensus,
+// a ring size of 0 uses the required size. must be called with the lock held
+func (fw *FakeWallet) checkRingSize(ringSize uint64) error {
+	if ringSize == 0 || ringSize == fw.RingSize {
+		return nil
+	}
+	return fakeWalletError(wallet.ErrGenericTransferError, fmt.Sprintf("invalid ring size %d, %d is required", ringSize, fw.RingSize))
+}
+
+// createTx selects unlocked inputs covering amount plus fee and records an unrelayed transaction.
+// Outputs in used are skipped, allowing several transactions to be created from distinct inputs.
+// must be called with the lock held
+func (fw *FakeWallet) createTx(opts TransferOpts, amount uint64, destinations map[string]uint64, used map[*fakeOutput]bool) (*fakeTx, error) {
+	if err := fw.check(opts.WalletName, opts.AccountIndex); err != nil {
+		return nil, err
+	}
+	if err := fw.checkDestinations(destinations); err != nil {
+		return nil, err
+	}
+	if err := fw.checkRingSize(opts.RingSize); err != nil {
+		return nil, err
+	}
+	if amount == 0 {
+		return nil, fakeWalletError(ErrCodeZeroDestination, "transaction amount must be more than zero")
+	}
+	fee := fw.fee(opts.Priority)
+	outputs, err := fw.spendable(opts.AccountIndex, opts.SubaddrIndices)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		inputs []*fakeOutput
+		total  uint64
+	)
+	for _, out := range outputs {
+		if total >= amount+fee {
+			break
+		}
+		if used[out] {
+			continue
+		}
+		inputs = append(inputs, out)
+		total += out.amount
+	}
+	if total < amount+fee {
+		if total+fw.locked(opts.AccountIndex, opts.SubaddrIndices) >= amount+fee {
+			return nil, fakeWalletError(ErrCodeNotEnoughUnlockedMoney, "not enough unlocked money")
+		}
+		return nil, fakeWalletError(ErrCodeNotEnoughMoney, "not enough money")
+	}
+	return fw.newTx(opts.AccountIndex, inputs, destinations, amount, fee), nil
+}
+
+// createSweep records an unrelayed transaction spending all of inputs to the single destination
+// of opts. must be called with the lock held
+func (fw *FakeWallet) createSweep(opts TransferOpts, inputs []*fakeOutput) (*fakeTx, error) {
+	if err := fw.checkDestinations(opts.Destinations); err != nil {
+		return nil, err
+	}
+	if err := fw.checkRingSize(opts.RingSize); err != nil {
+		return nil, err
+	}
+	var addr string
+	for k := range opts.Destinations {
+		addr = k
+	}
+	var total uint64
+	for _, in := range inputs {
+		total += in.amount
+	}
+	fee := fw.fee(opts.Priority)
+	if len(inputs) == 0 || total <= fee {
+		return nil, fakeWalletError(wallet.ErrGenericTransferError, "No unlocked balance in the specified account")
+	}
+	return fw.newTx(opts.AccountIndex, inputs, map[string]uint64{addr: total - fee}, total-fee, fee), nil
+}
+
+// relay broadcasts tx, spending its inputs and crediting any destinations owned by the wallet.
+// must be called with the lock held
+func (fw *FakeWallet) relay(tx *fakeTx) error {
+	if tx.relayed {
+		return fakeWalletError(wallet.ErrGenericTransferError, "Failed to commit tx.")
+	}
+	for _, in := range tx.inputs {
+		if in.spent {
+			return fakeWalletError(wallet.ErrGenericTransferError, "transaction "+tx.hash+" was rejected by daemon with status: Failed. Reason: double spend")
+		}
+	}
+	var total uint64
+	for _, in := range tx.inputs {
+		in.spent = true
+		total += in.amount
+	}
+	for addr, amount := range tx.destinations {
+		if sub := fw.findSubaddress(addr); sub != nil {
+			sub.outputs = append(sub.outputs, &fakeOutput{keyImage: fakeRandomHex(32), amount: amount, txHash: tx.hash})
+		}
+	}
+	// change is returned to the primary address of the sending account
+	if change := total - tx.amount - tx.fee; change > 0 {
+		sub := fw.accounts[tx.accountIndex].subaddresses[0]
+		sub.outputs = append(sub.outputs, &fakeOutput{keyImage: fakeRandomHex(32), amount: change, txHash: tx.hash})
+	}
+	tx.relayed = true
+	return nil
+}
+
+func (fw *FakeWallet) sumDestinations(opts TransferOpts) uint64 {
+	var amount uint64
+	for _, v := range opts.Destinations {
+		amount += v
+	}
+	return amount
+}
+
+// Transfer creates a transaction, relaying it unless DoNotRelay is set
+func (fw *FakeWallet) Transfer(ctx context.Context, opts TransferOpts) (*wallet.ResponseTransfer, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	amount := fw.sumDestinations(opts)
+	if fw.SplitThreshold > 0 && amount > fw.SplitThreshold {
+		return nil, fakeWalletError(ErrCodeTxTooLarge, "Transaction would be too large.  try /transfer_split.")
+	}
+	tx, err := fw.createTx(opts, amount, opts.Destinations, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DoNotRelay {
+		if err := fw.relay(tx); err != nil {
+			return nil, err
+		}
+	}
+	return &wallet.ResponseTransfer{
+		Amount:     tx.amount,
+		Fee:        tx.fee,
+		TxHash:     tx.hash,
+		TxMetadata: tx.metadata,
+	}, nil
+}
+
+// TransferSplit is like Transfer, but splits amounts above SplitThreshold into multiple transactions
+func (fw *FakeWallet) TransferSplit(ctx context.Context, opts TransferOpts) (*wallet.ResponseTransferSplit, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var txs []*fakeTx
+	used := make(map[*fakeOutput]bool)
+	for addr, amount := range opts.Destinations {
+		for amount > 0 {
+			part := amount
+			if fw.SplitThreshold > 0 && part > fw.SplitThreshold {
+				part = fw.SplitThreshold
+			}
+			tx, err := fw.createTx(opts, part, map[string]uint64{addr: part}, used)
+			if err != nil {
+				// release anything created so far
+				for _, tx := range txs {
+					delete(fw.txs, tx.hash)
+				}
+				return nil, err
+			}
+			for _, in := range tx.inputs {
+				used[in] = true
+			}
+			txs = append(txs, tx)
+			amount -= part
+		}
+	}
+	resp := &wallet.ResponseTransferSplit{}
+	for _, tx := range txs {
+		if !opts.DoNotRelay {
+			if err := fw.relay(tx); err != nil {
+				return nil, err
+			}
+		}
+		resp.TxHashList = append(resp.TxHashList, tx.hash)
+		resp.AmountList = append(resp.AmountList, tx.amount)
+		resp.FeeList = append(resp.FeeList, tx.fee)
+		resp.TxMetadataList = append(resp.TxMetadataList, tx.metadata)
+	}
+	return resp, nil
+}
+
+// Relay broadcasts a previously created transaction returning its hash
+func (fw *FakeWallet) Relay(ctx context.Context, walletName, txMetadata string) (string, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := fw.check(walletName, 0); err != nil {
+		return "", err
+	}
+	for _, tx := range fw.txs {
+		if tx.metadata == txMetadata {
+			if err := fw.relay(tx); err != nil {
+				return "", err
+			}
+			return tx.hash, nil
+		}
+	}
+	return "", fakeWalletError(ErrCodeBadTxMetadata, "Failed to parse tx metadata.")
+}
+
+// SweepAll sends all unlocked funds in the account, optionally limited to SubaddrIndices, to the destination
+func (fw *FakeWallet) SweepAll(ctx context.Context, opts TransferOpts) (*wallet.ResponseSweepAll, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(opts.WalletName, opts.AccountIndex); err != nil {
+		return nil, err
+	}
+	inputs, err := fw.spendable(opts.AccountIndex, opts.SubaddrIndices)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := fw.createSweep(opts, inputs)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DoNotRelay {
+		if err := fw.relay(tx); err != nil {
+			return nil, err
+		}
+	}
+	return &wallet.ResponseSweepAll{
+		TxHashList:     []string{tx.hash},
+		AmountList:     []uint64{tx.amount},
+		FeeList:        []uint64{tx.fee},
+		TxMetadataList: []string{tx.metadata},
+	}, nil
+}
+
+// EstimateFee returns the fee of sweeping all unlocked funds of opts.SubaddrIndices to the destination,
+// without recording a transaction
+func (fw *FakeWallet) EstimateFee(ctx context.Context, opts TransferOpts) (uint64, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := fw.check(opts.WalletName, opts.AccountIndex); err != nil {
+		return 0, err
+	}
+	inputs, err := fw.spendable(opts.AccountIndex, opts.SubaddrIndices)
+	if err != nil {
+		return 0, err
+	}
+	if err := fw.checkDestinations(opts.Destinations); err != nil {
+		return 0, err
+	}
+	if err := fw.checkRingSize(opts.RingSize); err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, in := range inputs {
+		total += in.amount
+	}
+	fee := fw.fee(opts.Priority)
+	if len(inputs) == 0 || total <= fee {
+		return 0, fakeWalletError(wallet.ErrGenericTransferError, "No unlocked balance in the specified account")
+	}
+	return fee, nil
+}
+
+// SweepSingle sends the unlocked output identified by opts.KeyImage to the destination
+func (fw *FakeWallet) SweepSingle(ctx context.Context, opts TransferOpts) (*ResponseSweepSingle, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(opts.WalletName, opts.AccountIndex); err != nil {
+		return nil, err
+	}
+	outputs, err := fw.spendable(opts.AccountIndex, nil)
+	if err != nil {
+		return nil, err
+	}
+	var inputs []*fakeOutput
+	for _, out := range outputs {
+		if out.keyImage == opts.KeyImage {
+			inputs = append(inputs, out)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fakeWalletError(wallet.ErrWrongKeyImage, "failed to find key image")
+	}
+	tx, err := fw.createSweep(opts, inputs)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DoNotRelay {
+		if err := fw.relay(tx); err != nil {
+			return nil, err
+		}
+	}
+	return &ResponseSweepSingle{
+		TxHash:     tx.hash,
+		Amount:     tx.amount,
+		Fee:        tx.fee,
+		TxMetadata: tx.metadata,
+	}, nil
+}
+
+// SweepDust always returns an empty response since the fake wallet has no pre-ringCT outputs
+func (fw *FakeWallet) SweepDust(ctx context.Context, walletName string) (*wallet.ResponseSweepDust, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(walletName, 0); err != nil {
+		return nil, err
+	}
+	return &wallet.ResponseSweepDust{}, nil
+}
+
+// Balance returns the locked and unlocked balances of an account, along with per subaddress balances
+func (fw *FakeWallet) Balance(ctx context.Context, walletName string, accountIndex uint64, addressIndices ...uint64) (*wallet.ResponseGetBalance, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(walletName, accountIndex); err != nil {
+		return nil, err
+	}
+	acct := fw.accounts[accountIndex]
+	resp := &wallet.ResponseGetBalance{}
+	for _, sub := range acct.subaddresses {
+		bal, unlocked := sub.balances(fw)
+		resp.Balance += bal
+		resp.UnlockedBalance += unlocked
+	}
+	indices := addressIndices
+	if len(indices) == 0 {
+		for i := range acct.subaddresses {
+			indices = append(indices, uint64(i))
+		}
+	}
+	resp.PerSubaddress = make([]struct {
+		AddressIndex      uint64 `json:"address_index"`
+		Address           string `json:"address"`
+		Balance           uint64 `json:"balance"`
+		UnlockedBalance   uint64 `json:"unlocked_balance"`
+		Label             string `json:"label"`
+		NumUnspentOutputs uint64 `json:"num_unspent_outputs"`
+		BlocksToUnlock    int64  `json:"blocks_to_unlock"`
+	}, len(indices))
+	for i, index := range indices {
+		if index >= uint64(len(acct.subaddresses)) {
+			return nil, fakeWalletError(wallet.ErrWrongIndex, "address index is out of bound")
+		}
+		sub := acct.subaddresses[index]
+		bal, unlocked := sub.balances(fw)
+		entry := &resp.PerSubaddress[i]
+		entry.AddressIndex = index
+		entry.Address = sub.address
+		entry.Balance = bal
+		entry.UnlockedBalance = unlocked
+		entry.Label = sub.label
+		for _, out := range sub.outputs {
+			if !out.spent {
+				entry.NumUnspentOutputs++
+			}
+		}
+	}
+	return resp, nil
+}
+
+// GetTransferByTxID returns information about a relayed transaction
+func (fw *FakeWallet) GetTransferByTxID(ctx context.Context, walletName, txHash string) (*wallet.ResponseGetTransferByTxID, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(walletName, 0); err != nil {
+		return nil, err
+	}
+	tx, ok := fw.txs[txHash]
+	if !ok || !tx.relayed {
+		return nil, fakeWalletError(wallet.ErrWrongTxID, "Transaction not found.")
+	}
+	return &wallet.ResponseGetTransferByTxID{Transfer: *fw.transfer(tx)}, nil
+}
+
+// transfer describes an outgoing transaction the way get_transfers does, must be called with the lock held
+func (fw *FakeWallet) transfer(tx *fakeTx) *wallet.Transfer {
+	transfer := &wallet.Transfer{
+		Address:                         fw.accounts[tx.accountIndex].subaddresses[0].address,
+		Amount:                          tx.amount,
+		Fee:                             tx.fee,
+		Height:                          tx.height,
+		SuggestedConfirmationsThreshold: FakeConfirmationThreshold,
+		TxID:                            tx.hash,
+		Type:                            "pending",
+	}
+	transfer.SubaddrIndex.Major = tx.accountIndex
+	if tx.failed {
+		transfer.Type = "failed"
+	} else if tx.height > 0 {
+		transfer.Type = "out"
+		transfer.Confirmations = fw.height - tx.height
+	}
+	for addr, amount := range tx.destinations {
+		transfer.Destinations = append(transfer.Destinations, &wallet.Destination{
+			Address: addr,
+			Amount:  amount,
+		})
+	}
+	return transfer
+}
+
+// GetTransfers returns the relayed outgoing transactions of an account, grouped by type
+func (fw *FakeWallet) GetTransfers(ctx context.Context, walletName string, accountIndex uint64) (*wallet.ResponseGetTransfers, error) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := fw.check(walletName, accountIndex); err != nil {
+		return nil, err
+	}
+	resp := &wallet.ResponseGetTransfers{}
+	for _, tx := range fw.txs {
+		if !tx.relayed || tx.accountIndex != accountIndex {
+			continue
+		}
+		transfer := fw.transfer(tx)
+		switch transfer.Type {
+		case "out":
+			resp.Out = append(resp.Out, transfer)
+		case "failed":
+			resp.Failed = append(resp.Failed, transfer)
+		default:
+			resp.Pending = append(resp.Pending, transfer)
+		}
+	}
+	return resp, nil
+}
+
+// TxStatus returns where the given transaction is in its lifecycle
+func (fw *FakeWallet) TxStatus(ctx context.Context, walletName, txHash string) (*TxStatus, error) {
+	resp, err := fw.GetTransferByTxID(ctx, walletName, txHash)
+	if err != nil {
+		return txStatusError(err)
+	}
+	return newTxStatus(&resp.Transfer), nil
+}
+
+// FailTx drops a relayed transaction from the pool as if it had been double spent, making its
+// inputs spendable again and removing the outputs it created
+func (fw *FakeWallet) FailTx(txHash string) error {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	tx, ok := fw.txs[txHash]
+	if !ok || !tx.relayed || tx.failed {
+		return fmt.Errorf("transaction %s is not pending", txHash)
+	}
+	if tx.height != 0 {
+		return fmt.Errorf("transaction %s has already been mined", txHash)
+	}
+	for _, in := range tx.inputs {
+		in.spent = false
+	}
+	for _, acct := range fw.accounts {
+		for _, sub := range acct.subaddresses {
+			outputs := sub.outputs[:0]
+			for _, out := range sub.outputs {
+				if out.txHash != txHash {
+					outputs = append(outputs, out)
+				}
+			}
+			sub.outputs = outputs
+		}
+	}
+	tx.failed = true
+	return nil
+}
+
+// ForgetTx removes all record of a transaction from the wallet, as happens when
+// a wallet is restored from its seed while the transaction is in the pool
+func (fw *FakeWallet) ForgetTx(txHash string) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	delete(fw.txs, txHash)
+}
+
+// Close is a noop for the fake wallet
+func (fw *FakeWallet) Close() error {
+	return nil
+}
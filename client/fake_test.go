@@ -0,0 +1,155 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeWallet(t *testing.T) {
+	ctx := context.Background()
+	fw := client.NewFakeWallet(testNetWallet)
+	require.Error(t, fw.OpenWallet(ctx, "notawallet"))
+	require.NoError(t, fw.OpenWallet(ctx, testNetWallet))
+
+	acct, err := fw.NewAccount(ctx, testNetWallet, "churn-account")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), acct.AccountIndex)
+
+	// funds are locked until enough blocks are mined
+	require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+	require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+	churns, err := fw.GetChurnableAddresses(ctx, testNetWallet, 1, wallet.Float64ToXMR(0.1))
+	require.NoError(t, err)
+	require.Len(t, churns.Accounts, 1)
+	require.Len(t, churns.Accounts[0].Subaddresses, 0)
+
+	fw.MineBlocks(client.FakeUnlockBlocks)
+	churns, err = fw.GetChurnableAddresses(ctx, testNetWallet, 1, wallet.Float64ToXMR(0.1))
+	require.NoError(t, err)
+	require.Len(t, churns.Accounts[0].Subaddresses, 1)
+	sub := churns.Accounts[0].Subaddresses[0]
+	require.Equal(t, wallet.Float64ToXMR(2), sub.Balance)
+
+	dest, err := fw.NewAddress(ctx, testNetWallet, 1)
+	require.NoError(t, err)
+
+	// transfers above the split threshold must use transfer split
+	fw.SplitThreshold = wallet.Float64ToXMR(0.9)
+	opts := client.TransferOpts{
+		WalletName:     testNetWallet,
+		Destinations:   map[string]uint64{dest: wallet.Float64ToXMR(1.5)},
+		AccountIndex:   0,
+		SubaddrIndices: []uint64{sub.AddressIndex},
+		Priority:       wallet.PriorityDefault,
+		DoNotRelay:     true,
+	}
+	_, err = fw.Transfer(ctx, opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "try /transfer_split")
+
+	split, err := fw.TransferSplit(ctx, opts)
+	require.NoError(t, err)
+	require.Len(t, split.TxMetadataList, 2)
+	require.Equal(t, 2, fw.Unrelayed())
+
+	// nothing is spent until relayed
+	bal, err := fw.AddressBalance(ctx, testNetWallet, sub.Address, 0, sub.AddressIndex)
+	require.NoError(t, err)
+	require.Equal(t, wallet.Float64ToXMR(2), bal)
+
+	// estimating a fee creates no transaction
+	fee, err := fw.EstimateFee(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, client.FakeBaseFee, fee)
+	require.Equal(t, 2, fw.Unrelayed())
+
+	var hashes []string
+	for _, meta := range split.TxMetadataList {
+		hash, err := fw.Relay(ctx, testNetWallet, meta)
+		require.NoError(t, err)
+		hashes = append(hashes, hash)
+		_, err = fw.Relay(ctx, testNetWallet, meta)
+		require.Error(t, err)
+	}
+	require.Equal(t, 0, fw.Unrelayed())
+
+	for _, hash := range hashes {
+		status, err := fw.TxStatus(ctx, testNetWallet, hash)
+		require.NoError(t, err)
+		require.Equal(t, client.TxPending, status.State)
+	}
+	fw.MineBlocks(1)
+	for _, hash := range hashes {
+		status, err := fw.TxStatus(ctx, testNetWallet, hash)
+		require.NoError(t, err)
+		require.Equal(t, client.TxConfirmed, status.State)
+		require.False(t, status.Final())
+	}
+	fw.MineBlocks(client.FakeConfirmationThreshold)
+	for _, hash := range hashes {
+		status, err := fw.TxStatus(ctx, testNetWallet, hash)
+		require.NoError(t, err)
+		require.True(t, status.Final())
+		require.Error(t, fw.FailTx(hash))
+	}
+	status, err := fw.TxStatus(ctx, testNetWallet, "unknown")
+	require.NoError(t, err)
+	require.Equal(t, client.TxUnknown, status.State)
+
+	accts, err := fw.GetAccounts(ctx, testNetWallet)
+	require.NoError(t, err)
+	require.Equal(t, wallet.Float64ToXMR(1.5), accts.SubaddressAccounts[1].UnlockedBalance)
+	require.Equal(t, wallet.Float64ToXMR(0.5)-2*client.FakeBaseFee, accts.SubaddressAccounts[0].UnlockedBalance)
+
+	// like monero-wallet-rpc, unrelayed transactions do not reserve their inputs
+	first, err := fw.Transfer(ctx, client.TransferOpts{
+		WalletName:   testNetWallet,
+		Destinations: map[string]uint64{dest: wallet.Float64ToXMR(0.1)},
+		AccountIndex: 1,
+		DoNotRelay:   true,
+	})
+	require.NoError(t, err)
+	second, err := fw.Transfer(ctx, client.TransferOpts{
+		WalletName:   testNetWallet,
+		Destinations: map[string]uint64{dest: wallet.Float64ToXMR(0.1)},
+		AccountIndex: 1,
+		DoNotRelay:   true,
+	})
+	require.NoError(t, err)
+	_, err = fw.Relay(ctx, testNetWallet, first.TxMetadata)
+	require.NoError(t, err)
+	_, err = fw.Relay(ctx, testNetWallet, second.TxMetadata)
+	require.True(t, errors.Is(err, client.ErrDoubleSpend), err)
+
+	// a failed transaction gives its inputs back, so the other one can be relayed
+	require.NoError(t, fw.FailTx(first.TxHash))
+	status, err = fw.TxStatus(ctx, testNetWallet, first.TxHash)
+	require.NoError(t, err)
+	require.Equal(t, client.TxFailed, status.State)
+	require.Error(t, fw.FailTx(first.TxHash))
+	_, err = fw.Relay(ctx, testNetWallet, second.TxMetadata)
+	require.NoError(t, err)
+	transfers, err := fw.GetTransfers(ctx, testNetWallet, 1)
+	require.NoError(t, err)
+	require.Len(t, transfers.Failed, 1)
+	require.Equal(t, first.TxHash, transfers.Failed[0].TxID)
+	require.Len(t, transfers.Pending, 1)
+	require.Equal(t, second.TxHash, transfers.Pending[0].TxID)
+	fw.MineBlocks(1)
+	status, err = fw.TxStatus(ctx, testNetWallet, first.TxHash)
+	require.NoError(t, err)
+	require.Equal(t, client.TxFailed, status.State)
+	transfers, err = fw.GetTransfers(ctx, testNetWallet, 1)
+	require.NoError(t, err)
+	require.Len(t, transfers.Out, 1)
+	require.Empty(t, transfers.Pending)
+	fw.ForgetTx(second.TxHash)
+	status, err = fw.TxStatus(ctx, testNetWallet, second.TxHash)
+	require.NoError(t, err)
+	require.Equal(t, client.TxUnknown, status.State)
+}
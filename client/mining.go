@@ -1,21 +1,23 @@
 package client
 
-import "github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+import (
+	"context"
+
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
 
 // StopMining stops active mining processes
-func (c *Client) StopMining(walletName string) error {
-	if err := c.OpenWallet(walletName); err != nil {
-		return err
-	}
-	return c.mw.StopMining()
+func (c *Client) StopMining(ctx context.Context, walletName string) error {
+	return c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		return mw.StopMining()
+	})
 }
 
 // StartMining starts actively mining blocks with the given threads
-func (c *Client) StartMining(walletName string, threads uint64) error {
-	if err := c.OpenWallet(walletName); err != nil {
-		return err
-	}
-	return c.mw.StartMining(&wallet.RequestStartMining{
-		ThreadsCount: threads,
+func (c *Client) StartMining(ctx context.Context, walletName string, threads uint64) error {
+	return c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		return mw.StartMining(&wallet.RequestStartMining{
+			ThreadsCount: threads,
+		})
 	})
 }
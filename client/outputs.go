@@ -0,0 +1,222 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/rpc/v2/json2"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+const (
+	// UnlockBlocks is the number of blocks a received output stays locked for
+	UnlockBlocks = uint64(10)
+	// CoinbaseUnlockBlocks is the number of blocks a coinbase output stays locked for
+	CoinbaseUnlockBlocks = uint64(60)
+	// BlockTime is the target time between blocks
+	BlockTime = 2 * time.Minute
+)
+
+// SubaddressIndex identifies a subaddress by its account and address index
+type SubaddressIndex struct {
+	Major uint64 `json:"major"` // the account index
+	Minor uint64 `json:"minor"` // the address index
+}
+
+// Output is an unspent output received by the wallet, as returned by incoming_transfers
+type Output struct {
+	Amount      uint64          `json:"amount"`
+	KeyImage    string          `json:"key_image"`
+	TxHash      string          `json:"tx_hash"`
+	BlockHeight uint64          `json:"block_height"`
+	Subaddress  SubaddressIndex `json:"subaddr_index"`
+	Spent       bool            `json:"spent"`
+	Frozen      bool            `json:"frozen"`
+	Unlocked    bool            `json:"unlocked"`
+	// incoming_transfers does not report coinbase outputs, UnspentOutputs finds them with get_transfers
+	Coinbase bool `json:"-"`
+}
+
+// UnlockHeight returns the height at which the output unlocks, unless it was sent with a later unlock time
+func (o Output) UnlockHeight() uint64 {
+	if o.Coinbase {
+		return o.BlockHeight + CoinbaseUnlockBlocks
+	}
+	return o.BlockHeight + UnlockBlocks
+}
+
+// IncomingTransfers is the response to incoming_transfers. The wallet package decodes the
+// transfers as a single object rather than a list, so it is not used
+type IncomingTransfers struct {
+	Transfers []Output `json:"transfers"`
+}
+
+type requestIncomingTransfers struct {
+	TransferType string `json:"transfer_type"`
+	AccountIndex uint64 `json:"account_index"`
+	Verbose      bool   `json:"verbose"`
+}
+
+type requestKeyImage struct {
+	KeyImage string `json:"key_image"`
+}
+
+// ResponseFrozen is the response to frozen
+type ResponseFrozen struct {
+	Frozen bool `json:"frozen"`
+}
+
+// ChurnableOutput is a single unlocked output that we can churn funds from
+type ChurnableOutput struct {
+	AccountIndex uint64
+	AddressIndex uint64
+	Address      string
+	BaseAddress  string
+	KeyImage     string
+	Amount       uint64
+}
+
+// UnspentOutputs returns the unspent outputs of an account along with their key images. While
+// any are locked the incoming transfers of the account are read to find which are coinbase outputs
+func (c *Client) UnspentOutputs(ctx context.Context, walletName string, accountIndex uint64) ([]Output, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	var resp IncomingTransfers
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		if err := c.rpc(ctx, "incoming_transfers", &requestIncomingTransfers{
+			TransferType: "available",
+			AccountIndex: accountIndex,
+			Verbose:      true,
+		}, &resp); err != nil {
+			return err
+		}
+		locked := false
+		for _, out := range resp.Transfers {
+			locked = locked || !out.Unlocked
+		}
+		if !locked {
+			return nil
+		}
+		transfers, err := mw.GetTransfers(&wallet.RequestGetTransfers{In: true, AccountIndex: accountIndex})
+		if err != nil {
+			return err
+		}
+		coinbase := make(map[string]bool)
+		for _, in := range transfers.In {
+			if in.Type == "block" {
+				coinbase[in.TxID] = true
+			}
+		}
+		for i := range resp.Transfers {
+			resp.Transfers[i].Coinbase = coinbase[resp.Transfers[i].TxHash]
+		}
+		return nil
+	})
+	return resp.Transfers, err
+}
+
+// GetChurnableOutputs is used to get unlocked outputs of at least minAmount that we can churn
+// one at a time. Like GetChurnableAddresses the account matching churnAccountIndex is skipped
+func (c *Client) GetChurnableOutputs(ctx context.Context, walletName string, churnAccountIndex, minAmount uint64) ([]ChurnableOutput, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	return getChurnableOutputs(ctx, c, walletName, churnAccountIndex, minAmount)
+}
+
+func getChurnableOutputs(ctx context.Context, c WalletRPC, walletName string, churnAccountIndex, minAmount uint64) ([]ChurnableOutput, error) {
+	accts, err := c.GetAccounts(ctx, walletName)
+	if err != nil {
+		return nil, err
+	}
+	churns := make([]ChurnableOutput, 0)
+	for _, acct := range accts.SubaddressAccounts {
+		// skip this account index as its used for receiving churned funds
+		if acct.AccountIndex == churnAccountIndex {
+			continue
+		}
+		outputs, err := c.UnspentOutputs(ctx, walletName, acct.AccountIndex)
+		if err != nil {
+			return nil, err
+		}
+		if len(outputs) == 0 {
+			continue
+		}
+		addrs, err := c.GetAddress(ctx, walletName, acct.AccountIndex)
+		if err != nil {
+			return nil, err
+		}
+		subaddresses := make(map[uint64]string, len(addrs.Addresses))
+		for _, addr := range addrs.Addresses {
+			subaddresses[addr.AddressIndex] = addr.Address
+		}
+		for _, out := range outputs {
+			if out.Spent || out.Frozen || !out.Unlocked || out.KeyImage == "" || out.Amount < minAmount {
+				continue
+			}
+			churns = append(churns, ChurnableOutput{
+				AccountIndex: acct.AccountIndex,
+				AddressIndex: out.Subaddress.Minor,
+				Address:      subaddresses[out.Subaddress.Minor],
+				BaseAddress:  acct.BaseAddress,
+				KeyImage:     out.KeyImage,
+				Amount:       out.Amount,
+			})
+		}
+	}
+	return churns, nil
+}
+
+// Freeze marks the output with the given key image as frozen, so that the wallet will not spend it
+func (c *Client) Freeze(ctx context.Context, walletName, keyImage string) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
+	return c.withWallet(ctx, walletName, func(wallet.Client) error {
+		return c.rpc(ctx, "freeze", &requestKeyImage{KeyImage: keyImage}, &struct{}{})
+	})
+}
+
+// Thaw marks the output with the given key image as no longer frozen
+func (c *Client) Thaw(ctx context.Context, walletName, keyImage string) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
+	return c.withWallet(ctx, walletName, func(wallet.Client) error {
+		return c.rpc(ctx, "thaw", &requestKeyImage{KeyImage: keyImage}, &struct{}{})
+	})
+}
+
+// Frozen returns whether the output with the given key image is frozen
+func (c *Client) Frozen(ctx context.Context, walletName, keyImage string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	var resp ResponseFrozen
+	err := c.withWallet(ctx, walletName, func(wallet.Client) error {
+		return c.rpc(ctx, "frozen", &requestKeyImage{KeyImage: keyImage}, &resp)
+	})
+	return resp.Frozen, err
+}
+
+// rpc invokes a monero-wallet-rpc method directly, for methods the wallet package lacks or can
+// not decode. Must be called through withWallet, which classifies the errors returned
+func (c *Client) rpc(ctx context.Context, method string, in, out interface{}) error {
+	payload, err := json2.EncodeClientRequest(method, in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.addr, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{Transport: c.transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status %v", resp.StatusCode)
+	}
+	return json2.DecodeClientResponse(resp.Body, out)
+}
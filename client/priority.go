@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bonedaddy/mychurnero/random"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+// PriorityHighest is the most expensive transaction priority. monero-wallet-rpc accepts it
+// although the wallet package only defines priorities up to wallet.PriorityElevated
+const PriorityHighest = wallet.Priority(4)
+
+// names of each priority, as used by monero-wallet-cli
+var priorityNames = []string{"default", "unimportant", "normal", "elevated", "priority"}
+
+// ParsePriority parses a priority given by its name or number
+func ParsePriority(s string) (wallet.Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range priorityNames {
+		if s == name {
+			return wallet.Priority(i), nil
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n > uint64(PriorityHighest) {
+		return 0, fmt.Errorf("invalid priority %q, must be 0-%d or one of %s", s, PriorityHighest, strings.Join(priorityNames, ", "))
+	}
+	return wallet.Priority(n), nil
+}
+
+// PriorityPolicy chooses the priority transactions are created with
+type PriorityPolicy interface {
+	Priority(ctx context.Context) (wallet.Priority, error)
+}
+
+// FixedPriority is a PriorityPolicy always choosing the same priority
+type FixedPriority wallet.Priority
+
+// Priority returns the fixed priority
+func (fp FixedPriority) Priority(ctx context.Context) (wallet.Priority, error) {
+	return wallet.Priority(fp), nil
+}
+
+// PriorityWeights are the relative weights of choosing each priority, the entry at each
+// index being the weight of that priority. Missing entries have no weight
+type PriorityWeights []uint
+
+// DefaultPriorityWeights chooses evenly between the default, unimportant and normal priorities,
+// never choosing the elevated or highest priorities
+var DefaultPriorityWeights = PriorityWeights{1, 1, 1, 0, 0}
+
+// Validate returns an error if no priority can be chosen
+func (pw PriorityWeights) Validate() error {
+	if len(pw) > int(PriorityHighest)+1 {
+		return fmt.Errorf("%d priority weights given, but there are only %d priorities", len(pw), PriorityHighest+1)
+	}
+	for _, weight := range pw {
+		if weight > 0 {
+			return nil
+		}
+	}
+	return errors.New("at least one priority must have a weight")
+}
+
+// WeightedPriority is a PriorityPolicy choosing priorities at random by their weights.
+// A nil Rand draws from a cryptographically secure source
+type WeightedPriority struct {
+	Weights PriorityWeights
+	Rand    random.Source
+}
+
+// Priority returns a random priority
+func (wp WeightedPriority) Priority(ctx context.Context) (wallet.Priority, error) {
+	if err := wp.Weights.Validate(); err != nil {
+		return 0, err
+	}
+	src := wp.Rand
+	if src == nil {
+		src = random.NewSecure()
+	}
+	var total uint64
+	for _, weight := range wp.Weights {
+		total += uint64(weight)
+	}
+	n := uint64(src.Int63n(int64(total)))
+	for i, weight := range wp.Weights {
+		if n < uint64(weight) {
+			return wallet.Priority(i), nil
+		}
+		n -= uint64(weight)
+	}
+	return 0, errors.New("unreachable")
+}
+
+// NetworkPriority is a PriorityPolicy choosing the priority paid for by most transactions
+// in the daemon's transaction pool, so that our transactions do not stand out. Fallback
+// is used when the pool is empty
+type NetworkPriority struct {
+	Daemon   *Daemon
+	Fallback wallet.Priority
+}
+
+// Priority returns the most common priority of the transaction pool
+func (np NetworkPriority) Priority(ctx context.Context) (wallet.Priority, error) {
+	estimate, err := np.Daemon.FeeEstimate(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(estimate.Fees) == 0 {
+		return 0, errors.New("daemon does not report fees by priority")
+	}
+	pool, err := np.Daemon.TransactionPool(ctx)
+	if err != nil {
+		return 0, err
+	}
+	counts := make([]int, len(estimate.Fees))
+	for _, tx := range pool {
+		weight := tx.Weight
+		if weight == 0 {
+			weight = tx.BlobSize
+		}
+		if weight == 0 {
+			continue
+		}
+		counts[feeLevel(tx.Fee/weight, estimate.Fees)]++
+	}
+	best := -1
+	for level, count := range counts {
+		if count > 0 && (best < 0 || count > counts[best]) {
+			best = level
+		}
+	}
+	if best < 0 {
+		return np.Fallback, nil
+	}
+	// fee levels start at unimportant
+	return wallet.Priority(best + 1), nil
+}
+
+// feeLevel returns the index of the highest fee level that feePerByte pays for
+func feeLevel(feePerByte uint64, fees []uint64) int {
+	level := 0
+	for i, fee := range fees {
+		if feePerByte >= fee {
+			level = i
+		}
+	}
+	return level
+}
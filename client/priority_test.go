@@ -0,0 +1,97 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/random"
+	"github.com/bonedaddy/mychurnero/testenv/daemonrpc"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityPolicy(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Parse", func(t *testing.T) {
+		for input, want := range map[string]wallet.Priority{
+			"0": wallet.PriorityDefault, "default": wallet.PriorityDefault,
+			"Normal": wallet.PriorityNormal, "4": client.PriorityHighest, "priority": client.PriorityHighest,
+		} {
+			got, err := client.ParsePriority(input)
+			require.NoError(t, err)
+			require.Equal(t, want, got, input)
+		}
+		for _, input := range []string{"5", "-1", "fast", ""} {
+			_, err := client.ParsePriority(input)
+			require.Error(t, err, input)
+		}
+	})
+	t.Run("Fixed", func(t *testing.T) {
+		priority, err := client.FixedPriority(wallet.PriorityElevated).Priority(ctx)
+		require.NoError(t, err)
+		require.Equal(t, wallet.PriorityElevated, priority)
+	})
+	t.Run("Weighted", func(t *testing.T) {
+		require.Error(t, client.PriorityWeights{}.Validate())
+		require.Error(t, client.PriorityWeights{0, 0}.Validate())
+		require.Error(t, client.PriorityWeights{1, 1, 1, 1, 1, 1}.Validate())
+		_, err := client.WeightedPriority{}.Priority(ctx)
+		require.Error(t, err)
+
+		// every priority with a weight is chosen, including the highest
+		seen := make(map[wallet.Priority]int)
+		policy := client.WeightedPriority{Weights: client.PriorityWeights{0, 1, 0, 1, 2}}
+		for i := 0; i < 1000; i++ {
+			priority, err := policy.Priority(ctx)
+			require.NoError(t, err)
+			seen[priority]++
+		}
+		require.Len(t, seen, 3)
+		require.NotZero(t, seen[wallet.PriorityUnimportant])
+		require.NotZero(t, seen[wallet.PriorityElevated])
+		require.NotZero(t, seen[client.PriorityHighest])
+
+		// the same seed chooses the same priorities
+		first := client.WeightedPriority{Weights: policy.Weights, Rand: random.NewSeeded(1)}
+		second := client.WeightedPriority{Weights: policy.Weights, Rand: random.NewSeeded(1)}
+		for i := 0; i < 10; i++ {
+			want, err := first.Priority(ctx)
+			require.NoError(t, err)
+			got, err := second.Priority(ctx)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		}
+	})
+	t.Run("Network", func(t *testing.T) {
+		srv := daemonrpc.New()
+		t.Cleanup(srv.Close)
+		daemon, err := client.NewDaemon(srv.URL())
+		require.NoError(t, err)
+		policy := client.NetworkPriority{Daemon: daemon, Fallback: wallet.PriorityNormal}
+
+		// an empty pool uses the fallback
+		priority, err := policy.Priority(ctx)
+		require.NoError(t, err)
+		require.Equal(t, wallet.PriorityNormal, priority)
+
+		srv.SetFees([]uint64{20, 80, 320, 4000})
+		srv.AddPoolTx(20*1500, 1500)
+		srv.AddPoolTx(320*1500, 1500)
+		srv.AddPoolTx(330*2000, 2000)
+		srv.AddPoolTx(4000*1000, 1000)
+		priority, err = policy.Priority(ctx)
+		require.NoError(t, err)
+		require.Equal(t, wallet.PriorityElevated, priority)
+
+		srv.ClearPool()
+		srv.AddPoolTx(25*1500, 1500)
+		priority, err = policy.Priority(ctx)
+		require.NoError(t, err)
+		require.Equal(t, wallet.PriorityUnimportant, priority)
+
+		srv.SetFees(nil)
+		_, err = policy.Priority(ctx)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// WithProxy routes all rpc requests through the given proxy. Supported schemes are
+// socks5, socks5h and http(s). Hostnames are always resolved by socks proxies,
+// so a Tor socks port can be used to reach onion addresses without leaking DNS requests
+func WithProxy(proxyURL string) Option {
+	return func(o *options) {
+		o.proxy = proxyURL
+	}
+}
+
+// parseProxy validates the proxy url returning it in a form understood by http.Transport
+func parseProxy(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q", proxyURL)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "socks5", "socks5h":
+		// http.Transport resolves hostnames through the proxy for socks5,
+		// older go versions do not recognize socks5h
+		u.Scheme = "socks5"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	return u, nil
+}
+
+// isOnion returns whether or not the rpc address is a tor hidden service
+func isOnion(u *url.URL) bool {
+	return strings.HasSuffix(strings.ToLower(u.Hostname()), ".onion")
+}
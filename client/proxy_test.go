@@ -0,0 +1,177 @@
+package client_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/testenv/walletrpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientProxy(t *testing.T) {
+	ctx := context.Background()
+	srv := walletrpc.New()
+	t.Cleanup(srv.Close)
+	srv.AddWallet(testNetWallet)
+	srvURL, err := url.Parse(srv.URL())
+	require.NoError(t, err)
+
+	// onion addresses are resolved by the socks proxy to the wallet rpc server
+	socks := newSocksProxy(t, map[string]string{"walletrpc.onion:80": srvURL.Host})
+	onionAddr := "http://walletrpc.onion/json_rpc"
+
+	// never connect to an onion address directly
+	_, err = client.NewClient(onionAddr)
+	require.Error(t, err)
+
+	for _, scheme := range []string{"socks5", "socks5h"} {
+		cl, err := client.NewClient(onionAddr, client.WithProxy(scheme+"://"+socks.addr))
+		require.NoError(t, err)
+		require.NoError(t, cl.OpenWallet(ctx, testNetWallet))
+	}
+	require.Equal(t, []string{"walletrpc.onion:80", "walletrpc.onion:80"}, socks.requested())
+
+	// http proxies receive the full request
+	var (
+		mux  sync.Mutex
+		hits int
+	)
+	httpProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		hits++
+		mux.Unlock()
+		req, err := http.NewRequest(r.Method, r.URL.String(), r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		req.Header = r.Header
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(httpProxy.Close)
+	cl, err := client.NewClient(srv.URL(), client.WithProxy(httpProxy.URL))
+	require.NoError(t, err)
+	require.NoError(t, cl.OpenWallet(ctx, testNetWallet))
+	mux.Lock()
+	require.Equal(t, 1, hits)
+	mux.Unlock()
+
+	// an unreachable proxy is never bypassed
+	cl, err = client.NewClient(srv.URL(), client.WithProxy("socks5h://127.0.0.1:1"))
+	require.NoError(t, err)
+	require.Error(t, cl.OpenWallet(ctx, testNetWallet))
+
+	// invalid proxies are rejected
+	_, err = client.NewClient(srv.URL(), client.WithProxy("ftp://127.0.0.1:21"))
+	require.Error(t, err)
+	_, err = client.NewClient(srv.URL(), client.WithProxy("127.0.0.1:9050"))
+	require.Error(t, err)
+}
+
+// socksProxy is a minimal unauthenticated socks5 server supporting CONNECT
+type socksProxy struct {
+	addr   string
+	routes map[string]string
+
+	mux  sync.Mutex
+	reqs []string
+}
+
+func newSocksProxy(t *testing.T, routes map[string]string) *socksProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	sp := &socksProxy{addr: l.Addr().String(), routes: routes}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go sp.handle(conn)
+		}
+	}()
+	return sp
+}
+
+func (sp *socksProxy) requested() []string {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+	return append([]string(nil), sp.reqs...)
+}
+
+func (sp *socksProxy) handle(conn net.Conn) {
+	defer conn.Close()
+	// greeting: version, number of methods, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+	// request: version, command, reserved, address type
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return
+		}
+		name := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	sp.mux.Lock()
+	sp.reqs = append(sp.reqs, target)
+	sp.mux.Unlock()
+	if route, ok := sp.routes[target]; ok {
+		target = route
+	}
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		// host unreachable
+		conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultRingSize is the ring size required by consensus since hard fork version 15,
+// used when the hard fork version of the network is not known
+const DefaultRingSize = uint64(16)
+
+// ringSizes lists the ring size consensus requires from each hard fork version,
+// newest first. Since version 8 rings must be exactly this size
+var ringSizes = []struct {
+	version  uint
+	ringSize uint64
+}{
+	{version: 15, ringSize: 16},
+	{version: 8, ringSize: 11},
+	{version: 7, ringSize: 7},
+}
+
+// RingSizeForVersion returns the ring size required by consensus at the given hard fork version
+func RingSizeForVersion(version uint) (uint64, error) {
+	for _, rs := range ringSizes {
+		if version >= rs.version {
+			return rs.ringSize, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported hard fork version %d", version)
+}
+
+// CheckRingSize returns an error if ringSize would produce non-standard rings at the
+// given hard fork version. A version of 0 means the version is not known, in which
+// case any ring size that has been required by consensus is accepted
+func CheckRingSize(ringSize uint64, version uint) error {
+	if version == 0 {
+		for _, rs := range ringSizes {
+			if rs.ringSize == ringSize {
+				return nil
+			}
+		}
+		return fmt.Errorf("ring size %d is not a standard ring size", ringSize)
+	}
+	required, err := RingSizeForVersion(version)
+	if err != nil {
+		return err
+	}
+	if ringSize != required {
+		return fmt.Errorf("ring size %d is non-standard, hard fork version %d requires %d", ringSize, version, required)
+	}
+	return nil
+}
+
+// ResolveRingSize returns the ring size to create transactions with. When daemon is not nil the ring
+// size required at its hard fork version is used, and a non-zero ringSize that would produce
+// non-standard rings is rejected. Without a daemon ringSize is only checked to be one consensus
+// has required, defaulting to DefaultRingSize which the network may no longer accept, so callers
+// should warn when a ring size is neither configured nor required by a daemon
+func ResolveRingSize(ctx context.Context, daemon *Daemon, ringSize uint64) (uint64, error) {
+	if daemon == nil {
+		if ringSize == 0 {
+			return DefaultRingSize, nil
+		}
+		return ringSize, CheckRingSize(ringSize, 0)
+	}
+	info, err := daemon.HardForkInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if ringSize == 0 {
+		return RingSizeForVersion(info.Version)
+	}
+	return ringSize, CheckRingSize(ringSize, info.Version)
+}
+
+// WithRingSize sets the ring size used by transfers and sweeps that do not specify one.
+// Defaults to DefaultRingSize
+func WithRingSize(ringSize uint64) Option {
+	return func(opts *options) {
+		opts.ringSize = ringSize
+	}
+}
+
+// ring returns the ring size and mixin to use for a transfer
+func (c *Client) ring(opts TransferOpts) (ringSize, mixin uint64) {
+	ringSize = opts.RingSize
+	if ringSize == 0 {
+		ringSize = c.ringSize
+	}
+	if ringSize == 0 {
+		ringSize = DefaultRingSize
+	}
+	return ringSize, ringSize - 1
+}
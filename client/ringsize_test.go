@@ -0,0 +1,95 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/testenv/daemonrpc"
+	"github.com/bonedaddy/mychurnero/testenv/walletrpc"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingSize(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Versions", func(t *testing.T) {
+		for version, want := range map[uint]uint64{7: 7, 8: 11, 14: 11, 15: 16, 16: 16} {
+			got, err := client.RingSizeForVersion(version)
+			require.NoError(t, err)
+			require.Equal(t, want, got, version)
+		}
+		_, err := client.RingSizeForVersion(6)
+		require.Error(t, err)
+
+		require.NoError(t, client.CheckRingSize(16, 16))
+		require.Error(t, client.CheckRingSize(11, 16))
+		require.Error(t, client.CheckRingSize(16, 14))
+		// without a version any ring size consensus has required is accepted
+		require.NoError(t, client.CheckRingSize(11, 0))
+		require.Error(t, client.CheckRingSize(12, 0))
+	})
+	t.Run("Daemon", func(t *testing.T) {
+		srv := daemonrpc.New()
+		t.Cleanup(srv.Close)
+		daemon, err := client.NewDaemon(srv.URL())
+		require.NoError(t, err)
+
+		ringSize, err := client.ResolveRingSize(ctx, daemon, 0)
+		require.NoError(t, err)
+		require.Equal(t, uint64(16), ringSize)
+
+		srv.SetHardForkVersion(14)
+		ringSize, err = client.ResolveRingSize(ctx, daemon, 0)
+		require.NoError(t, err)
+		require.Equal(t, uint64(11), ringSize)
+		_, err = client.ResolveRingSize(ctx, daemon, 16)
+		require.Error(t, err)
+		ringSize, err = client.ResolveRingSize(ctx, nil, 0)
+		require.NoError(t, err)
+		require.Equal(t, client.DefaultRingSize, ringSize)
+
+		srv.SetStatus("BUSY")
+		_, err = client.ResolveRingSize(ctx, daemon, 0)
+		require.True(t, errors.Is(err, client.ErrDaemonBusy), err)
+	})
+	t.Run("Transfers", func(t *testing.T) {
+		srv := walletrpc.New()
+		t.Cleanup(srv.Close)
+		fw := srv.AddWallet(testNetWallet)
+		require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+		require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+		fw.MineBlocks(client.FakeUnlockBlocks)
+
+		// a client using a stale ring size has its transfers rejected
+		cl, err := client.NewClient(srv.URL(), client.WithRingSize(11))
+		require.NoError(t, err)
+		t.Cleanup(func() { cl.Close() })
+		addr, err := cl.NewAddress(ctx, testNetWallet, 0)
+		require.NoError(t, err)
+		opts := client.TransferOpts{
+			WalletName:   testNetWallet,
+			Destinations: map[string]uint64{addr: wallet.Float64ToXMR(0.1)},
+			Priority:     wallet.PriorityDefault,
+			DoNotRelay:   true,
+		}
+		_, err = cl.Transfer(ctx, opts)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid ring size 11")
+		_, err = cl.SweepAll(ctx, opts)
+		require.Error(t, err)
+
+		// the ring size of the transfer takes precedence over the client's
+		opts.RingSize = 16
+		_, err = cl.Transfer(ctx, opts)
+		require.NoError(t, err)
+
+		fw.RingSize = 11
+		_, err = cl.TransferSplit(ctx, opts)
+		require.Error(t, err)
+		opts.RingSize = 0
+		_, err = cl.TransferSplit(ctx, opts)
+		require.NoError(t, err)
+	})
+}
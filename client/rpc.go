@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+// WalletRPC defines the wallet operations needed to churn funds. It is satisfied
+// by Client which talks to a monero-wallet-rpc node, and by FakeWallet which
+// keeps all state in memory for testing
+type WalletRPC interface {
+	// OpenWallet opens the given wallet using it for all subsequent requests
+	OpenWallet(ctx context.Context, walletName string) error
+	// GetAccounts returns all accounts under the wallet
+	GetAccounts(ctx context.Context, walletName string) (*wallet.ResponseGetAccounts, error)
+	// GetAddress returns address information for a given account index optionally filtered by subaddress index
+	GetAddress(ctx context.Context, walletName string, accountIndex uint64, addressIndex ...uint64) (*wallet.ResponseGetAddress, error)
+	// AddressBalance returns the unlocked funds for the given address
+	AddressBalance(ctx context.Context, walletName string, address string, accountIndex uint64, addressIndex ...uint64) (uint64, error)
+	// NewAddress creates a new address under the given account index
+	NewAddress(ctx context.Context, walletName string, accountIndex uint64) (string, error)
+	// NewAccount creates a new account with an optional label
+	NewAccount(ctx context.Context, walletName, label string) (*wallet.ResponseCreateAccount, error)
+	// Transfer creates, and optionally relays a transaction
+	Transfer(ctx context.Context, opts TransferOpts) (*wallet.ResponseTransfer, error)
+	// TransferSplit is like Transfer but may split the transfer into multiple transactions
+	TransferSplit(ctx context.Context, opts TransferOpts) (*wallet.ResponseTransferSplit, error)
+	// SweepAll creates, and optionally relays transactions spending every unlocked output of an account,
+	// or of opts.SubaddrIndices
+	SweepAll(ctx context.Context, opts TransferOpts) (*wallet.ResponseSweepAll, error)
+	// EstimateFee returns the fee the wallet asks for spending every unlocked output of opts.SubaddrIndices
+	// to the destination of opts at opts.Priority, without creating a transaction
+	EstimateFee(ctx context.Context, opts TransferOpts) (uint64, error)
+	// SweepSingle creates, and optionally relays a transaction spending the single output opts.KeyImage
+	SweepSingle(ctx context.Context, opts TransferOpts) (*ResponseSweepSingle, error)
+	// Relay broadcasts a transaction created with DoNotRelay, returning its hash
+	Relay(ctx context.Context, walletName, txMetadata string) (string, error)
+	// GetChurnableAddresses returns addresses outside of the churn account that we can churn funds from
+	GetChurnableAddresses(ctx context.Context, walletName string, churnAccountIndex, minBalance uint64) (*ChurnableAccounts, error)
+	// GetHeight returns the height the wallet has synced to
+	GetHeight(ctx context.Context, walletName string) (uint64, error)
+	// UnspentOutputs returns the unspent outputs of an account along with their key images
+	UnspentOutputs(ctx context.Context, walletName string, accountIndex uint64) ([]Output, error)
+	// GetChurnableOutputs returns unlocked outputs outside of the churn account that we can churn funds from
+	GetChurnableOutputs(ctx context.Context, walletName string, churnAccountIndex, minAmount uint64) ([]ChurnableOutput, error)
+	// Freeze marks an output as frozen, so that the wallet will not spend it
+	Freeze(ctx context.Context, walletName, keyImage string) error
+	// Thaw marks an output as no longer frozen
+	Thaw(ctx context.Context, walletName, keyImage string) error
+	// TxStatus returns where the given transaction is in its lifecycle
+	TxStatus(ctx context.Context, walletName, txHash string) (*TxStatus, error)
+	// GetTransfers returns the outgoing transactions of an account that were relayed, whether
+	// pending, mined or failed
+	GetTransfers(ctx context.Context, walletName string, accountIndex uint64) (*wallet.ResponseGetTransfers, error)
+	// Close terminates the connection to the wallet
+	Close() error
+}
+
+var (
+	_ WalletRPC = (*Client)(nil)
+	_ WalletRPC = (*FakeWallet)(nil)
+)
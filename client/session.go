@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+// session tracks which wallet monero-wallet-rpc has open, as it can only have a single
+// wallet open at a time and opening one reloads its entire state
+type session struct {
+	mux    sync.Mutex
+	opened string
+	// set when monero-wallet-rpc was started with --wallet-file, in which case
+	// the wallet is always open and open_wallet is unavailable
+	fixed bool
+}
+
+// WithWalletFile is used when monero-wallet-rpc was started with --wallet-file rather than
+// --wallet-dir. The wallet it was started with is used for all requests, and is never opened or closed
+func WithWalletFile() Option {
+	return func(o *options) {
+		o.walletFile = true
+	}
+}
+
+// open opens walletName unless it is already open. Must be called with the session lock held
+func (c *Client) open(ctx context.Context, walletName string) error {
+	if c.session.fixed || c.session.opened == walletName {
+		return nil
+	}
+	c.session.opened = ""
+	if err := c.mw(ctx).OpenWallet(&wallet.RequestOpenWallet{Filename: walletName}); err != nil {
+		return wrapError(err)
+	}
+	c.session.opened = walletName
+	return nil
+}
+
+// withWallet calls fn with walletName open. Should monero-wallet-rpc report that no wallet
+// is open, for example because it was restarted, the wallet is reopened and fn called again
+func (c *Client) withWallet(ctx context.Context, walletName string, fn func(mw wallet.Client) error) error {
+	c.session.mux.Lock()
+	defer c.session.mux.Unlock()
+	if err := c.open(ctx, walletName); err != nil {
+		return err
+	}
+	err := wrapError(fn(c.mw(ctx)))
+	if c.session.fixed || !errors.Is(err, ErrWalletNotOpen) {
+		return err
+	}
+	c.session.opened = ""
+	if err := c.open(ctx, walletName); err != nil {
+		return err
+	}
+	return wrapError(fn(c.mw(ctx)))
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"errors"
+
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+// TxState is the stage of its lifecycle a relayed transaction is in
+type TxState int
+
+const (
+	// TxUnknown means the wallet has no record of the transaction
+	TxUnknown TxState = iota
+	// TxPending means the transaction is waiting in the transaction pool to be mined
+	TxPending
+	// TxConfirmed means the transaction has been mined
+	TxConfirmed
+	// TxFailed means the transaction was rejected, double spent or dropped from the pool.
+	// Its inputs are spendable again
+	TxFailed
+)
+
+func (s TxState) String() string {
+	switch s {
+	case TxPending:
+		return "pending"
+	case TxConfirmed:
+		return "confirmed"
+	case TxFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// TxStatus describes where a relayed transaction is in its lifecycle
+type TxStatus struct {
+	State TxState
+	// the number of blocks that have confirmed the transaction, 0 unless confirmed
+	Confirmations uint64
+	// the number of confirmations the wallet suggests waiting for
+	Threshold uint64
+	// the height of the block the transaction was mined in, 0 unless confirmed
+	Height uint64
+	// whether a transaction spending the same inputs has been seen, in which case
+	// a pending transaction will likely fail
+	DoubleSpendSeen bool
+}
+
+// Final returns whether the transaction has been confirmed by at least the suggested number of blocks
+func (ts *TxStatus) Final() bool {
+	return ts.State == TxConfirmed && ts.Confirmations >= ts.Threshold
+}
+
+// newTxStatus returns the status of a transfer returned by get_transfer_by_txid
+func newTxStatus(transfer *wallet.Transfer) *TxStatus {
+	status := &TxStatus{
+		Threshold:       transfer.SuggestedConfirmationsThreshold,
+		DoubleSpendSeen: transfer.DoubleSpendSeen,
+	}
+	switch transfer.Type {
+	case "pending", "pool":
+		status.State = TxPending
+	case "failed":
+		status.State = TxFailed
+	default:
+		status.State = TxConfirmed
+		status.Confirmations = transfer.Confirmations
+		status.Height = transfer.Height
+	}
+	return status
+}
+
+// txStatusError converts a transaction not found error into the unknown state
+func txStatusError(err error) (*TxStatus, error) {
+	if errors.Is(err, ErrTxNotFound) {
+		return &TxStatus{State: TxUnknown}, nil
+	}
+	return nil, err
+}
@@ -1,59 +1,108 @@
 package client
 
-import "github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+import (
+	"context"
+
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
 
 // WARNING: do not use these functions without care
 
 // SweepDust is used to sweep all unspendable amounts pre-ringCT
-func (c *Client) SweepDust(walletName string) (*wallet.ResponseSweepDust, error) {
-	if err := c.OpenWallet(walletName); err != nil {
-		return nil, err
-	}
-	return c.mw.SweepDust(&wallet.RequestSweepDust{GetTxHex: true, GetTxKeys: true})
+func (c *Client) SweepDust(ctx context.Context, walletName string) (*wallet.ResponseSweepDust, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
+	var resp *wallet.ResponseSweepDust
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.SweepDust(&wallet.RequestSweepDust{GetTxHex: true, GetTxKeys: true})
+		return err
+	})
+	return resp, err
 }
 
 // SweepAll is used to sweep all funds from the given account index sending it to the destination address
-func (c *Client) SweepAll(opts TransferOpts) (*wallet.ResponseSweepAll, error) {
-	if err := c.OpenWallet(opts.WalletName); err != nil {
-		return nil, err
-	}
+func (c *Client) SweepAll(ctx context.Context, opts TransferOpts) (*wallet.ResponseSweepAll, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
 	var addr string
 	for k := range opts.Destinations {
 		addr = k
 	}
-	return c.mw.SweepAll(&wallet.RequestSweepAll{
-		Address:        addr,
-		AccountIndex:   opts.AccountIndex,
-		SubaddrIndices: opts.SubaddrIndices,
-		Priority:       opts.Priority,
-		Mixin:          10,
-		RingSize:       11,
-		GetTxHex:       true,
-		GetTxKeys:      true,
-		GetTxMetadata:  true,
-		DoNotRelay:     opts.DoNotRelay,
+	ringSize, mixin := c.ring(opts)
+	var resp *wallet.ResponseSweepAll
+	err := c.withWallet(ctx, opts.WalletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.SweepAll(&wallet.RequestSweepAll{
+			Address:        addr,
+			AccountIndex:   opts.AccountIndex,
+			SubaddrIndices: opts.SubaddrIndices,
+			Priority:       opts.Priority,
+			Mixin:          mixin,
+			RingSize:       ringSize,
+			GetTxHex:       true,
+			GetTxKeys:      true,
+			GetTxMetadata:  true,
+			DoNotRelay:     opts.DoNotRelay,
+		})
+		return err
 	})
+	return resp, err
 }
 
-// SweepSingle is used to spend all of a specified unlocked output to an address
-func (c *Client) SweepSingle(opts TransferOpts) (*wallet.ResponseSweepSingle, error) {
-	if err := c.OpenWallet(opts.WalletName); err != nil {
-		return nil, err
+// EstimateFee returns the fee of sweeping the unlocked outputs of opts to its destination. The sweep is
+// created without being relayed and then discarded, as monero-wallet-rpc has no method to estimate fees
+func (c *Client) EstimateFee(ctx context.Context, opts TransferOpts) (uint64, error) {
+	opts.DoNotRelay = true
+	resp, err := c.SweepAll(ctx, opts)
+	if err != nil {
+		return 0, err
 	}
+	var fee uint64
+	for _, f := range resp.FeeList {
+		fee += f
+	}
+	return fee, nil
+}
+
+// ResponseSweepSingle is the response to sweep_single, describing the single transaction it creates.
+// The wallet package decodes it as lists of transactions like sweep_all, so it is not used
+type ResponseSweepSingle struct {
+	TxHash     string `json:"tx_hash"`
+	TxKey      string `json:"tx_key"`
+	Amount     uint64 `json:"amount"`
+	Fee        uint64 `json:"fee"`
+	TxBlob     string `json:"tx_blob"`
+	TxMetadata string `json:"tx_metadata"`
+}
+
+// SweepSingle is used to spend all of a specified unlocked output to an address
+func (c *Client) SweepSingle(ctx context.Context, opts TransferOpts) (*ResponseSweepSingle, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
 	var addr string
 	for k := range opts.Destinations {
 		addr = k
 	}
-	return c.mw.SweepSingle(&wallet.RequestSweepSingle{
-		Address:        addr,
-		AccountIndex:   opts.AccountIndex,
-		SubaddrIndices: opts.SubaddrIndices,
-		Priority:       opts.Priority,
-		Mixin:          10,
-		RingSize:       11,
-		GetTxHex:       true,
-		GetxKeys:       true,
-		GetTxMetadata:  true,
-		DoNotRelay:     opts.DoNotRelay,
+	ringSize, mixin := c.ring(opts)
+	var resp ResponseSweepSingle
+	err := c.withWallet(ctx, opts.WalletName, func(mw wallet.Client) error {
+		return c.rpc(ctx, "sweep_single", &wallet.RequestSweepSingle{
+			Address:        addr,
+			AccountIndex:   opts.AccountIndex,
+			SubaddrIndices: opts.SubaddrIndices,
+			Priority:       opts.Priority,
+			Mixin:          mixin,
+			RingSize:       ringSize,
+			GetTxHex:       true,
+			GetxKeys:       true,
+			KeyImage:       opts.KeyImage,
+			GetTxMetadata:  true,
+			DoNotRelay:     opts.DoNotRelay,
+		}, &resp)
 	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
 }
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+// Timeouts bounds how long each class of rpc call may take. A zero value
+// means calls of that class are only bounded by the context they are given
+type Timeouts struct {
+	// Scan applies to read only calls such as opening the wallet, and getting accounts, addresses and balances
+	Scan time.Duration
+	// Create applies to calls creating transactions, accounts, addresses and wallets
+	Create time.Duration
+	// Relay applies to relaying previously created transactions
+	Relay time.Duration
+	// Confirm applies to checking the confirmation status of transactions
+	Confirm time.Duration
+}
+
+// WithTimeouts sets the per operation class timeouts of the client
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(o *options) {
+		o.timeouts = timeouts
+	}
+}
+
+// contextTransport binds every request sent through it to a context, since
+// the underlying wallet client has no support for contexts
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (ct *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return ct.base.RoundTrip(req.WithContext(ct.ctx))
+}
+
+// mw returns a monero-wallet-rpc client whose requests are cancelled along with ctx
+func (c *Client) mw(ctx context.Context) wallet.Client {
+	return wallet.New(wallet.Config{
+		Address:   c.addr,
+		Transport: &contextTransport{ctx: ctx, base: c.transport},
+	})
+}
+
+// withTimeout derives a context that expires after timeout, unless timeout is 0
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
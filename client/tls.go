@@ -0,0 +1,111 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// TLSOptions configures https connections to monero-wallet-rpc
+type TLSOptions struct {
+	// path to a PEM encoded bundle of CA certificates used to verify the server,
+	// if empty the system roots are used
+	CACertPath string
+	// paths to a PEM encoded client certificate and key presented to the server
+	CertPath string
+	KeyPath  string
+	// hex encoded SHA-256 fingerprints of allowed server certificates. When set the
+	// server certificate must match one of these, and self-signed certificates such as
+	// those generated by monero-wallet-rpc --rpc-ssl autodetect are accepted
+	Fingerprints []string
+}
+
+// WithTLS configures the tls settings used for https rpc addresses
+func WithTLS(opts TLSOptions) Option {
+	return func(o *options) {
+		o.tls = &opts
+	}
+}
+
+// enabled returns whether or not any tls settings were given
+func (opts *TLSOptions) enabled() bool {
+	return opts != nil && (opts.CACertPath != "" || opts.CertPath != "" || opts.KeyPath != "" || len(opts.Fingerprints) > 0)
+}
+
+// config returns the tls configuration described by opts
+func (opts *TLSOptions) config() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CACertPath != "" {
+		data, err := ioutil.ReadFile(opts.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CACertPath)
+		}
+		cfg.RootCAs = pool
+	}
+	if opts.CertPath != "" || opts.KeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertPath, opts.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if len(opts.Fingerprints) > 0 {
+		pins := make(map[string]bool, len(opts.Fingerprints))
+		for _, fp := range opts.Fingerprints {
+			pin, err := normalizeFingerprint(fp)
+			if err != nil {
+				return nil, err
+			}
+			pins[pin] = true
+		}
+		// chain verification is skipped unless a CA bundle is given, in which case
+		// the certificate must both be trusted and pinned
+		verifyChain := cfg.RootCAs != nil
+		roots := cfg.RootCAs
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server presented no certificates")
+			}
+			leaf := cs.PeerCertificates[0]
+			sum := sha256.Sum256(leaf.Raw)
+			if !pins[hex.EncodeToString(sum[:])] {
+				return fmt.Errorf("server certificate fingerprint %s is not pinned", hex.EncodeToString(sum[:]))
+			}
+			if !verifyChain {
+				return nil
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range cs.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := leaf.Verify(x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Roots:         roots,
+				Intermediates: intermediates,
+			})
+			return err
+		}
+	}
+	return cfg, nil
+}
+
+// normalizeFingerprint lower cases a hex fingerprint removing any colons,
+// allowing fingerprints to be given as printed by openssl or monero-wallet-rpc
+func normalizeFingerprint(fp string) (string, error) {
+	fp = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+	decoded, err := hex.DecodeString(fp)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 certificate fingerprint %q", fp)
+	}
+	return fp, nil
+}
@@ -1,22 +1,11 @@
 package client
 
 import (
-	"math/rand"
+	"context"
 
 	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
 )
 
-const (
-
-	// mixing and ring size are hard coded as they are consensus defined
-	// eventually these will need to be changed when the network upgrades accordingly
-
-	// Mixing defines the number of outputs to include with ours in the ring
-	Mixing = uint64(10)
-	// RingSize defines the total number of outputs in the ring (N + 1)
-	RingSize = uint64(11)
-)
-
 // TransferOpts defines options used to control transfers
 // TODO(bonedaddy): support more than out destination address
 type TransferOpts struct {
@@ -27,29 +16,52 @@ type TransferOpts struct {
 	SubaddrIndices []uint64 // options, default is nil which means all
 	WalletName     string
 	DoNotRelay     bool
+	KeyImage       string // the output to spend when using SweepSingle
+	// total number of outputs in each ring, defaults to the ring size of the client
+	RingSize uint64
 }
 
-// TxConfirmed returns whether or not the given transaction is confirmed
-func (c *Client) TxConfirmed(walletName, txHash string) (bool, error) {
-	if err := c.OpenWallet(walletName); err != nil {
-		return false, err
-	}
-	resp, err := c.mw.GetTransferByTxID(&wallet.RequestGetTransferByTxID{TxID: txHash})
+// TxStatus returns where the given transaction is in its lifecycle. Transactions
+// the wallet has no record of are reported as TxUnknown rather than an error
+func (c *Client) TxStatus(ctx context.Context, walletName, txHash string) (*TxStatus, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Confirm)
+	defer cancel()
+	var resp *wallet.ResponseGetTransferByTxID
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.GetTransferByTxID(&wallet.RequestGetTransferByTxID{TxID: txHash})
+		return err
+	})
 	if err != nil {
-		return false, err
+		return txStatusError(err)
 	}
-	if resp.Transfer.Confirmations >= resp.Transfer.SuggestedConfirmationsThreshold {
-		return true, nil
-	}
-	return false, nil
+	return newTxStatus(&resp.Transfer), nil
+}
+
+// GetTransfers returns the outgoing transactions of an account that were relayed, whether
+// pending, mined or failed. Transactions in the pool are reported as pending
+func (c *Client) GetTransfers(ctx context.Context, walletName string, accountIndex uint64) (*wallet.ResponseGetTransfers, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	var resp *wallet.ResponseGetTransfers
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.GetTransfers(&wallet.RequestGetTransfers{
+			Out:          true,
+			Pending:      true,
+			Failed:       true,
+			AccountIndex: accountIndex,
+		})
+		return err
+	})
+	return resp, err
 }
 
 // TransferSplit allows splitting up a transaction into smaller one, useful
 // for situations where Transfer returns an error due to to large of a transaction
-func (c *Client) TransferSplit(opts TransferOpts) (*wallet.ResponseTransferSplit, error) {
-	if err := c.OpenWallet(opts.WalletName); err != nil {
-		return nil, err
-	}
+func (c *Client) TransferSplit(ctx context.Context, opts TransferOpts) (*wallet.ResponseTransferSplit, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
 
 	var destinations []*wallet.Destination
 
@@ -60,25 +72,31 @@ func (c *Client) TransferSplit(opts TransferOpts) (*wallet.ResponseTransferSplit
 		})
 	}
 
-	return c.mw.TransferSplit(&wallet.RequestTransferSplit{
-		Mixin:          10,
-		RingSize:       11,
-		Priority:       opts.Priority,
-		GetTxHex:       true,
-		GetxKeys:       true, // TODO: needs to change
-		GetTxMetadata:  true,
-		DoNotRelay:     opts.DoNotRelay,
-		AccountIndex:   opts.AccountIndex,
-		SubaddrIndices: opts.SubaddrIndices,
-		Destinations:   destinations,
+	ringSize, mixin := c.ring(opts)
+	var resp *wallet.ResponseTransferSplit
+	err := c.withWallet(ctx, opts.WalletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.TransferSplit(&wallet.RequestTransferSplit{
+			Mixin:          mixin,
+			RingSize:       ringSize,
+			Priority:       opts.Priority,
+			GetTxHex:       true,
+			GetxKeys:       true, // TODO: needs to change
+			GetTxMetadata:  true,
+			DoNotRelay:     opts.DoNotRelay,
+			AccountIndex:   opts.AccountIndex,
+			SubaddrIndices: opts.SubaddrIndices,
+			Destinations:   destinations,
+		})
+		return err
 	})
+	return resp, err
 }
 
 // Transfer is used to transfer funds from the given wallet to the destination address
-func (c *Client) Transfer(opts TransferOpts) (*wallet.ResponseTransfer, error) {
-	if err := c.OpenWallet(opts.WalletName); err != nil {
-		return nil, err
-	}
+func (c *Client) Transfer(ctx context.Context, opts TransferOpts) (*wallet.ResponseTransfer, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
 
 	var destinations []*wallet.Destination
 
@@ -89,35 +107,39 @@ func (c *Client) Transfer(opts TransferOpts) (*wallet.ResponseTransfer, error) {
 		})
 	}
 
-	return c.mw.Transfer(&wallet.RequestTransfer{
-		Mixing:         10, // TODO: needs to change
-		RingSize:       11,
-		Priority:       opts.Priority,
-		GetTxHex:       true,
-		GetTxKey:       true,
-		GetTxMetadata:  true,
-		DoNotRelay:     opts.DoNotRelay,
-		AccountIndex:   opts.AccountIndex,
-		SubaddrIndices: opts.SubaddrIndices,
-		Destinations:   destinations,
+	ringSize, mixin := c.ring(opts)
+	var resp *wallet.ResponseTransfer
+	err := c.withWallet(ctx, opts.WalletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.Transfer(&wallet.RequestTransfer{
+			Mixing:         mixin,
+			RingSize:       ringSize,
+			Priority:       opts.Priority,
+			GetTxHex:       true,
+			GetTxKey:       true,
+			GetTxMetadata:  true,
+			DoNotRelay:     opts.DoNotRelay,
+			AccountIndex:   opts.AccountIndex,
+			SubaddrIndices: opts.SubaddrIndices,
+			Destinations:   destinations,
+		})
+		return err
 	})
+	return resp, err
 }
 
 // Relay is used to relay an unbroadcasted transaction returning the tx hash
-func (c *Client) Relay(walletName, txMetadata string) (string, error) {
-	if err := c.OpenWallet(walletName); err != nil {
-		return "", err
-	}
-
-	resp, err := c.mw.RelayTx(&wallet.RequestRelayTx{Hex: txMetadata})
+func (c *Client) Relay(ctx context.Context, walletName, txMetadata string) (string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Relay)
+	defer cancel()
+	var resp *wallet.ResponseRelayTx
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.RelayTx(&wallet.RequestRelayTx{Hex: txMetadata})
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
 	return resp.TxHash, nil
 }
-
-// RandomPriority returns a random transaction priority
-// note that this can potentially become expensive
-func RandomPriority() wallet.Priority {
-	return wallet.Priority(rand.Int63n(3))
-}
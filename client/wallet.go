@@ -1,33 +1,74 @@
 package client
 
-import "github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+import (
+	"context"
 
-// CreateWallet is used to create a new monero wallet
-func (c *Client) CreateWallet(walletName string) error {
-	return c.mw.CreateWallet(&wallet.RequestCreateWallet{
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+// CreateWallet is used to create a new monero wallet, which is left open
+func (c *Client) CreateWallet(ctx context.Context, walletName string) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Create)
+	defer cancel()
+	c.session.mux.Lock()
+	defer c.session.mux.Unlock()
+	if err := c.mw(ctx).CreateWallet(&wallet.RequestCreateWallet{
 		Filename: walletName,
 		Language: "English",
-	})
+	}); err != nil {
+		return wrapError(err)
+	}
+	c.session.opened = walletName
+	return nil
 }
 
 // WalletBalance returns the entire unlocked balance of all accounts and subaddresses
-func (c *Client) WalletBalance(walletName string) (uint64, error) {
-	if err := c.OpenWallet(walletName); err != nil {
+func (c *Client) WalletBalance(ctx context.Context, walletName string) (uint64, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	var resp *wallet.ResponseGetBalance
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.GetBalance(&wallet.RequestGetBalance{AccountIndex: 0})
+		return err
+	})
+	if err != nil {
 		return 0, err
 	}
-	resp, err := c.mw.GetBalance(&wallet.RequestGetBalance{AccountIndex: 0})
+	return resp.UnlockedBalance, nil
+}
+
+// GetHeight returns the height the wallet has synced to
+func (c *Client) GetHeight(ctx context.Context, walletName string) (uint64, error) {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	var resp *wallet.ResponseGetHeight
+	err := c.withWallet(ctx, walletName, func(mw wallet.Client) error {
+		var err error
+		resp, err = mw.GetHeight()
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
-	return resp.UnlockedBalance, nil
+	return resp.Height, nil
 }
 
-// OpenWallet is used to open the given wallet using it for all subsequent RPC requests
-func (c *Client) OpenWallet(walletName string) error {
-	return c.mw.OpenWallet(&wallet.RequestOpenWallet{Filename: walletName})
+// OpenWallet is used to open the given wallet using it for all subsequent RPC requests.
+// Nothing is sent to monero-wallet-rpc if the wallet is already open
+func (c *Client) OpenWallet(ctx context.Context, walletName string) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	c.session.mux.Lock()
+	defer c.session.mux.Unlock()
+	return c.open(ctx, walletName)
 }
 
 // SaveWallet stores the state of the current actively opened wallet
-func (c *Client) SaveWallet() error {
-	return c.mw.Store()
+func (c *Client) SaveWallet(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, c.timeouts.Scan)
+	defer cancel()
+	c.session.mux.Lock()
+	defer c.session.mux.Unlock()
+	return wrapError(c.mw(ctx).Store())
 }
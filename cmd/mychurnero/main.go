@@ -1,14 +1,16 @@
 package main
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/bonedaddy/mychurnero/client"
 	"github.com/bonedaddy/mychurnero/config"
+	"github.com/bonedaddy/mychurnero/random"
 	"github.com/bonedaddy/mychurnero/service"
 	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
 	"github.com/urfave/cli/v2"
@@ -24,11 +26,11 @@ func main() {
 			Name:  "new-address",
 			Usage: "generate a new address under the account index",
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				addr, err := cl.NewAddress(c.String("wallet.name"), c.Uint64("account.index"))
+				addr, err := cl.NewAddress(c.Context, c.String("wallet.name"), c.Uint64("account.index"))
 				if err != nil {
 					return err
 				}
@@ -40,11 +42,11 @@ func main() {
 			Name:  "new-wallet",
 			Usage: "create a new monero wallet",
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				if err := cl.CreateWallet(c.String("wallet.name")); err != nil {
+				if err := cl.CreateWallet(c.Context, c.String("wallet.name")); err != nil {
 					return err
 				}
 				return cl.Close()
@@ -74,7 +76,7 @@ func main() {
 				if err != nil {
 					return err
 				}
-				srv, err := service.New(context.Background(), cfg)
+				srv, err := service.New(c.Context, cfg)
 				if err != nil {
 					return err
 				}
@@ -88,11 +90,28 @@ func main() {
 			Usage:   "returns all available churnable addresses",
 			Aliases: []string{"gca"},
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				resp, err := cl.GetChurnableAddresses(c.String("wallet.name"), c.Uint64("churn.index"), c.Uint64("minimum.churn"))
+				resp, err := cl.GetChurnableAddresses(c.Context, c.String("wallet.name"), c.Uint64("churn.index"), c.Uint64("minimum.churn"))
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%#v\n", resp)
+				return cl.Close()
+			},
+		},
+		&cli.Command{
+			Name:    "get-churnable-outputs",
+			Usage:   "returns all unlocked outputs that can be churned one at a time",
+			Aliases: []string{"gco"},
+			Action: func(c *cli.Context) error {
+				cl, err := newClient(c)
+				if err != nil {
+					return err
+				}
+				resp, err := cl.GetChurnableOutputs(c.Context, c.String("wallet.name"), c.Uint64("churn.index"), c.Uint64("minimum.churn"))
 				if err != nil {
 					return err
 				}
@@ -104,11 +123,11 @@ func main() {
 			Name:  "address-balance",
 			Usage: "retrieve balance for an address",
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				bal, err := cl.AddressBalance(c.String("wallet.name"), c.String("address"), c.Uint64("account.index"))
+				bal, err := cl.AddressBalance(c.Context, c.String("wallet.name"), c.String("address"), c.Uint64("account.index"))
 				if err != nil {
 					return err
 				}
@@ -120,11 +139,11 @@ func main() {
 			Name:  "get-addresses",
 			Usage: "returns all subaddresses underneath a given account index",
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				resp, err := cl.GetAddress(c.String("wallet.name"), c.Uint64("account.index"))
+				resp, err := cl.GetAddress(c.Context, c.String("wallet.name"), c.Uint64("account.index"))
 				if err != nil {
 					return err
 				}
@@ -140,11 +159,11 @@ func main() {
 			Name:  "get-all-accounts",
 			Usage: "return all known accounts, their indexes, and subaddresses",
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				resp, err := cl.GetAccounts(c.String("wallet.name"))
+				resp, err := cl.GetAccounts(c.Context, c.String("wallet.name"))
 				if err != nil {
 					return err
 				}
@@ -160,8 +179,13 @@ func main() {
 		&cli.Command{
 			Name:  "transfer",
 			Usage: "used to transfer funds to the given address",
+			Flags: []cli.Flag{priorityFlag},
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				priority, err := choosePriority(c)
+				if err != nil {
+					return err
+				}
+				cl, err := newTransferClient(c)
 				if err != nil {
 					return err
 				}
@@ -176,12 +200,12 @@ func main() {
 						indices = append(indices, indice)
 					}
 				}
-				resp, err := cl.Transfer(client.TransferOpts{
+				resp, err := cl.Transfer(c.Context, client.TransferOpts{
 					WalletName:     c.String("wallet.name"),
 					Destinations:   map[string]uint64{c.String("dest.address"): wallet.Float64ToXMR(c.Float64("value"))},
 					AccountIndex:   c.Uint64("account.index"),
 					SubaddrIndices: indices,
-					Priority:       client.RandomPriority(),
+					Priority:       priority,
 				})
 				if err != nil {
 					return err
@@ -194,11 +218,11 @@ func main() {
 			Name:  "rescan",
 			Usage: "rescan entire blockchain, potentially destructive",
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				if err := cl.Rescan(c.String("wallet.name")); err != nil {
+				if err := cl.Rescan(c.Context, c.String("wallet.name")); err != nil {
 					return err
 				}
 				return cl.Close()
@@ -208,11 +232,11 @@ func main() {
 			Name:  "refresh",
 			Usage: "refresh accounts, scanning for incoming transactions",
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				if err := cl.Refresh(c.String("wallet.name")); err != nil {
+				if err := cl.Refresh(c.Context, c.String("wallet.name")); err != nil {
 					return err
 				}
 				return cl.Close()
@@ -221,16 +245,21 @@ func main() {
 		&cli.Command{
 			Name:  "sweep-all",
 			Usage: "sweep all accounts, use with caution",
+			Flags: []cli.Flag{priorityFlag},
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				priority, err := choosePriority(c)
 				if err != nil {
 					return err
 				}
-				resp, err := cl.SweepAll(client.TransferOpts{
+				cl, err := newTransferClient(c)
+				if err != nil {
+					return err
+				}
+				resp, err := cl.SweepAll(c.Context, client.TransferOpts{
 					WalletName:   c.String("wallet.name"),
 					AccountIndex: c.Uint64("account.index"),
 					Destinations: map[string]uint64{c.String("dest.address"): wallet.Float64ToXMR(c.Float64("value"))},
-					Priority:     client.RandomPriority(),
+					Priority:     priority,
 				})
 				if err != nil {
 					return err
@@ -243,11 +272,11 @@ func main() {
 			Name:  "sweep-dust",
 			Usage: "sweeps all dust, use with caution",
 			Action: func(c *cli.Context) error {
-				cl, err := client.NewClient(c.String("wallet.rpc_address"))
+				cl, err := newClient(c)
 				if err != nil {
 					return err
 				}
-				resp, err := cl.SweepDust(c.String("wallet.name"))
+				resp, err := cl.SweepDust(c.Context, c.String("wallet.name"))
 				if err != nil {
 					return err
 				}
@@ -255,6 +284,164 @@ func main() {
 				return cl.Close()
 			},
 		},
+		&cli.Command{
+			Name:  "daemon",
+			Usage: "query the monerod given with --daemon.rpc_address",
+			Subcommands: cli.Commands{
+				&cli.Command{
+					Name:  "info",
+					Usage: "show the sync state and general information of the daemon",
+					Action: func(c *cli.Context) error {
+						daemon, err := requireDaemon(c)
+						if err != nil {
+							return err
+						}
+						info, err := daemon.Info(c.Context)
+						if err != nil {
+							return err
+						}
+						fmt.Println("height: ", info.Height)
+						fmt.Println("target height: ", info.TargetHeight)
+						fmt.Println("synchronized: ", info.Synced())
+						fmt.Println("network: ", info.Nettype)
+						fmt.Println("version: ", info.Version)
+						fmt.Println("pool size: ", info.TxPoolSize)
+						return nil
+					},
+				},
+				&cli.Command{
+					Name:  "height",
+					Usage: "show the height of the daemon's chain",
+					Action: func(c *cli.Context) error {
+						daemon, err := requireDaemon(c)
+						if err != nil {
+							return err
+						}
+						height, err := daemon.Height(c.Context)
+						if err != nil {
+							return err
+						}
+						fmt.Println("height: ", height)
+						return nil
+					},
+				},
+				&cli.Command{
+					Name:  "hard-fork-info",
+					Usage: "show the current hard fork version and the ring size it requires",
+					Action: func(c *cli.Context) error {
+						daemon, err := requireDaemon(c)
+						if err != nil {
+							return err
+						}
+						info, err := daemon.HardForkInfo(c.Context)
+						if err != nil {
+							return err
+						}
+						fmt.Println("version: ", info.Version)
+						ringSize, err := client.RingSizeForVersion(info.Version)
+						if err != nil {
+							return err
+						}
+						fmt.Println("ring size: ", ringSize)
+						return nil
+					},
+				},
+				&cli.Command{
+					Name:  "fee-estimate",
+					Usage: "show the fee per byte of each priority",
+					Action: func(c *cli.Context) error {
+						daemon, err := requireDaemon(c)
+						if err != nil {
+							return err
+						}
+						estimate, err := daemon.FeeEstimate(c.Context)
+						if err != nil {
+							return err
+						}
+						fmt.Println("fee: ", estimate.Fee)
+						for i, fee := range estimate.Fees {
+							fmt.Printf("priority %d: %d\n", i+1, fee)
+						}
+						return nil
+					},
+				},
+				&cli.Command{
+					Name:  "pool",
+					Usage: "list the transactions in the daemon's transaction pool",
+					Action: func(c *cli.Context) error {
+						daemon, err := requireDaemon(c)
+						if err != nil {
+							return err
+						}
+						pool, err := daemon.TransactionPool(c.Context)
+						if err != nil {
+							return err
+						}
+						for _, tx := range pool {
+							fmt.Println("tx hash: ", tx.IDHash)
+							fmt.Println("weight: ", tx.Weight)
+							fmt.Println("fee: ", tx.Fee)
+						}
+						return nil
+					},
+				},
+				&cli.Command{
+					Name:  "get-transactions",
+					Usage: "look up transactions given with --tx.hash",
+					Flags: []cli.Flag{
+						&cli.StringSliceFlag{
+							Name:  "tx.hash",
+							Usage: "hash of a transaction to look up, may be given multiple times",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						daemon, err := requireDaemon(c)
+						if err != nil {
+							return err
+						}
+						height, err := daemon.Height(c.Context)
+						if err != nil {
+							return err
+						}
+						txs, missed, err := daemon.Transactions(c.Context, c.StringSlice("tx.hash"))
+						if err != nil {
+							return err
+						}
+						for _, tx := range txs {
+							fmt.Println("tx hash: ", tx.TxHash)
+							fmt.Println("in pool: ", tx.InPool)
+							fmt.Println("confirmations: ", tx.Confirmations(height))
+						}
+						for _, txHash := range missed {
+							fmt.Println("not found: ", txHash)
+						}
+						return nil
+					},
+				},
+				&cli.Command{
+					Name:  "send-raw-transaction",
+					Usage: "submit the hex encoded transaction given with --tx.hex",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "tx.hex",
+							Usage:    "the hex encoded transaction",
+							Required: true,
+						},
+						&cli.BoolFlag{
+							Name:  "do_not_relay",
+							Usage: "keep the transaction in the daemon's pool without broadcasting it",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						daemon, err := requireDaemon(c)
+						if err != nil {
+							return err
+						}
+						return daemon.SendRawTransaction(c.Context, c.String("tx.hex"), c.Bool("do_not_relay"))
+					},
+				},
+			},
+		},
 		&cli.Command{
 			Name:  "mining",
 			Usage: "mining related commands",
@@ -263,11 +450,11 @@ func main() {
 					Name:  "start",
 					Usage: "start mining depositing funds into the given wallet",
 					Action: func(c *cli.Context) error {
-						cl, err := client.NewClient(c.String("wallet.rpc_address"))
+						cl, err := newClient(c)
 						if err != nil {
 							return err
 						}
-						if err := cl.StartMining(c.String("wallet.name"), c.Uint64("threads")); err != nil {
+						if err := cl.StartMining(c.Context, c.String("wallet.name"), c.Uint64("threads")); err != nil {
 							return err
 						}
 						return cl.Close()
@@ -284,15 +471,89 @@ func main() {
 					Name:  "stop",
 					Usage: "stop mining",
 					Action: func(c *cli.Context) error {
-						cl, err := client.NewClient(c.String("wallet.rpc_address"))
+						cl, err := newClient(c)
+						if err != nil {
+							return err
+						}
+						if err := cl.StopMining(c.Context, c.String("wallet.name")); err != nil {
+							return err
+						}
+						return cl.Close()
+					},
+				},
+			},
+		},
+		&cli.Command{
+			Name:  "frozen-outputs",
+			Usage: "list and manage frozen outputs",
+			Subcommands: cli.Commands{
+				&cli.Command{
+					Name:  "list",
+					Usage: "list the unspent outputs that are frozen",
+					Action: func(c *cli.Context) error {
+						cl, err := newClient(c)
+						if err != nil {
+							return err
+						}
+						accts, err := cl.GetAccounts(c.Context, c.String("wallet.name"))
+						if err != nil {
+							return err
+						}
+						for _, acct := range accts.SubaddressAccounts {
+							outputs, err := cl.UnspentOutputs(c.Context, c.String("wallet.name"), acct.AccountIndex)
+							if err != nil {
+								return err
+							}
+							for _, out := range outputs {
+								if out.Frozen {
+									fmt.Printf("%#v\n", out)
+								}
+							}
+						}
+						return cl.Close()
+					},
+				},
+				&cli.Command{
+					Name:  "freeze",
+					Usage: "freeze an output so the wallet will not spend it",
+					Action: func(c *cli.Context) error {
+						cl, err := newClient(c)
 						if err != nil {
 							return err
 						}
-						if err := cl.StopMining(c.String("wallet.name")); err != nil {
+						if err := cl.Freeze(c.Context, c.String("wallet.name"), c.String("key.image")); err != nil {
 							return err
 						}
 						return cl.Close()
 					},
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "key.image",
+							Usage:    "key image of the output",
+							Required: true,
+						},
+					},
+				},
+				&cli.Command{
+					Name:  "thaw",
+					Usage: "thaw a frozen output so the wallet can spend it again",
+					Action: func(c *cli.Context) error {
+						cl, err := newClient(c)
+						if err != nil {
+							return err
+						}
+						if err := cl.Thaw(c.Context, c.String("wallet.name"), c.String("key.image")); err != nil {
+							return err
+						}
+						return cl.Close()
+					},
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "key.image",
+							Usage:    "key image of the output",
+							Required: true,
+						},
+					},
 				},
 			},
 		},
@@ -315,6 +576,84 @@ func main() {
 			Usage:   "the endpoint address of the monero-wallet-rpc server",
 			Value:   "http://127.0.0.1:6061/json_rpc",
 		},
+		&cli.BoolFlag{
+			Name:  "wallet.rpc_wallet_file",
+			Usage: "set when monero-wallet-rpc was started with --wallet-file, the wallet name is then ignored",
+		},
+		&cli.StringFlag{
+			Name:    "wallet.rpc_username",
+			Aliases: []string{"wuser"},
+			Usage:   "the username given to monero-wallet-rpc with --rpc-login",
+			EnvVars: []string{"MYCHURNERO_RPC_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:    "wallet.rpc_password",
+			Aliases: []string{"wpass"},
+			Usage:   "the password given to monero-wallet-rpc with --rpc-login",
+			EnvVars: []string{"MYCHURNERO_RPC_PASSWORD"},
+		},
+		&cli.StringFlag{
+			Name:  "wallet.rpc_ca_cert",
+			Usage: "path to a PEM encoded CA bundle used to verify an https monero-wallet-rpc",
+		},
+		&cli.StringFlag{
+			Name:  "wallet.rpc_client_cert",
+			Usage: "path to a PEM encoded client certificate presented to monero-wallet-rpc",
+		},
+		&cli.StringFlag{
+			Name:  "wallet.rpc_client_key",
+			Usage: "path to the PEM encoded key of the client certificate",
+		},
+		&cli.StringSliceFlag{
+			Name:  "wallet.rpc_fingerprint",
+			Usage: "sha256 fingerprint of an allowed monero-wallet-rpc certificate, may be given multiple times",
+		},
+		&cli.StringFlag{
+			Name:    "proxy_url",
+			Aliases: []string{"proxy"},
+			Usage:   "socks5h:// or http:// proxy to send all rpc requests through, such as socks5h://127.0.0.1:9050 for tor",
+			EnvVars: []string{"MYCHURNERO_PROXY_URL"},
+		},
+		&cli.DurationFlag{
+			Name:  "wallet.rpc_timeout",
+			Usage: "how long to wait for monero-wallet-rpc to answer a request, 0 waits forever",
+			Value: time.Minute * 5,
+		},
+		&cli.StringFlag{
+			Name:    "daemon.rpc_address",
+			Usage:   "the address of the monerod used by monero-wallet-rpc, queried for the required ring size and by the daemon commands",
+			EnvVars: []string{"MYCHURNERO_DAEMON_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:    "daemon.rpc_username",
+			Usage:   "the username given to monerod with --rpc-login",
+			EnvVars: []string{"MYCHURNERO_DAEMON_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:    "daemon.rpc_password",
+			Usage:   "the password given to monerod with --rpc-login",
+			EnvVars: []string{"MYCHURNERO_DAEMON_PASSWORD"},
+		},
+		&cli.StringFlag{
+			Name:  "daemon.rpc_ca_cert",
+			Usage: "path to a PEM encoded CA bundle used to verify an https monerod",
+		},
+		&cli.StringFlag{
+			Name:  "daemon.rpc_client_cert",
+			Usage: "path to a PEM encoded client certificate presented to monerod",
+		},
+		&cli.StringFlag{
+			Name:  "daemon.rpc_client_key",
+			Usage: "path to the PEM encoded key of the monerod client certificate",
+		},
+		&cli.StringSliceFlag{
+			Name:  "daemon.rpc_fingerprint",
+			Usage: "sha256 fingerprint of an allowed monerod certificate, may be given multiple times",
+		},
+		&cli.Uint64Flag{
+			Name:  "ring_size",
+			Usage: "the number of outputs in each ring, 0 uses the ring size required by consensus",
+		},
 		&cli.StringFlag{
 			Name:    "dest.address",
 			Aliases: []string{"da"},
@@ -361,3 +700,116 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// newClient returns a monero-wallet-rpc client using the connection flags
+func newClient(c *cli.Context, extra ...client.Option) (*client.Client, error) {
+	opts := []client.Option{
+		client.WithDigestAuth(c.String("wallet.rpc_username"), c.String("wallet.rpc_password")),
+		client.WithTLS(client.TLSOptions{
+			CACertPath:   c.String("wallet.rpc_ca_cert"),
+			CertPath:     c.String("wallet.rpc_client_cert"),
+			KeyPath:      c.String("wallet.rpc_client_key"),
+			Fingerprints: c.StringSlice("wallet.rpc_fingerprint"),
+		}),
+		client.WithProxy(c.String("proxy_url")),
+		client.WithTimeouts(client.Timeouts{
+			Scan:    c.Duration("wallet.rpc_timeout"),
+			Create:  c.Duration("wallet.rpc_timeout"),
+			Relay:   c.Duration("wallet.rpc_timeout"),
+			Confirm: c.Duration("wallet.rpc_timeout"),
+		}),
+	}
+	if c.Bool("wallet.rpc_wallet_file") {
+		opts = append(opts, client.WithWalletFile())
+	}
+	return client.NewClient(c.String("wallet.rpc_address"), append(opts, extra...)...)
+}
+
+// newTransferClient is like newClient, for commands that create transactions. The ring size is
+// resolved here, so that only these commands query the daemon for its hard fork version
+func newTransferClient(c *cli.Context) (*client.Client, error) {
+	daemon, err := newDaemon(c)
+	if err != nil {
+		return nil, err
+	}
+	ringSize, err := client.ResolveRingSize(c.Context, daemon, c.Uint64("ring_size"))
+	if err != nil {
+		return nil, err
+	}
+	if daemon == nil && c.Uint64("ring_size") == 0 {
+		log.Printf("no --daemon.rpc_address given, assuming ring size %d which the network may no longer accept", ringSize)
+	}
+	return newClient(c, client.WithRingSize(ringSize))
+}
+
+// newDaemon returns a monerod client using the connection flags, or nil if no daemon address was given
+func newDaemon(c *cli.Context) (*client.Daemon, error) {
+	addr := c.String("daemon.rpc_address")
+	if addr == "" {
+		return nil, nil
+	}
+	return client.NewDaemon(addr,
+		client.WithDigestAuth(c.String("daemon.rpc_username"), c.String("daemon.rpc_password")),
+		client.WithTLS(client.TLSOptions{
+			CACertPath:   c.String("daemon.rpc_ca_cert"),
+			CertPath:     c.String("daemon.rpc_client_cert"),
+			KeyPath:      c.String("daemon.rpc_client_key"),
+			Fingerprints: c.StringSlice("daemon.rpc_fingerprint"),
+		}),
+		client.WithProxy(c.String("proxy_url")),
+		client.WithTimeouts(client.Timeouts{Scan: c.Duration("wallet.rpc_timeout")}),
+	)
+}
+
+// requireDaemon is like newDaemon, but fails if no daemon address was given
+func requireDaemon(c *cli.Context) (*client.Daemon, error) {
+	daemon, err := newDaemon(c)
+	if err != nil {
+		return nil, err
+	}
+	if daemon == nil {
+		return nil, errors.New("--daemon.rpc_address is required")
+	}
+	return daemon, nil
+}
+
+var priorityFlag = &cli.StringFlag{
+	Name:  "priority",
+	Usage: "transaction priority from 0-4 or its name such as normal, network to match the daemon's transaction pool, chosen by the configured priority policy if unset",
+}
+
+// choosePriority returns the priority given with --priority, or else the one chosen by the priority
+// policy of the config file, so that transactions sent by hand are indistinguishable from churns
+func choosePriority(c *cli.Context) (wallet.Priority, error) {
+	switch value := c.String("priority"); value {
+	case "":
+		cfg := config.DefaultConfig()
+		if _, err := os.Stat(c.String("config")); err == nil {
+			if cfg, err = config.Load(c.String("config")); err != nil {
+				return 0, err
+			}
+		}
+		daemon, err := newDaemon(c)
+		if err != nil {
+			return 0, err
+		}
+		if daemon == nil && cfg.DaemonAddress != "" {
+			if daemon, err = client.NewDaemon(cfg.DaemonAddress, service.DaemonOptions(cfg)...); err != nil {
+				return 0, err
+			}
+		}
+		policy, err := service.NewPriorityPolicy(cfg, daemon, random.NewSecure())
+		if err != nil {
+			return 0, err
+		}
+		return policy.Priority(c.Context)
+	case "network":
+		daemon, err := requireDaemon(c)
+		if err != nil {
+			return 0, err
+		}
+		return client.NetworkPriority{Daemon: daemon, Fallback: wallet.PriorityDefault}.Priority(c.Context)
+	default:
+		return client.ParsePriority(value)
+	}
+}
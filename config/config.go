@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"time"
@@ -17,17 +18,112 @@ type Config struct {
 	WalletName string
 	// the address of a monero-wallet-rpc node
 	RPCAddress string
-	LogPath    string
+	// set when monero-wallet-rpc was started with --wallet-file instead of --wallet-dir
+	// in which case WalletName is never opened or closed
+	RPCWalletFile bool
+	// the username and password given to monero-wallet-rpc with --rpc-login
+	// leave empty if monero-wallet-rpc was started with --disable-rpc-login
+	RPCUsername string
+	RPCPassword string
+	// path to a PEM encoded CA bundle used to verify an https RPCAddress
+	RPCCACert string
+	// paths to a PEM encoded client certificate and key presented to monero-wallet-rpc
+	RPCClientCert string
+	RPCClientKey  string
+	// SHA-256 fingerprints of the certificates monero-wallet-rpc is allowed to present
+	RPCCertFingerprints []string
+	// optional socks5h:// or http:// proxy that all RPC requests are sent through
+	// this is required when RPCAddress is an onion address
+	ProxyURL string
+	// optional address of the monerod that monero-wallet-rpc is connected to, for example
+	// http://127.0.0.1:18081. When set it is queried for the network's consensus rules
+	DaemonAddress string
+	// the username and password given to monerod with --rpc-login, the CA bundle used to verify
+	// an https DaemonAddress, the client certificate and key presented to monerod, and the
+	// SHA-256 fingerprints of the certificates it is allowed to present
+	DaemonUsername         string
+	DaemonPassword         string
+	DaemonCACert           string
+	DaemonClientCert       string
+	DaemonClientKey        string
+	DaemonCertFingerprints []string
+	// the number of outputs in each ring. Leave at 0 to use the ring size required by the
+	// daemon's hard fork version, or 16 when no daemon is configured. Ring sizes that
+	// consensus does not require are rejected
+	RingSize uint64
+	LogPath  string
 	// specifies the account index to use for receiving churned funds to
 	ChurnAccountIndex uint64
 	// defines the minimum balance an address must have to be churned from
 	MinChurnAmount uint64
+	// when set each unlocked output is churned on its own with sweep_single, rather than churning
+	// part of the balance of a subaddress, so that outputs received at a subaddress are never merged
+	ChurnOutputs bool
+	// funds are churned a random number of rounds between MinChurnRounds and MaxChurnRounds,
+	// being churned again from the churn account until they reach it. 0 is treated as 1
+	MinChurnRounds uint
+	MaxChurnRounds uint
+	// the number of blocks an output must have been in the chain before it is churned, so that funds
+	// are not spent as soon as they unlock. Each output waits a random number of blocks between
+	// MinOutputAge and MaxOutputAge, or MinOutputAge when MaxOutputAge is 0
+	MinOutputAge uint64
+	MaxOutputAge uint64
 	// specifies the minimum delay in minutes to use
 	MinDelayMinutes int64
 	// specifies the maximum delay in minutes to use for relaying a transaction after it is created
 	MaxDelayMinutes int64
+	// how the delay between the minimum and maximum is chosen, with second precision. "uniform"
+	// chooses any delay with equal probability. "exponential" adds delays with a mean of DelayMean
+	// to the minimum, and "lognormal" delays with a median of DelayMean and log standard deviation
+	// DelaySigma. "gamma" adds delays whose logarithm in seconds is gamma distributed with DelayShape
+	// and DelayRate, as decoy selection assumes of the age of spent outputs. Delays above the maximum
+	// are drawn again, and the median delay must be below it
+	DelayDistribution string
+	DelayMean         time.Duration
+	DelaySigma        float64
+	DelayShape        float64
+	DelayRate         float64
+	// when set only the intent to churn is stored when a transfer is scheduled, and the transaction
+	// is built moments before it is relayed so that its ring members are not as old as its delay
+	JustInTime bool
+	// prebuilt transactions whose metadata is older than MaxMetadataAge when they are relayed
+	// are discarded and rebuilt. An age of 0 disables it
+	MaxMetadataAge time.Duration
+	// transactions paying a fee above MaxFeePerTx, or above MaxFeeRatio of the amount sent,
+	// are discarded and rebuilt at a lower priority. A limit of 0 disables it, as both are by default
+	MaxFeePerTx uint64
+	MaxFeeRatio float64
+	// how the priority of each transaction is chosen. "fixed" always uses Priority, "weighted"
+	// chooses at random using PriorityWeights, the relative weight of each priority from
+	// 0 (default) to 4 (highest), and "network" matches the most common priority in the
+	// daemon's transaction pool, using Priority when the pool is empty. "network" requires DaemonAddress
+	PriorityPolicy  string
+	Priority        uint
+	PriorityWeights []uint
+	// the total fees that may be relayed within any rolling 24 hour or 30 day period.
+	// Transfers that would exceed either are held back until enough earlier fees have
+	// left the period. A budget of 0 disables it
+	DailyFeeBudget   uint64
+	MonthlyFeeBudget uint64
 	// how often we will check for churnable addresses
 	ScanInterval time.Duration
+	// how long wallet RPC calls may take before they are abandoned, by operation class
+	// scan covers reading accounts, addresses and balances, create covers creating transactions
+	// relay covers relaying them, and confirm covers checking their confirmation status
+	// a timeout of 0 disables it
+	ScanTimeout    time.Duration
+	CreateTimeout  time.Duration
+	RelayTimeout   time.Duration
+	ConfirmTimeout time.Duration
+	// wallet RPC calls that fail without reaching the wallet are attempted up to RetryMaxAttempts
+	// times, waiting a random backoff between RetryMinBackoff and RetryMaxBackoff that doubles each attempt
+	RetryMaxAttempts int
+	RetryMinBackoff  time.Duration
+	RetryMaxBackoff  time.Duration
+	// after BreakerThreshold consecutive failures to reach the wallet, scanning and relaying
+	// is paused for BreakerCooldown before trying again. A negative threshold disables this
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 // DefaultConfig returns a default configuration suitable for testing
@@ -39,9 +135,27 @@ func DefaultConfig() *Config {
 		LogPath:           "mychurnero.log",
 		ChurnAccountIndex: 1,
 		MinChurnAmount:    wallet.Float64ToXMR(0.1),
+		MinChurnRounds:    1,
+		MaxChurnRounds:    1,
 		MinDelayMinutes:   1,
 		MaxDelayMinutes:   10,
+		DelayDistribution: "uniform",
+		DelayMean:         time.Minute * 3,
+		DelaySigma:        1,
+		DelayShape:        MoneroDecoyShape,
+		DelayRate:         MoneroDecoyRate,
+		PriorityPolicy:    "weighted",
+		PriorityWeights:   []uint{1, 1, 1, 0, 0},
 		ScanInterval:      time.Minute,
+		ScanTimeout:       time.Minute,
+		CreateTimeout:     time.Minute * 5,
+		RelayTimeout:      time.Minute,
+		ConfirmTimeout:    time.Minute,
+		RetryMaxAttempts:  3,
+		RetryMinBackoff:   time.Second,
+		RetryMaxBackoff:   time.Minute,
+		BreakerThreshold:  5,
+		BreakerCooldown:   time.Minute,
 	}
 }
 
@@ -54,7 +168,38 @@ func Save(config *Config, path string) error {
 	return ioutil.WriteFile(path, data, os.FileMode(0640))
 }
 
-// Load returns a config object reading contents from path
+// ChurnRounds returns the range the number of rounds funds are churned for is chosen from,
+// or an error if it is invalid
+func (c *Config) ChurnRounds() (uint, uint, error) {
+	min, max := c.MinChurnRounds, c.MaxChurnRounds
+	if min == 0 {
+		min = 1
+	}
+	if max == 0 {
+		max = 1
+	}
+	if max < min {
+		return 0, 0, fmt.Errorf("maximum of %d churn rounds is below the minimum of %d", max, min)
+	}
+	return min, max, nil
+}
+
+// OutputAges returns the range the number of blocks an output must age before it is churned is
+// chosen from, or an error if it is invalid
+func (c *Config) OutputAges() (uint64, uint64, error) {
+	min, max := c.MinOutputAge, c.MaxOutputAge
+	if max == 0 {
+		max = min
+	}
+	if max < min {
+		return 0, 0, fmt.Errorf("maximum output age of %d blocks is below the minimum of %d", max, min)
+	}
+	return min, max, nil
+}
+
+// Load returns a config object reading contents from path, returning an error if the
+// delay distribution, churn rounds or output ages are invalid. Retry and circuit breaker
+// settings that are not set are given their defaults
 func Load(path string) (*Config, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -64,5 +209,40 @@ func Load(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	if _, err := cfg.Delays(); err != nil {
+		return nil, err
+	}
+	if _, _, err := cfg.ChurnRounds(); err != nil {
+		return nil, err
+	}
+	if _, _, err := cfg.OutputAges(); err != nil {
+		return nil, err
+	}
+	cfg.defaultRetries()
 	return &cfg, nil
 }
+
+// defaultRetries sets the retry and circuit breaker settings left at zero, as they are in configs
+// written before they existed, to their defaults. Without them a wallet that is down is retried
+// in a tight loop
+func (c *Config) defaultRetries() {
+	defaults := DefaultConfig()
+	if c.RetryMaxAttempts <= 0 {
+		c.RetryMaxAttempts = defaults.RetryMaxAttempts
+	}
+	if c.RetryMinBackoff <= 0 {
+		c.RetryMinBackoff = defaults.RetryMinBackoff
+	}
+	if c.RetryMaxBackoff <= 0 {
+		c.RetryMaxBackoff = defaults.RetryMaxBackoff
+	}
+	if c.RetryMaxBackoff < c.RetryMinBackoff {
+		c.RetryMaxBackoff = c.RetryMinBackoff
+	}
+	if c.BreakerThreshold == 0 {
+		c.BreakerThreshold = defaults.BreakerThreshold
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = defaults.BreakerCooldown
+	}
+}
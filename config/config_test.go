@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bonedaddy/mychurnero/random"
 	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
 	"github.com/stretchr/testify/require"
 )
@@ -42,3 +43,174 @@ func TestConfig(t *testing.T) {
 	require.Equal(t, cfg.ScanInterval, time.Minute)
 
 }
+
+func TestDelays(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(testPath)
+	})
+	src := random.NewSecure()
+	// every distribution stays within the bounds with second precision
+	for _, name := range []string{"uniform", "exponential", "lognormal"} {
+		cfg := DefaultConfig()
+		cfg.DelayDistribution = name
+		delays, err := cfg.Delays()
+		require.NoError(t, err, name)
+		var belowMean int
+		for i := 0; i < 1000; i++ {
+			delay := delays.Delay(src)
+			require.GreaterOrEqual(t, int64(delay), int64(time.Minute), name)
+			require.LessOrEqual(t, int64(delay), int64(10*time.Minute), name)
+			require.Zero(t, delay%time.Second, name)
+			if delay < time.Minute+cfg.DelayMean {
+				belowMean++
+			}
+		}
+		// none of the distributions draw delays almost always above or below the mean
+		require.True(t, belowMean > 100 && belowMean < 900, "%s: %d", name, belowMean)
+	}
+
+	// decoy selection spends outputs a day or more after they were received
+	cfg := DefaultConfig()
+	cfg.DelayDistribution = "gamma"
+	_, err := cfg.Delays()
+	require.Error(t, err)
+	cfg.MaxDelayMinutes = 60 * 24 * 30
+	delays, err := cfg.Delays()
+	require.NoError(t, err)
+	var total time.Duration
+	for i := 0; i < 1000; i++ {
+		delay := delays.Delay(src)
+		require.LessOrEqual(t, int64(delay), int64(30*24*time.Hour))
+		total += delay
+	}
+	require.Greater(t, int64(total/1000), int64(24*time.Hour))
+
+	for _, invalid := range []func(cfg *Config){
+		func(cfg *Config) { cfg.DelayDistribution = "normal" },
+		func(cfg *Config) { cfg.MaxDelayMinutes = 0 },
+		func(cfg *Config) { cfg.MinDelayMinutes = -1 },
+		func(cfg *Config) { cfg.DelayDistribution, cfg.DelayMean = "exponential", 0 },
+		func(cfg *Config) { cfg.DelayDistribution, cfg.DelayMean = "exponential", time.Hour },
+		func(cfg *Config) { cfg.DelayDistribution, cfg.DelaySigma = "lognormal", 0 },
+		func(cfg *Config) { cfg.DelayDistribution, cfg.DelayShape = "gamma", 0 },
+	} {
+		cfg := DefaultConfig()
+		invalid(cfg)
+		_, err := cfg.Delays()
+		require.Error(t, err)
+		// invalid delays are refused when the config is loaded
+		require.NoError(t, Save(cfg, testPath))
+		_, err = Load(testPath)
+		require.Error(t, err)
+	}
+
+	// configs saved before delay distributions were added are uniform
+	cfg = DefaultConfig()
+	cfg.DelayDistribution = ""
+	delays, err = cfg.Delays()
+	require.NoError(t, err)
+	require.Equal(t, UniformDelay{Min: time.Minute, Max: 10 * time.Minute}, delays)
+
+	// delays drawn from the same seed are the same
+	for _, name := range []string{"uniform", "exponential", "lognormal", "gamma"} {
+		cfg := DefaultConfig()
+		cfg.DelayDistribution = name
+		cfg.MaxDelayMinutes = 60 * 24 * 30
+		delays, err := cfg.Delays()
+		require.NoError(t, err)
+		first, second := random.NewSeeded(1), random.NewSeeded(1)
+		for i := 0; i < 10; i++ {
+			require.Equal(t, delays.Delay(first), delays.Delay(second), name)
+		}
+	}
+}
+
+func TestChurnRounds(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(testPath)
+	})
+	cfg := DefaultConfig()
+	min, max, err := cfg.ChurnRounds()
+	require.NoError(t, err)
+	require.Equal(t, uint(1), min)
+	require.Equal(t, uint(1), max)
+
+	// configs saved before rounds were added churn once
+	cfg.MinChurnRounds, cfg.MaxChurnRounds = 0, 0
+	min, max, err = cfg.ChurnRounds()
+	require.NoError(t, err)
+	require.Equal(t, uint(1), min)
+	require.Equal(t, uint(1), max)
+
+	cfg.MinChurnRounds, cfg.MaxChurnRounds = 3, 6
+	min, max, err = cfg.ChurnRounds()
+	require.NoError(t, err)
+	require.Equal(t, uint(3), min)
+	require.Equal(t, uint(6), max)
+
+	cfg.MaxChurnRounds = 2
+	_, _, err = cfg.ChurnRounds()
+	require.Error(t, err)
+	require.NoError(t, Save(cfg, testPath))
+	_, err = Load(testPath)
+	require.Error(t, err)
+}
+
+func TestOutputAges(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(testPath)
+	})
+	cfg := DefaultConfig()
+	min, max, err := cfg.OutputAges()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), min)
+	require.Equal(t, uint64(0), max)
+
+	// without a maximum every output waits the minimum
+	cfg.MinOutputAge = 20
+	min, max, err = cfg.OutputAges()
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), min)
+	require.Equal(t, uint64(20), max)
+
+	cfg.MaxOutputAge = 40
+	min, max, err = cfg.OutputAges()
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), min)
+	require.Equal(t, uint64(40), max)
+
+	cfg.MaxOutputAge = 10
+	_, _, err = cfg.OutputAges()
+	require.Error(t, err)
+	require.NoError(t, Save(cfg, testPath))
+	_, err = Load(testPath)
+	require.Error(t, err)
+}
+
+func TestRetryDefaults(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(testPath)
+	})
+	// configs written before retries were added leave them at zero
+	cfg := DefaultConfig()
+	cfg.RetryMaxAttempts, cfg.RetryMinBackoff, cfg.RetryMaxBackoff = 0, 0, 0
+	cfg.BreakerThreshold, cfg.BreakerCooldown = 0, 0
+	require.NoError(t, Save(cfg, testPath))
+	loaded, err := Load(testPath)
+	require.NoError(t, err)
+	defaults := DefaultConfig()
+	require.Equal(t, defaults.RetryMaxAttempts, loaded.RetryMaxAttempts)
+	require.Equal(t, defaults.RetryMinBackoff, loaded.RetryMinBackoff)
+	require.Equal(t, defaults.RetryMaxBackoff, loaded.RetryMaxBackoff)
+	require.Equal(t, defaults.BreakerThreshold, loaded.BreakerThreshold)
+	require.Equal(t, defaults.BreakerCooldown, loaded.BreakerCooldown)
+
+	// the breaker can still be disabled, and the maximum backoff is never below the minimum
+	cfg.BreakerThreshold = -1
+	cfg.RetryMinBackoff, cfg.RetryMaxBackoff = time.Minute, time.Second
+	require.NoError(t, Save(cfg, testPath))
+	loaded, err = Load(testPath)
+	require.NoError(t, err)
+	require.Equal(t, -1, loaded.BreakerThreshold)
+	require.Equal(t, time.Minute, loaded.RetryMaxBackoff)
+}
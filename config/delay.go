@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/random"
+)
+
+const (
+	// MoneroDecoyShape and MoneroDecoyRate are the parameters of the gamma distribution Monero's
+	// decoy selection draws the logarithm of output ages in seconds from, modelling when real
+	// outputs are spent
+	MoneroDecoyShape = 19.28
+	MoneroDecoyRate  = 1.61
+)
+
+// maxRedraws bounds how often a delay above the maximum is drawn again before the maximum is used
+const maxRedraws = 100
+
+// DelayDistribution chooses how long to wait before relaying a transaction
+type DelayDistribution interface {
+	Delay(src random.Source) time.Duration
+}
+
+// bounds limits delays to between min and max, drawing again any delay above max
+type bounds struct {
+	min, max time.Duration
+}
+
+// draw returns min plus a number of seconds returned by sample, rounded down to the second
+func (b bounds) draw(sample func() float64) time.Duration {
+	for i := 0; i < maxRedraws; i++ {
+		seconds := sample()
+		if math.IsNaN(seconds) || seconds < 0 || seconds > (b.max-b.min).Seconds() {
+			continue
+		}
+		return b.min + time.Duration(seconds)*time.Second
+	}
+	return b.max
+}
+
+// checkMedian returns an error unless at least half of the delays drawn fall below the maximum
+func (b bounds) checkMedian(median time.Duration) error {
+	if median > b.max-b.min {
+		return fmt.Errorf("median delay of %v is above the maximum of %v", b.min+median, b.max)
+	}
+	return nil
+}
+
+// UniformDelay is equally likely to choose any delay from Min to Max
+type UniformDelay struct {
+	Min, Max time.Duration
+}
+
+// Delay returns a random delay
+func (ud UniformDelay) Delay(src random.Source) time.Duration {
+	seconds := int64((ud.Max - ud.Min) / time.Second)
+	return ud.Min + time.Duration(src.Int63n(seconds+1))*time.Second
+}
+
+// ExponentialDelay adds exponentially distributed delays with the given Mean to Min, up to Max
+type ExponentialDelay struct {
+	Min, Max time.Duration
+	Mean     time.Duration
+}
+
+// Delay returns a random delay
+func (ed ExponentialDelay) Delay(src random.Source) time.Duration {
+	return bounds{ed.Min, ed.Max}.draw(func() float64 {
+		return src.ExpFloat64() * ed.Mean.Seconds()
+	})
+}
+
+// LogNormalDelay adds log-normally distributed delays with the given Median, and standard
+// deviation Sigma of their logarithm, to Min, up to Max
+type LogNormalDelay struct {
+	Min, Max time.Duration
+	Median   time.Duration
+	Sigma    float64
+}
+
+// Delay returns a random delay
+func (ld LogNormalDelay) Delay(src random.Source) time.Duration {
+	return bounds{ld.Min, ld.Max}.draw(func() float64 {
+		return ld.Median.Seconds() * math.Exp(ld.Sigma*src.NormFloat64())
+	})
+}
+
+// GammaDelay adds delays to Min, up to Max, whose logarithm in seconds is gamma distributed
+// with the given Shape and Rate. With MoneroDecoyShape and MoneroDecoyRate outputs are
+// spent at the ages decoy selection expects of them
+type GammaDelay struct {
+	Min, Max    time.Duration
+	Shape, Rate float64
+}
+
+// Delay returns a random delay
+func (gd GammaDelay) Delay(src random.Source) time.Duration {
+	return bounds{gd.Min, gd.Max}.draw(func() float64 {
+		return math.Exp(sampleGamma(src, gd.Shape) / gd.Rate)
+	})
+}
+
+// median returns the approximate median of the delays added to Min, using the Wilson-Hilferty
+// approximation of the median of the gamma distribution
+func (gd GammaDelay) median() time.Duration {
+	m := gd.Shape * math.Pow(1-1/(9*gd.Shape), 3) / gd.Rate
+	seconds := math.Exp(math.Max(m, 0))
+	if seconds > math.MaxInt64/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// sampleGamma draws from the gamma distribution with the given shape and a scale of 1,
+// using the method of Marsaglia and Tsang
+func sampleGamma(src random.Source, shape float64) float64 {
+	if shape < 1 {
+		// boost the shape above 1, correcting with a uniform power
+		return sampleGamma(src, shape+1) * math.Pow(src.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := src.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := src.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// Delays returns the configured delay distribution, or an error if its parameters are invalid
+func (c *Config) Delays() (DelayDistribution, error) {
+	b := bounds{
+		min: time.Duration(c.MinDelayMinutes) * time.Minute,
+		max: time.Duration(c.MaxDelayMinutes) * time.Minute,
+	}
+	if b.min < 0 || b.max < b.min {
+		return nil, fmt.Errorf("invalid delay range of %d to %d minutes", c.MinDelayMinutes, c.MaxDelayMinutes)
+	}
+	switch c.DelayDistribution {
+	case "", "uniform":
+		return UniformDelay{Min: b.min, Max: b.max}, nil
+	case "exponential":
+		if c.DelayMean <= 0 {
+			return nil, fmt.Errorf("exponential delays require a positive mean, got %v", c.DelayMean)
+		}
+		median := time.Duration(float64(c.DelayMean) * math.Ln2)
+		if err := b.checkMedian(median); err != nil {
+			return nil, err
+		}
+		return ExponentialDelay{Min: b.min, Max: b.max, Mean: c.DelayMean}, nil
+	case "lognormal":
+		if c.DelayMean <= 0 || c.DelaySigma <= 0 {
+			return nil, fmt.Errorf("log-normal delays require a positive median and sigma, got %v and %g", c.DelayMean, c.DelaySigma)
+		}
+		if err := b.checkMedian(c.DelayMean); err != nil {
+			return nil, err
+		}
+		return LogNormalDelay{Min: b.min, Max: b.max, Median: c.DelayMean, Sigma: c.DelaySigma}, nil
+	case "gamma":
+		if c.DelayShape <= 0 || c.DelayRate <= 0 {
+			return nil, fmt.Errorf("gamma delays require a positive shape and rate, got %g and %g", c.DelayShape, c.DelayRate)
+		}
+		gd := GammaDelay{Min: b.min, Max: b.max, Shape: c.DelayShape, Rate: c.DelayRate}
+		if err := b.checkMedian(gd.median()); err != nil {
+			return nil, err
+		}
+		return gd, nil
+	default:
+		return nil, fmt.Errorf("unknown delay distribution %q, must be one of uniform, exponential, lognormal or gamma", c.DelayDistribution)
+	}
+}
@@ -51,26 +51,86 @@ func (c *Client) Close() error {
 
 // Destroy is used to tear down tbales if they exist
 func (c *Client) Destroy() error {
-	return c.db.Migrator().DropTable(Address{}, Transfer{})
+	return c.db.Migrator().DropTable(Address{}, Transfer{}, FeeEntry{}, SpareAddress{}, ChurnRound{}, FrozenOutput{}, OutputAge{})
 }
 
-// Setup is used to create the existing tables
+// Setup is used to create the tables, or to add any missing tables and columns to
+// a database created by an earlier version
 func (c *Client) Setup() error {
-	return c.db.Migrator().CreateTable(&Address{}, &Transfer{})
+	migrator := c.db.Migrator()
+	for _, model := range []interface{}{&Address{}, &Transfer{}, &FeeEntry{}, &SpareAddress{}, &ChurnRound{}, &FrozenOutput{}, &OutputAge{}} {
+		if !migrator.HasTable(model) {
+			if err := migrator.CreateTable(model); err != nil {
+				return err
+			}
+		}
+	}
+	// columns added since the tables were first created
+	for _, column := range []string{"Fee", "State", "Destination", "Amount", "BuiltAt", "Round", "Target"} {
+		if !migrator.HasColumn(&Transfer{}, column) {
+			if err := migrator.AddColumn(&Transfer{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	for _, column := range []string{"State", "KeyImage"} {
+		if !migrator.HasColumn(&Address{}, column) {
+			if err := migrator.AddColumn(&Address{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	return c.migrateStates()
 }
 
-// AddAddress is used to store an address into the database, if a previous record with
-// this address exists it will be overwritten
+// migrateStates derives the state of rows written before states were recorded
+// from the scheduled flag and transaction hash that were used instead
+func (c *Client) migrateStates() error {
+	legacy := c.db.Migrator().HasColumn(&Address{}, "scheduled")
+	return c.db.Transaction(func(db *gorm.DB) error {
+		if legacy {
+			if err := db.Exec(
+				"UPDATE addresses SET state = ? WHERE (state IS NULL OR state = '') AND scheduled = 1",
+				AddressScheduled,
+			).Error; err != nil {
+				return err
+			}
+		}
+		if err := db.Exec(
+			"UPDATE addresses SET state = ? WHERE state IS NULL OR state = ''",
+			AddressDiscovered,
+		).Error; err != nil {
+			return err
+		}
+		return db.Exec(
+			"UPDATE transfers SET state = CASE WHEN tx_hash IS NULL OR tx_hash = '' THEN ? ELSE ? END WHERE state IS NULL OR state = ''",
+			TransferScheduled, TransferRelayed,
+		).Error
+	})
+}
+
+// AddAddress is used to store a discovered address into the database, if a previous record with
+// this address exists its balance is updated unless a transfer from it is in progress
 func (c *Client) AddAddress(walletName, address, baseAddress string, accountIndex, addressIndex, balance uint64) error {
+	return c.addAddress(walletName, address, baseAddress, "", accountIndex, addressIndex, balance)
+}
+
+// AddOutput is like AddAddress, but records a single output of the address to be churned on its own.
+// A previous record of the address is updated to churn this output instead
+func (c *Client) AddOutput(walletName, address, baseAddress, keyImage string, accountIndex, addressIndex, amount uint64) error {
+	return c.addAddress(walletName, address, baseAddress, keyImage, accountIndex, addressIndex, amount)
+}
+
+func (c *Client) addAddress(walletName, address, baseAddress, keyImage string, accountIndex, addressIndex, balance uint64) error {
 
 	// if this address already exists, update with latest balance as long as it is not scheduled
 	if addr, err := c.GetAddress(address); err == nil {
 		// if address has scheduled transaction skip it
-		if addr.Scheduled == 1 {
+		if addr.State != AddressDiscovered {
 			c.l.Warn("address already has scheduled transaction, try again later", zap.String("address", address))
 			return nil
 		}
-		return c.db.Model(addr).Update("balance", balance).Error
+		return c.db.Model(addr).Updates(map[string]interface{}{"balance": balance, "key_image": keyImage}).Error
 	}
 
 	return c.db.Create(&Address{
@@ -80,22 +140,28 @@ func (c *Client) AddAddress(walletName, address, baseAddress string, accountInde
 		BaseAddress:  baseAddress,
 		Address:      address,
 		Balance:      uint(balance),
+		KeyImage:     keyImage,
+		State:        AddressDiscovered,
 	}).Error
 }
 
-// SetScheduled marks an address as having a scheduled transaction
-func (c *Client) SetScheduled(address string, scheduled uint) error {
-	addr, err := c.GetAddress(address)
-	if err != nil {
-		return err
+// DeleteAddress removes an address that has no scheduled transaction, so that it is
+// no longer churned unless found again by a later scan
+func (c *Client) DeleteAddress(address string) error {
+	res := c.db.Where("address = ? AND state = ?", address, AddressDiscovered).Delete(&Address{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("address not found or scheduled")
 	}
-	return c.db.Model(addr).Update("scheduled", scheduled).Error
+	return nil
 }
 
-// GetUnscheduledAddresses returns all unscheduled addresses
+// GetUnscheduledAddresses returns all discovered addresses without a transfer in progress
 func (c *Client) GetUnscheduledAddresses() ([]Address, error) {
 	var addrs []Address
-	return addrs, c.db.Model(&Address{}).Where("scheduled = 0").Find(&addrs).Error
+	return addrs, c.db.Model(&Address{}).Where("state = ?", AddressDiscovered).Find(&addrs).Error
 }
 
 // GetAddress returns the given address if it exists
@@ -110,96 +176,348 @@ func (c *Client) GetAddresses() ([]Address, error) {
 	return addrs, c.db.Model(&Address{}).Find(&addrs).Error
 }
 
-// ScheduleTransaction is used to persist transaction metadata information to disk, marking the
-// associated address as being scheduled. This means anytime during startup, we can reschedule transactions
-// in case the program exists with pending transactions
-func (c *Client) ScheduleTransaction(sourceAddress, txMetadata, metadataHash string, sendTime time.Time) error {
+// BuildTransaction is used to persist the metadata and hash of a transaction created from sourceAddress
+// to destination, marking the address as scheduled. The transfer must be given a send time with
+// ScheduleTransaction. Storing the hash before relaying lets an interrupted relay be found in the wallet
+func (c *Client) BuildTransaction(sourceAddress, destination, txMetadata, metadataHash, txHash string, amount, fee uint64) error {
+	return c.addTransfer(&Transfer{
+		SourceAddress:  sourceAddress,
+		Destination:    destination,
+		Amount:         uint(amount),
+		TxMetadata:     txMetadata,
+		TxMetadataHash: metadataHash,
+		TxHash:         txHash,
+		BuiltAt:        time.Now(),
+		Fee:            uint(fee),
+		State:          TransferBuilt,
+	})
+}
+
+// PlanTransaction is like BuildTransaction, but only persists the intent to send amount from
+// sourceAddress to destination. The transaction is built with RebuildTransaction before it is
+// relayed. id identifies the transfer in place of a metadata hash
+func (c *Client) PlanTransaction(sourceAddress, destination, id string, amount uint64) error {
+	return c.addTransfer(&Transfer{
+		SourceAddress:  sourceAddress,
+		Destination:    destination,
+		Amount:         uint(amount),
+		TxMetadataHash: id,
+		State:          TransferBuilt,
+	})
+}
+
+// addTransfer stores a new transfer, marking its source address as scheduled
+func (c *Client) addTransfer(tx *Transfer) error {
 	return c.db.Transaction(func(db *gorm.DB) error {
 		var addr Address
 
 		// make sure address exists
-		if err := db.Model(&Address{}).Where("address = ?", sourceAddress).First(&addr).Error; err != nil {
+		if err := db.Model(&Address{}).Where("address = ?", tx.SourceAddress).First(&addr).Error; err != nil {
 			return err
 		}
 
-		if err := db.Model(addr).Update("scheduled", 1).Error; err != nil {
+		if err := db.Model(&addr).Update("state", AddressScheduled).Error; err != nil {
 			return err
 		}
 
-		return db.Create(&Transfer{
-			SourceAddress:  sourceAddress,
-			TxMetadata:     txMetadata,
-			TxMetadataHash: metadataHash,
-			SendTime:       sendTime,
-			Spent:          0,
-		}).Error
+		return db.Create(tx).Error
 	})
 }
 
-// DeleteTransaction is used to remove transaction data from our database
-// we do this once the transaction has been confirmed and to purge evidence of the churn
-func (c *Client) DeleteTransaction(sourceAddress, txHash, metaDataHash string) error {
-	tx, err := c.GetTransaction(sourceAddress, metaDataHash)
-	if err != nil {
+// RebuildTransaction replaces the metadata of a scheduled transfer with that of a newly built
+// transaction, for transfers that were planned or whose metadata has grown stale. The transfer
+// keeps its metadata hash, so that it is still identified by it
+func (c *Client) RebuildTransaction(sourceAddress, metaDataHash, txMetadata, txHash string, amount, fee uint64) error {
+	return c.db.Transaction(func(db *gorm.DB) error {
+		var tx Transfer
+		if err := db.Model(&Transfer{}).First(
+			&tx,
+			"source_address = ? AND tx_metadata_hash = ?",
+			sourceAddress, metaDataHash,
+		).Error; err != nil {
+			return err
+		}
+		if tx.State != TransferScheduled {
+			return fmt.Errorf("%w: transfer is %s, it can not be rebuilt", ErrInvalidTransition, tx.State)
+		}
+		_, err := transition(db, sourceAddress, metaDataHash, TransferScheduled, map[string]interface{}{
+			"tx_metadata": txMetadata,
+			"tx_hash":     txHash,
+			"amount":      amount,
+			"fee":         fee,
+			"built_at":    time.Now(),
+		})
 		return err
+	})
+}
+
+// ScheduleTransaction sets the time at which a built transfer will be relayed. It also moves
+// a scheduled transfer to a new time, and returns a transfer whose relay did not reach the
+// network to the schedule. This means anytime during startup, we can reschedule transactions
+// in case the program exits with pending transactions
+func (c *Client) ScheduleTransaction(sourceAddress, metaDataHash string, sendTime time.Time) error {
+	return c.transition(sourceAddress, metaDataHash, TransferScheduled, map[string]interface{}{"send_time": sendTime})
+}
+
+// StartRelay marks a scheduled transfer as being relayed, returning it. This must be
+// called before the transaction is given to the wallet to relay
+func (c *Client) StartRelay(sourceAddress, metaDataHash string) (*Transfer, error) {
+	if err := c.transition(sourceAddress, metaDataHash, TransferRelaying, nil); err != nil {
+		return nil, err
 	}
+	return c.GetTransaction(sourceAddress, metaDataHash)
+}
 
-	if tx.TxHash != txHash {
-		return errors.New("invalid transaction found")
+// SetRelayed sets the transaction hash of a transfer being relayed, marking it as relayed
+// and recording its fee in the fee ledger
+func (c *Client) SetRelayed(sourceAddress, metaDataHash, txHash string) error {
+	return c.db.Transaction(func(db *gorm.DB) error {
+		tx, err := transition(db, sourceAddress, metaDataHash, TransferRelayed, map[string]interface{}{"tx_hash": txHash})
+		if err != nil {
+			return err
+		}
+		return db.Create(&FeeEntry{Fee: tx.Fee, RelayedAt: time.Now()}).Error
+	})
+}
+
+// SetConfirmed marks a relayed transfer as mined, or a confirmed transfer whose block
+// was orphaned as relayed again when confirmed is false
+func (c *Client) SetConfirmed(sourceAddress, metaDataHash string, confirmed bool) error {
+	state := TransferConfirmed
+	if !confirmed {
+		state = TransferRelayed
 	}
+	return c.transition(sourceAddress, metaDataHash, state, nil)
+}
 
-	if err := c.db.Delete(tx).Error; err != nil {
-		return err
+// PurgeTransaction is used to remove a final transfer from our database, along with its source
+// address once no other transfer from it remains. We do this once the transaction has been
+// confirmed, to purge evidence of the churn. If the funds have not reached their target number
+// of rounds the round of the destination is recorded, so that it is churned again
+func (c *Client) PurgeTransaction(sourceAddress, metaDataHash string) error {
+	return c.db.Transaction(func(db *gorm.DB) error {
+		tx, err := transition(db, sourceAddress, metaDataHash, TransferPurged, nil)
+		if err != nil {
+			return err
+		}
+		// split transfers share a destination, which is recorded once
+		if tx.Destination != "" && tx.Round < tx.Target {
+			if err := db.Where(ChurnRound{Address: tx.Destination}).Attrs(
+				ChurnRound{Round: tx.Round, Target: tx.Target},
+			).FirstOrCreate(&ChurnRound{}).Error; err != nil {
+				return err
+			}
+		}
+		remaining, err := countTransfers(db, sourceAddress)
+		if err != nil || remaining > 0 {
+			return err
+		}
+		var addr Address
+		if err := db.Where("address = ?", sourceAddress).Limit(1).Find(&addr).Error; err != nil {
+			return err
+		}
+		// anything left at the source is settled, funds churned again are swept in full. A churned
+		// output may share its subaddress with others, whose round is dropped once none is left
+		if addr.KeyImage == "" {
+			if err := db.Unscoped().Where("address = ?", sourceAddress).Delete(&ChurnRound{}).Error; err != nil {
+				return err
+			}
+		}
+		return db.Where("address = ?", sourceAddress).Delete(&Address{}).Error
+	})
+}
+
+// SetRound sets the round a built transfer brings its funds to, and the number of rounds they are churned for
+func (c *Client) SetRound(sourceAddress, metaDataHash string, round, target uint64) error {
+	res := c.db.Model(&Transfer{}).Where(
+		"source_address = ? AND tx_metadata_hash = ? AND state = ?",
+		sourceAddress, metaDataHash, TransferBuilt,
+	).Updates(map[string]interface{}{"round": round, "target": target})
+	if res.Error != nil {
+		return res.Error
 	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: no built transfer to set the round of", ErrInvalidTransition)
+	}
+	return nil
+}
 
-	addr, err := c.GetAddress(sourceAddress)
-	if err != nil {
+// GetChurnRound returns the churn round of the funds at the given churn account subaddress
+func (c *Client) GetChurnRound(address string) (*ChurnRound, error) {
+	var round ChurnRound
+	return &round, c.db.First(&round, "address = ?", address).Error
+}
+
+// GetChurnRounds returns the churn rounds of all churn account subaddresses whose funds are not settled
+func (c *Client) GetChurnRounds() ([]ChurnRound, error) {
+	var rounds []ChurnRound
+	return rounds, c.db.Model(&ChurnRound{}).Find(&rounds).Error
+}
+
+// DeleteChurnRound removes the churn round of a churn account subaddress, settling any funds left there
+func (c *Client) DeleteChurnRound(address string) error {
+	return c.db.Unscoped().Where("address = ?", address).Delete(&ChurnRound{}).Error
+}
+
+// CancelTransaction removes a transfer that has not reached the network, and marks the
+// source address as unscheduled so that it may be churned again
+func (c *Client) CancelTransaction(sourceAddress, metaDataHash string) error {
+	return c.release(sourceAddress, metaDataHash, TransferCancelled)
+}
+
+// FailTransaction removes a transfer that was rejected by or dropped from the network, and
+// marks the source address as unscheduled so that it may be churned again
+func (c *Client) FailTransaction(sourceAddress, metaDataHash string) error {
+	return c.release(sourceAddress, metaDataHash, TransferFailed)
+}
+
+// release moves a transfer to a terminal state, and the source address back to discovered
+// once no other transfer from it remains
+func (c *Client) release(sourceAddress, metaDataHash string, state TransferState) error {
+	return c.db.Transaction(func(db *gorm.DB) error {
+		if _, err := transition(db, sourceAddress, metaDataHash, state, nil); err != nil {
+			return err
+		}
+		remaining, err := countTransfers(db, sourceAddress)
+		if err != nil || remaining > 0 {
+			return err
+		}
+		return db.Model(&Address{}).Where("address = ?", sourceAddress).Update("state", AddressDiscovered).Error
+	})
+}
+
+// ReleaseOrphanedAddresses marks scheduled addresses without any transfer as discovered, so that
+// they are churned again. It returns the number of addresses released
+func (c *Client) ReleaseOrphanedAddresses() (int64, error) {
+	res := c.db.Model(&Address{}).Where(
+		"state = ? AND address NOT IN (?)",
+		AddressScheduled, c.db.Model(&Transfer{}).Select("source_address"),
+	).Update("state", AddressDiscovered)
+	return res.RowsAffected, res.Error
+}
+
+// AddSpareAddress records an unused churn account subaddress, doing nothing if it is already recorded
+func (c *Client) AddSpareAddress(address string) error {
+	var count int64
+	if err := c.db.Model(&SpareAddress{}).Where("address = ?", address).Count(&count).Error; err != nil || count > 0 {
 		return err
 	}
+	return c.db.Create(&SpareAddress{Address: address}).Error
+}
 
-	return c.db.Delete(addr).Error
+// TakeSpareAddress removes and returns the oldest unused churn account subaddress,
+// or an empty string if there is none
+func (c *Client) TakeSpareAddress() (string, error) {
+	var spare SpareAddress
+	err := c.db.Transaction(func(db *gorm.DB) error {
+		if err := db.Order("id").First(&spare).Error; err != nil {
+			return err
+		}
+		return db.Unscoped().Delete(&spare).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return spare.Address, err
 }
 
-// AddTransaction is used to store a transaction that we need to relay
-func (c *Client) AddTransaction(sourceAddress, txMetadata, metaDataHash string, sendTime time.Time) error {
-	return c.db.Create(&Transfer{
-		SourceAddress:  sourceAddress,
-		TxMetadata:     txMetadata,
-		TxMetadataHash: metaDataHash,
-		SendTime:       sendTime,
-		Spent:          0,
-	}).Error
+// GetSpareAddresses returns all unused churn account subaddresses
+func (c *Client) GetSpareAddresses() ([]SpareAddress, error) {
+	var spares []SpareAddress
+	return spares, c.db.Model(&SpareAddress{}).Find(&spares).Error
 }
 
-// GetUnrelayedTransactions returns transactinos which have been scheduled
-// but not yet relayed
-func (c *Client) GetUnrelayedTransactions() ([]Transfer, error) {
-	var txs []Transfer
-	return txs, c.db.Model(&Transfer{}).Where(`tx_hash = ""`).Find(&txs).Error
+// AddFrozenOutput records an output frozen for churns from sourceAddress, doing nothing if it is already recorded
+func (c *Client) AddFrozenOutput(sourceAddress, keyImage string) error {
+	var count int64
+	if err := c.db.Model(&FrozenOutput{}).Where("key_image = ?", keyImage).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	return c.db.Create(&FrozenOutput{KeyImage: keyImage, SourceAddress: sourceAddress}).Error
 }
 
-// GetRelayedTransactions returns all currently relayed transactions
-func (c *Client) GetRelayedTransactions() ([]Transfer, error) {
-	var txs []Transfer
-	return txs, c.db.Model(&Transfer{}).Where(`tx_hash NOT NULL AND tx_hash != ""`).Find(&txs).Error
+// DeleteFrozenOutput forgets a thawed output
+func (c *Client) DeleteFrozenOutput(keyImage string) error {
+	return c.db.Unscoped().Where("key_image = ?", keyImage).Delete(&FrozenOutput{}).Error
 }
 
-// SetTxHash sets the transaction hash for the corresponding churn
-func (c *Client) SetTxHash(sourceAddress, metaDataHash, txHash string) error {
-	tx, err := c.GetTransaction(sourceAddress, metaDataHash)
-	if err != nil {
+// GetFrozenOutputs returns the outputs frozen for churns from sourceAddress, or from any address if empty
+func (c *Client) GetFrozenOutputs(sourceAddress string) ([]FrozenOutput, error) {
+	var outputs []FrozenOutput
+	query := c.db.Model(&FrozenOutput{})
+	if sourceAddress != "" {
+		query = query.Where("source_address = ?", sourceAddress)
+	}
+	return outputs, query.Find(&outputs).Error
+}
+
+// AddOutputAge records the age an output must reach before it is churned, doing nothing if it is already recorded
+func (c *Client) AddOutputAge(keyImage string, age uint64) error {
+	var count int64
+	if err := c.db.Model(&OutputAge{}).Where("key_image = ?", keyImage).Count(&count).Error; err != nil || count > 0 {
 		return err
 	}
-	return c.db.Model(tx).Update("tx_hash", txHash).Error
+	return c.db.Create(&OutputAge{KeyImage: keyImage, Age: uint(age)}).Error
 }
 
-// SetTxSpent sets the spent field on a transfer entry
-func (c *Client) SetTxSpent(sourceAddress, metaDataHash string, spent uint) error {
-	tx, err := c.GetTransaction(sourceAddress, metaDataHash)
-	if err != nil {
+// DeleteOutputAge forgets the age of a spent output
+func (c *Client) DeleteOutputAge(keyImage string) error {
+	return c.db.Unscoped().Where("key_image = ?", keyImage).Delete(&OutputAge{}).Error
+}
+
+// GetOutputAges returns the recorded ages of all outputs
+func (c *Client) GetOutputAges() ([]OutputAge, error) {
+	var ages []OutputAge
+	return ages, c.db.Model(&OutputAge{}).Find(&ages).Error
+}
+
+// transition moves a transfer to a new state in a database transaction
+func (c *Client) transition(sourceAddress, metaDataHash string, state TransferState, updates map[string]interface{}) error {
+	return c.db.Transaction(func(db *gorm.DB) error {
+		_, err := transition(db, sourceAddress, metaDataHash, state, updates)
 		return err
+	})
+}
+
+// transition moves a transfer to a new state applying any other updates, or deletes it if the
+// state is terminal. It returns the transfer as it was before the transition
+func transition(db *gorm.DB, sourceAddress, metaDataHash string, state TransferState, updates map[string]interface{}) (*Transfer, error) {
+	var tx Transfer
+	if err := db.Model(&Transfer{}).First(
+		&tx,
+		"source_address = ? AND tx_metadata_hash = ?",
+		sourceAddress, metaDataHash,
+	).Error; err != nil {
+		return nil, err
+	}
+	if err := checkTransition(tx.State, state); err != nil {
+		return nil, err
+	}
+	if state.terminal() {
+		return &tx, db.Delete(&tx).Error
+	}
+	if updates == nil {
+		updates = make(map[string]interface{})
 	}
-	return c.db.Model(tx).Update("spent", spent).Error
+	updates["state"] = state
+	return &tx, db.Model(&tx).Updates(updates).Error
+}
+
+// countTransfers returns the number of transfers from an address
+func countTransfers(db *gorm.DB, sourceAddress string) (int64, error) {
+	var count int64
+	return count, db.Model(&Transfer{}).Where("source_address = ?", sourceAddress).Count(&count).Error
+}
+
+// GetFeesSince returns the fee ledger entries of transfers relayed after since, oldest first
+func (c *Client) GetFeesSince(since time.Time) ([]FeeEntry, error) {
+	var fees []FeeEntry
+	return fees, c.db.Model(&FeeEntry{}).Where("relayed_at > ?", since).Order("relayed_at").Find(&fees).Error
+}
+
+// PruneFees permanently removes fee ledger entries of transfers relayed before the given time
+func (c *Client) PruneFees(before time.Time) error {
+	return c.db.Unscoped().Where("relayed_at < ?", before).Delete(&FeeEntry{}).Error
 }
 
 // GetTransaction returns the first matching transaction
@@ -214,8 +532,25 @@ func (c *Client) GetTransactions() ([]Transfer, error) {
 	return txs, c.db.Model(&Transfer{}).Find(&txs).Error
 }
 
-// GetSendableTransactions returns all transactions we can relay
+// GetTransactionsInState returns all transactions in any of the given states
+func (c *Client) GetTransactionsInState(states ...TransferState) ([]Transfer, error) {
+	var txs []Transfer
+	return txs, c.db.Model(&Transfer{}).Where("state IN ?", states).Find(&txs).Error
+}
+
+// GetUnrelayedTransactions returns transactions which have been scheduled
+// but not yet relayed
+func (c *Client) GetUnrelayedTransactions() ([]Transfer, error) {
+	return c.GetTransactionsInState(TransferScheduled)
+}
+
+// GetRelayedTransactions returns all relayed transactions that are not yet final
+func (c *Client) GetRelayedTransactions() ([]Transfer, error) {
+	return c.GetTransactionsInState(TransferRelayed, TransferConfirmed)
+}
+
+// GetSendableTransactions returns all transactions we can relay, ordered by send time
 func (c *Client) GetSendableTransactions() ([]Transfer, error) {
 	var txs []Transfer
-	return txs, c.db.Model(&Transfer{}).Where("send_time < ? AND spent = 0", time.Now()).Find(&txs).Error
+	return txs, c.db.Model(&Transfer{}).Where("send_time < ? AND state = ?", time.Now(), TransferScheduled).Order("send_time").Find(&txs).Error
 }
@@ -3,10 +3,12 @@ package db
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
 )
@@ -41,19 +43,19 @@ func TestAddress(t *testing.T) {
 		accountIndex uint64
 		addressIndex uint64
 		balance      uint64
-		schedule     uint
+		schedule     bool
 	}
 
 	tests := []struct {
 		name            string
 		args            args
 		wantBalance     uint64
-		wantSchedule    uint
+		wantState       AddressState
 		wantUnscheduled int
 	}{
-		{"1", args{walletName, address, baseAddress, 0, 0, 100, 0}, 100, 0, 1},
-		{"2", args{walletName, address, baseAddress, 0, 0, 200, 1}, 200, 0, 0},
-		{"3", args{walletName, address, baseAddress, 0, 0, 200, 1}, 200, 1, 0}, // trigger already scheduled case
+		{"1", args{walletName, address, baseAddress, 0, 0, 100, false}, 100, AddressDiscovered, 1},
+		{"2", args{walletName, address, baseAddress, 0, 0, 200, true}, 200, AddressDiscovered, 0},
+		{"3", args{walletName, address, baseAddress, 0, 0, 300, true}, 200, AddressScheduled, 0}, // trigger already scheduled case
 	}
 
 	for _, tt := range tests {
@@ -72,14 +74,14 @@ func TestAddress(t *testing.T) {
 			require.Equal(t, int(addr.Balance), int(tt.wantBalance))
 			require.Equal(t, addr.Address, address)
 			require.Equal(t, addr.WalletName, walletName)
-			require.Equal(t, addr.Scheduled, tt.wantSchedule)
+			require.Equal(t, tt.wantState, addr.State)
 
-			err = db.SetScheduled(address, tt.args.schedule)
-			require.NoError(t, err)
-
-			addr, err = db.GetAddress(tt.args.address)
-			require.NoError(t, err)
-			require.Equal(t, int(addr.Scheduled), int(tt.args.schedule))
+			if tt.args.schedule {
+				require.NoError(t, db.BuildTransaction(address, "", "meta"+tt.name, "hash"+tt.name, "", 0, 0))
+				addr, err = db.GetAddress(tt.args.address)
+				require.NoError(t, err)
+				require.Equal(t, AddressScheduled, addr.State)
+			}
 
 			// now add address to trigger scheduled case handling
 			require.NoError(t, db.AddAddress(
@@ -91,15 +93,39 @@ func TestAddress(t *testing.T) {
 				tt.args.balance,
 			))
 
-			// TODO(bonedaddy): add better unscheduled address testing
 			addrs, err := db.GetUnscheduledAddresses()
-			if tt.wantSchedule > 0 {
-				require.NoError(t, err)
-			}
+			require.NoError(t, err)
 			require.Len(t, addrs, int(tt.wantUnscheduled))
 		})
 	}
 
+	// scheduled addresses can not be deleted, and are only unscheduled once every transfer is cancelled
+	require.Error(t, db.DeleteAddress(address))
+	require.NoError(t, db.CancelTransaction(address, "hash2"))
+	require.Error(t, db.DeleteAddress(address))
+	require.NoError(t, db.CancelTransaction(address, "hash3"))
+	require.NoError(t, db.DeleteAddress(address))
+	require.Error(t, db.DeleteAddress(address))
+	addrs, err := db.GetAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 0)
+
+	// an address churned one output at a time records the output, until churned by balance again
+	require.NoError(t, db.AddOutput(walletName, address, baseAddress, "keyimage", 0, 0, 50))
+	addr, err := db.GetAddress(address)
+	require.NoError(t, err)
+	require.Equal(t, "keyimage", addr.KeyImage)
+	require.Equal(t, uint(50), addr.Balance)
+	require.NoError(t, db.AddOutput(walletName, address, baseAddress, "other", 0, 0, 60))
+	addr, err = db.GetAddress(address)
+	require.NoError(t, err)
+	require.Equal(t, "other", addr.KeyImage)
+	require.Equal(t, uint(60), addr.Balance)
+	require.NoError(t, db.AddAddress(walletName, address, baseAddress, 0, 0, 100))
+	addr, err = db.GetAddress(address)
+	require.NoError(t, err)
+	require.Empty(t, addr.KeyImage)
+	require.Equal(t, uint(100), addr.Balance)
 }
 
 func TestTransaction(t *testing.T) {
@@ -122,36 +148,40 @@ func TestTransaction(t *testing.T) {
 		sender   string
 		metadata string
 		sendTime time.Time
-		spent    uint
+		relay    bool
 	}
 	tests := []struct {
 		name         string
 		args         args
-		wantErr      bool // not yet used but left for future use
 		wantTxCount  int
 		wantSendable int
 	}{
-		{"1", args{"1", "1", time.Now().AddDate(0, 0, -1), 0}, false, 1, 1},
-		{"2", args{"2", "2", time.Now().Add(time.Hour), 1}, false, 2, 1},
-		{"3", args{"3", "3", time.Now().Add(time.Hour * 10), 1}, false, 3, 1},
-		{"4", args{"4", "4", time.Now().AddDate(0, 0, -2), 0}, false, 4, 2},
-		{"5", args{"5", "5", time.Now().AddDate(0, 0, -3), 0}, false, 5, 3},
+		{"1", args{"1", "1", time.Now().AddDate(0, 0, -1), false}, 1, 1},
+		{"2", args{"2", "2", time.Now().Add(time.Hour), true}, 2, 1},
+		{"3", args{"3", "3", time.Now().Add(time.Hour * 10), false}, 3, 1},
+		{"4", args{"4", "4", time.Now().AddDate(0, 0, -2), true}, 4, 1},
+		{"5", args{"5", "5", time.Now().AddDate(0, 0, -3), false}, 5, 2},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			metaHashB := sha256.Sum256([]byte(tt.args.metadata))
 			metaHash := hex.EncodeToString(metaHashB[:])
-			err := db.AddTransaction(tt.args.sender, tt.args.metadata, metaHash, tt.args.sendTime)
-			require.NoError(t, err)
-
-			err = db.SetTxSpent(tt.args.sender, metaHash, tt.args.spent)
-			require.NoError(t, err)
+			require.NoError(t, db.AddAddress(walletName, tt.args.sender, baseAddress, 0, 0, 100))
+			require.NoError(t, db.BuildTransaction(tt.args.sender, "", tt.args.metadata, metaHash, "", 0, 0))
+			require.NoError(t, db.ScheduleTransaction(tt.args.sender, metaHash, tt.args.sendTime))
+			wantState := TransferScheduled
+			if tt.args.relay {
+				_, err := db.StartRelay(tt.args.sender, metaHash)
+				require.NoError(t, err)
+				require.NoError(t, db.SetRelayed(tt.args.sender, metaHash, "txhash"+tt.name))
+				wantState = TransferRelayed
+			}
 
 			tx, err := db.GetTransaction(tt.args.sender, metaHash)
 			require.NoError(t, err)
 			require.Equal(t, tx.TxMetadata, tt.args.metadata)
 			require.Equal(t, tx.TxMetadataHash, metaHash)
-			require.Equal(t, int(tx.Spent), int(tt.args.spent))
+			require.Equal(t, wantState, tx.State)
 			require.True(t, tx.SendTime.Equal(tt.args.sendTime))
 
 			txs, err := db.GetTransactions()
@@ -159,10 +189,316 @@ func TestTransaction(t *testing.T) {
 			require.Len(t, txs, tt.wantTxCount)
 
 			sendable, err := db.GetSendableTransactions()
-			if tt.wantSendable > 0 { // otherwise for no found txs this will be an error
-				require.NoError(t, err)
-			}
+			require.NoError(t, err)
 			require.Len(t, sendable, tt.wantSendable)
 		})
 	}
 }
+
+func TestTransferStates(t *testing.T) {
+	db, err := NewClient(zaptest.NewLogger(t), dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Destroy())
+		require.NoError(t, db.Close())
+		os.RemoveAll(dbPath)
+	})
+	require.NoError(t, db.Setup())
+	require.NoError(t, db.AddAddress(walletName, address, baseAddress, 0, 0, 100))
+	state := func(metaHash string) TransferState {
+		tx, err := db.GetTransaction(address, metaHash)
+		require.NoError(t, err)
+		return tx.State
+	}
+	invalid := func(err error) {
+		require.True(t, errors.Is(err, ErrInvalidTransition), err)
+	}
+
+	// transfers must be scheduled before being relayed
+	require.Error(t, db.BuildTransaction("unknown", "", "meta", "hash", "", 0, 0))
+	require.NoError(t, db.BuildTransaction(address, "dest", "meta", "hash", "txhash", 0, 0))
+	require.Equal(t, TransferBuilt, state("hash"))
+	_, err = db.StartRelay(address, "hash")
+	invalid(err)
+	invalid(db.SetRelayed(address, "hash", "txhash"))
+	invalid(db.SetRound(address, "unknown", 1, 2))
+	require.NoError(t, db.SetRound(address, "hash", 1, 2))
+	require.NoError(t, db.ScheduleTransaction(address, "hash", time.Now()))
+	require.NoError(t, db.ScheduleTransaction(address, "hash", time.Now()))
+	invalid(db.SetRound(address, "hash", 2, 2))
+
+	// a relay that did not reach the network returns to the schedule
+	tx, err := db.StartRelay(address, "hash")
+	require.NoError(t, err)
+	require.Equal(t, "meta", tx.TxMetadata)
+	require.Equal(t, "dest", tx.Destination)
+	require.Equal(t, "txhash", tx.TxHash)
+	require.Equal(t, TransferRelaying, state("hash"))
+	_, err = db.StartRelay(address, "hash")
+	invalid(err)
+	require.NoError(t, db.ScheduleTransaction(address, "hash", time.Now()))
+	_, err = db.StartRelay(address, "hash")
+	require.NoError(t, err)
+	require.NoError(t, db.SetRelayed(address, "hash", "txhash"))
+	require.Equal(t, TransferRelayed, state("hash"))
+	invalid(db.CancelTransaction(address, "hash"))
+	invalid(db.ScheduleTransaction(address, "hash", time.Now()))
+	invalid(db.PurgeTransaction(address, "hash"))
+
+	// orphaned blocks return a transfer to the pool
+	require.NoError(t, db.SetConfirmed(address, "hash", true))
+	require.Equal(t, TransferConfirmed, state("hash"))
+	require.NoError(t, db.SetConfirmed(address, "hash", false))
+	require.Equal(t, TransferRelayed, state("hash"))
+	require.NoError(t, db.SetConfirmed(address, "hash", true))
+
+	// a planned transfer is built once scheduled, keeping its id
+	require.NoError(t, db.PlanTransaction(address, "dest", "planned", 50))
+	tx, err = db.GetTransaction(address, "planned")
+	require.NoError(t, err)
+	require.Empty(t, tx.TxMetadata)
+	require.True(t, tx.BuiltAt.IsZero())
+	invalid(db.RebuildTransaction(address, "planned", "meta3", "txhash3", 40, 5))
+	require.NoError(t, db.ScheduleTransaction(address, "planned", time.Now()))
+	require.NoError(t, db.RebuildTransaction(address, "planned", "meta3", "txhash3", 40, 5))
+	tx, err = db.GetTransaction(address, "planned")
+	require.NoError(t, err)
+	require.Equal(t, "meta3", tx.TxMetadata)
+	require.Equal(t, "txhash3", tx.TxHash)
+	require.Equal(t, uint(40), tx.Amount)
+	require.Equal(t, uint(5), tx.Fee)
+	require.False(t, tx.BuiltAt.IsZero())
+	require.Equal(t, TransferScheduled, state("planned"))
+	_, err = db.StartRelay(address, "planned")
+	require.NoError(t, err)
+	invalid(db.RebuildTransaction(address, "planned", "meta4", "txhash4", 40, 5))
+	require.NoError(t, db.CancelTransaction(address, "planned"))
+
+	// a failed transfer releases its address while another is in progress
+	require.NoError(t, db.BuildTransaction(address, "", "meta2", "hash2", "", 0, 0))
+	require.NoError(t, db.ScheduleTransaction(address, "hash2", time.Now()))
+	_, err = db.StartRelay(address, "hash2")
+	require.NoError(t, err)
+	require.NoError(t, db.FailTransaction(address, "hash2"))
+	addr, err := db.GetAddress(address)
+	require.NoError(t, err)
+	require.Equal(t, AddressScheduled, addr.State)
+
+	// purging the last transfer removes the address, settling its funds, while
+	// funds short of their target number of rounds are churned again
+	require.NoError(t, db.db.Create(&ChurnRound{Address: address, Round: 1, Target: 1}).Error)
+	require.NoError(t, db.PurgeTransaction(address, "hash"))
+	_, err = db.GetAddress(address)
+	require.Error(t, err)
+	rounds, err := db.GetChurnRounds()
+	require.NoError(t, err)
+	require.Len(t, rounds, 1)
+	require.Equal(t, "dest", rounds[0].Address)
+	require.Equal(t, uint(1), rounds[0].Round)
+	require.Equal(t, uint(2), rounds[0].Target)
+	txs, err := db.GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 0)
+
+	// a churned output keeps the round of its subaddress for the outputs left there
+	require.NoError(t, db.AddOutput(walletName, "dest", baseAddress, "keyimage", 0, 1, 100))
+	require.NoError(t, db.BuildTransaction("dest", "", "meta6", "hash6", "", 0, 0))
+	require.NoError(t, db.ScheduleTransaction("dest", "hash6", time.Now()))
+	_, err = db.StartRelay("dest", "hash6")
+	require.NoError(t, err)
+	require.NoError(t, db.SetRelayed("dest", "hash6", "txhash6"))
+	require.NoError(t, db.SetConfirmed("dest", "hash6", true))
+	require.NoError(t, db.PurgeTransaction("dest", "hash6"))
+	_, err = db.GetAddress("dest")
+	require.Error(t, err)
+	rounds, err = db.GetChurnRounds()
+	require.NoError(t, err)
+	require.Len(t, rounds, 1)
+	require.NoError(t, db.DeleteChurnRound("dest"))
+	rounds, err = db.GetChurnRounds()
+	require.NoError(t, err)
+	require.Len(t, rounds, 0)
+}
+
+func TestReconcile(t *testing.T) {
+	db, err := NewClient(zaptest.NewLogger(t), dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Destroy())
+		require.NoError(t, db.Close())
+		os.RemoveAll(dbPath)
+	})
+	require.NoError(t, db.Setup())
+
+	// a scheduled address whose transfers were lost is released
+	require.NoError(t, db.AddAddress(walletName, address, baseAddress, 0, 0, 100))
+	require.NoError(t, db.AddAddress(walletName, "orphan", baseAddress, 0, 1, 100))
+	require.NoError(t, db.BuildTransaction(address, "", "meta", "hash", "", 0, 0))
+	require.NoError(t, db.db.Model(&Address{}).Where("address = ?", "orphan").Update("state", AddressScheduled).Error)
+	released, err := db.ReleaseOrphanedAddresses()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), released)
+	addrs, err := db.GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	require.Equal(t, "orphan", addrs[0].Address)
+
+	// spare addresses are handed out oldest first, once each
+	spare, err := db.TakeSpareAddress()
+	require.NoError(t, err)
+	require.Empty(t, spare)
+	require.NoError(t, db.AddSpareAddress("spare1"))
+	require.NoError(t, db.AddSpareAddress("spare2"))
+	require.NoError(t, db.AddSpareAddress("spare1"))
+	spares, err := db.GetSpareAddresses()
+	require.NoError(t, err)
+	require.Len(t, spares, 2)
+	for _, want := range []string{"spare1", "spare2", ""} {
+		spare, err := db.TakeSpareAddress()
+		require.NoError(t, err)
+		require.Equal(t, want, spare)
+	}
+	require.NoError(t, db.AddSpareAddress("spare1"))
+	spare, err = db.TakeSpareAddress()
+	require.NoError(t, err)
+	require.Equal(t, "spare1", spare)
+
+	// outputs frozen for churns are recorded once each, by source address
+	require.NoError(t, db.AddFrozenOutput(address, "keyimage1"))
+	require.NoError(t, db.AddFrozenOutput(address, "keyimage2"))
+	require.NoError(t, db.AddFrozenOutput(address, "keyimage1"))
+	require.NoError(t, db.AddFrozenOutput("orphan", "keyimage3"))
+	frozen, err := db.GetFrozenOutputs(address)
+	require.NoError(t, err)
+	require.Len(t, frozen, 2)
+	frozen, err = db.GetFrozenOutputs("")
+	require.NoError(t, err)
+	require.Len(t, frozen, 3)
+	require.NoError(t, db.DeleteFrozenOutput("keyimage1"))
+	frozen, err = db.GetFrozenOutputs(address)
+	require.NoError(t, err)
+	require.Len(t, frozen, 1)
+	require.Equal(t, "keyimage2", frozen[0].KeyImage)
+	require.NoError(t, db.AddFrozenOutput(address, "keyimage1"))
+
+	// the age an output must reach is recorded once, when it is first seen
+	require.NoError(t, db.AddOutputAge("keyimage1", 20))
+	require.NoError(t, db.AddOutputAge("keyimage2", 30))
+	require.NoError(t, db.AddOutputAge("keyimage1", 40))
+	ages, err := db.GetOutputAges()
+	require.NoError(t, err)
+	require.Len(t, ages, 2)
+	for _, age := range ages {
+		if age.KeyImage == "keyimage1" {
+			require.Equal(t, uint(20), age.Age)
+		}
+	}
+	require.NoError(t, db.DeleteOutputAge("keyimage1"))
+	ages, err = db.GetOutputAges()
+	require.NoError(t, err)
+	require.Len(t, ages, 1)
+	require.Equal(t, "keyimage2", ages[0].KeyImage)
+}
+
+// legacyTransfer is the transfers table as created before fees were recorded
+type legacyTransfer struct {
+	gorm.Model
+	SourceAddress  string
+	TxMetadata     string
+	TxMetadataHash string
+	TxHash         string
+	SendTime       time.Time
+	Spent          uint
+}
+
+func (legacyTransfer) TableName() string { return "transfers" }
+
+// legacyAddress is the addresses table as created before states were recorded
+type legacyAddress struct {
+	gorm.Model
+	WalletName   string
+	AccountIndex uint
+	AddressIndex uint
+	BaseAddress  string
+	Address      string `gorm:"unique"`
+	Balance      uint
+	Scheduled    uint
+	Spent        uint
+}
+
+func (legacyAddress) TableName() string { return "addresses" }
+
+func TestFeeLedger(t *testing.T) {
+	db, err := NewClient(zaptest.NewLogger(t), dbPath)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Destroy())
+		require.NoError(t, db.Close())
+		os.RemoveAll(dbPath)
+	})
+	require.NoError(t, db.Setup())
+	// setting up an existing database must succeed, as happens on every restart
+	require.NoError(t, db.Setup())
+	// databases created before fees and states were recorded are upgraded
+	require.NoError(t, db.db.Migrator().DropTable(&Address{}, &Transfer{}, &FeeEntry{}))
+	require.NoError(t, db.db.Migrator().CreateTable(&legacyAddress{}, &legacyTransfer{}))
+	require.NoError(t, db.db.Create(&legacyAddress{Address: "legacy-scheduled", Scheduled: 1}).Error)
+	require.NoError(t, db.db.Create(&legacyAddress{Address: "legacy-discovered"}).Error)
+	require.NoError(t, db.db.Create(&legacyTransfer{SourceAddress: "legacy-scheduled", TxMetadataHash: "unrelayed"}).Error)
+	require.NoError(t, db.db.Create(&legacyTransfer{SourceAddress: "legacy-scheduled", TxMetadataHash: "relayed", TxHash: "txhash", Spent: 1}).Error)
+	require.False(t, db.db.Migrator().HasColumn(&Transfer{}, "Fee"))
+	require.NoError(t, db.Setup())
+	require.True(t, db.db.Migrator().HasColumn(&Transfer{}, "Fee"))
+	addrs, err := db.GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	require.Equal(t, "legacy-discovered", addrs[0].Address)
+	unrelayed, err := db.GetUnrelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, unrelayed, 1)
+	require.Equal(t, "unrelayed", unrelayed[0].TxMetadataHash)
+	relayed, err := db.GetRelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, relayed, 1)
+	require.Equal(t, "txhash", relayed[0].TxHash)
+
+	start := time.Now()
+	require.NoError(t, db.AddAddress(walletName, address, baseAddress, 0, 0, 100))
+	require.NoError(t, db.BuildTransaction(address, "", "meta", "metahash", "", 0, 25))
+	tx, err := db.GetTransaction(address, "metahash")
+	require.NoError(t, err)
+	require.Equal(t, uint(25), tx.Fee)
+
+	sendTime := start.Add(time.Hour)
+	require.NoError(t, db.ScheduleTransaction(address, "metahash", sendTime))
+	tx, err = db.GetTransaction(address, "metahash")
+	require.NoError(t, err)
+	require.True(t, tx.SendTime.Equal(sendTime))
+
+	// fees are recorded when relayed, and kept after the transfer is deleted
+	fees, err := db.GetFeesSince(start)
+	require.NoError(t, err)
+	require.Len(t, fees, 0)
+	_, err = db.StartRelay(address, "metahash")
+	require.NoError(t, err)
+	require.NoError(t, db.SetRelayed(address, "metahash", "txhash"))
+	require.Error(t, db.ScheduleTransaction(address, "metahash", start))
+	require.NoError(t, db.SetConfirmed(address, "metahash", true))
+	require.NoError(t, db.PurgeTransaction(address, "metahash"))
+	fees, err = db.GetFeesSince(start)
+	require.NoError(t, err)
+	require.Len(t, fees, 1)
+	require.Equal(t, uint(25), fees[0].Fee)
+	fees, err = db.GetFeesSince(time.Now())
+	require.NoError(t, err)
+	require.Len(t, fees, 0)
+
+	require.NoError(t, db.PruneFees(start))
+	fees, err = db.GetFeesSince(start)
+	require.NoError(t, err)
+	require.Len(t, fees, 1)
+	require.NoError(t, db.PruneFees(time.Now()))
+	fees, err = db.GetFeesSince(start)
+	require.NoError(t, err)
+	require.Len(t, fees, 0)
+}
@@ -15,17 +15,64 @@ type Address struct {
 	BaseAddress  string // indicates the base wallet account address
 	Address      string `gorm:"unique"` // this is the wallet account subaddress
 	Balance      uint
-	Scheduled    uint // indicates if it is scheduled, 0 = false, 1 = true
-	Spent        uint // indicates if it has been spent, 0 = false, 1 = true
+	KeyImage     string       // when set only this output is churned, Balance being its amount
+	State        AddressState // the stage of the address's lifecycle
 }
 
 // Transfer is a single transfer to churn an address
 type Transfer struct {
 	gorm.Model
-	SourceAddress  string    // the sending address
-	TxMetadata     string    // the transaction metadata we use to relay
-	TxMetadataHash string    // sha256 hash of TxMetadata
-	TxHash         string    // the hash of the transaction once relayed
-	SendTime       time.Time // the time at which we will relay the transaction
-	Spent          uint      // indicates if the tx is spent (ie broadcasted), 0 = false 1 = true
+	SourceAddress  string        // the sending address
+	Destination    string        // the churn account subaddress receiving the funds
+	Amount         uint          // the amount sent to Destination
+	TxMetadata     string        // the transaction metadata we use to relay, empty until built
+	TxMetadataHash string        // identifies the transfer, the sha256 hash of the TxMetadata it was first built with
+	TxHash         string        // the hash of the transaction, known once built
+	BuiltAt        time.Time     // the time at which TxMetadata was built, zero until built
+	SendTime       time.Time     // the time at which we will relay the transaction
+	Fee            uint          // the fee paid by the transaction
+	Round          uint          // the number of times the funds will have been churned once this confirms
+	Target         uint          // the number of rounds the funds are churned for before they are settled
+	State          TransferState // the stage of the transfer's lifecycle
+}
+
+// FeeEntry records the fee of a relayed transfer, so that fees can be budgeted over time.
+// Entries outlive their transfer, but carry nothing identifying it
+type FeeEntry struct {
+	gorm.Model
+	Fee       uint      // the fee paid
+	RelayedAt time.Time // the time at which the transfer was relayed
+}
+
+// SpareAddress is a churn account subaddress that was created but never received a transfer,
+// kept so that it is used for the next churn instead of leaving a gap of unused subaddresses
+type SpareAddress struct {
+	gorm.Model
+	Address string `gorm:"unique"`
+}
+
+// ChurnRound records how many times the funds received at a churn account subaddress have been
+// churned, so that they are churned again until Target rounds are reached. Only the round count
+// is kept, nothing links the subaddress to the churns that led to it. Settled funds have no record
+type ChurnRound struct {
+	gorm.Model
+	Address string `gorm:"unique"`
+	Round   uint
+	Target  uint
+}
+
+// FrozenOutput is an output frozen in the wallet while a churn from SourceAddress that may spend it
+// is scheduled, so that nothing else spends it first. It is thawed when the churn is relayed or released
+type FrozenOutput struct {
+	gorm.Model
+	KeyImage      string `gorm:"unique"`
+	SourceAddress string
+}
+
+// OutputAge is the number of blocks an unspent output must age before it is churned, chosen at
+// random when the output is first seen so that it does not change between scans
+type OutputAge struct {
+	gorm.Model
+	KeyImage string `gorm:"unique"`
+	Age      uint
 }
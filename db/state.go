@@ -0,0 +1,76 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AddressState is a stage in the lifecycle of an address being churned. An address is
+// discovered by a scan, scheduled once a transfer from it has been built, and purged
+// once its churn confirms. It is released back to discovered if every transfer from it
+// is cancelled or fails
+type AddressState string
+
+const (
+	// AddressDiscovered means the address has funds to churn and no transfer in progress
+	AddressDiscovered AddressState = "discovered"
+	// AddressScheduled means at least one transfer from the address is in progress
+	AddressScheduled AddressState = "scheduled"
+)
+
+// TransferState is a stage in the lifecycle of a churn transfer:
+//
+//	built -> scheduled -> relaying -> relayed -> confirmed -> purged
+//
+// A transfer may be cancelled before it reaches the network, and fail after a relay was
+// attempted. Purged, cancelled and failed are terminal and never stored: the transfer is
+// deleted, so that no record of the churn remains
+type TransferState string
+
+const (
+	// TransferBuilt means the transaction was created but not relayed, and has no send time yet
+	TransferBuilt TransferState = "built"
+	// TransferScheduled means the transaction will be relayed at its send time
+	TransferScheduled TransferState = "scheduled"
+	// TransferRelaying means the transaction is being relayed, and may or may not have reached the network
+	TransferRelaying TransferState = "relaying"
+	// TransferRelayed means the transaction is in the transaction pool
+	TransferRelayed TransferState = "relayed"
+	// TransferConfirmed means the transaction has been mined, but not yet by enough blocks to be final
+	TransferConfirmed TransferState = "confirmed"
+	// TransferPurged means the transaction is final, and has been forgotten along with its source address
+	TransferPurged TransferState = "purged"
+	// TransferCancelled means the transaction was abandoned before reaching the network
+	TransferCancelled TransferState = "cancelled"
+	// TransferFailed means the transaction was rejected by, or dropped from, the network
+	TransferFailed TransferState = "failed"
+)
+
+// ErrInvalidTransition is returned when a transfer or address is not in a state it can be moved out of
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// transferTransitions maps each stored state to the states a transfer may move to from it
+var transferTransitions = map[TransferState][]TransferState{
+	TransferBuilt:     {TransferScheduled, TransferCancelled},
+	TransferScheduled: {TransferScheduled, TransferRelaying, TransferCancelled},
+	// a relay that did not reach the network may be retried
+	TransferRelaying: {TransferScheduled, TransferRelayed, TransferFailed, TransferCancelled},
+	TransferRelayed:  {TransferConfirmed, TransferFailed},
+	// a confirmed transaction returns to the pool if its block is orphaned
+	TransferConfirmed: {TransferRelayed, TransferPurged, TransferFailed},
+}
+
+// terminal returns whether a transfer is deleted upon reaching the state
+func (s TransferState) terminal() bool {
+	return s == TransferPurged || s == TransferCancelled || s == TransferFailed
+}
+
+// checkTransition returns an error if a transfer may not move from one state to the other
+func checkTransition(from, to TransferState) error {
+	for _, next := range transferTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: transfer is %s, it can not become %s", ErrInvalidTransition, from, to)
+}
@@ -3,6 +3,7 @@ module github.com/bonedaddy/mychurnero
 go 1.17
 
 require (
+	github.com/gorilla/rpc v1.2.0
 	github.com/jinzhu/gorm v1.9.16
 	github.com/monero-ecosystem/go-monero-rpc-client v0.0.0-20211022153113-045f57510fdd
 	github.com/segmentio/ksuid v1.0.3
@@ -19,7 +20,6 @@ require (
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/gorilla/rpc v1.2.0 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.1 // indirect
 	github.com/mattn/go-sqlite3 v1.14.2 // indirect
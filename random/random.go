@@ -0,0 +1,83 @@
+// Package random provides the randomness behind churn decisions such as delays, amounts and
+// priorities. Anyone able to predict these could link churns together, so outside of tests
+// they are drawn from the operating system's cryptographically secure generator
+package random
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+)
+
+// Source is a source of random numbers
+type Source interface {
+	// Int63n returns a number in [0, n), panicking if n <= 0
+	Int63n(n int64) int64
+	// Float64 returns a number in [0.0, 1.0)
+	Float64() float64
+	// NormFloat64 returns a normally distributed number with a mean of 0 and standard deviation of 1
+	NormFloat64() float64
+	// ExpFloat64 returns an exponentially distributed number with a rate of 1
+	ExpFloat64() float64
+}
+
+// secureSource is a math/rand source reading from crypto/rand. It holds no state
+type secureSource struct{}
+
+func (secureSource) Uint64() uint64 {
+	var buf [8]byte
+	if _, err := crand.Read(buf[:]); err != nil {
+		panic("random: reading from crypto/rand failed: " + err.Error())
+	}
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+func (ss secureSource) Int63() int64 {
+	return int64(ss.Uint64() &^ (1 << 63))
+}
+
+// Seed does nothing, a secure source can not be seeded
+func (secureSource) Seed(int64) {}
+
+// NewSecure returns a Source backed by crypto/rand, safe for concurrent use
+func NewSecure() Source {
+	// the methods of Source only use the stateless underlying source, so no locking is needed
+	return rand.New(secureSource{})
+}
+
+// seededSource is a deterministic Source guarded by a lock
+type seededSource struct {
+	mux sync.Mutex
+	r   *rand.Rand
+}
+
+// NewSeeded returns a deterministic Source, safe for concurrent use. Sources with the same
+// seed return the same numbers, which makes it suitable for tests only
+func NewSeeded(seed int64) Source {
+	return &seededSource{r: rand.New(rand.NewSource(seed))}
+}
+
+func (ss *seededSource) Int63n(n int64) int64 {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	return ss.r.Int63n(n)
+}
+
+func (ss *seededSource) Float64() float64 {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	return ss.r.Float64()
+}
+
+func (ss *seededSource) NormFloat64() float64 {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	return ss.r.NormFloat64()
+}
+
+func (ss *seededSource) ExpFloat64() float64 {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	return ss.r.ExpFloat64()
+}
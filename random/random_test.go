@@ -0,0 +1,48 @@
+package random
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandom(t *testing.T) {
+	draw := func(src Source) []float64 {
+		return []float64{float64(src.Int63n(1000)), src.Float64(), src.NormFloat64(), src.ExpFloat64()}
+	}
+	t.Run("Seeded", func(t *testing.T) {
+		require.Equal(t, draw(NewSeeded(1)), draw(NewSeeded(1)))
+		require.NotEqual(t, draw(NewSeeded(1)), draw(NewSeeded(2)))
+	})
+	t.Run("Secure", func(t *testing.T) {
+		src := NewSecure()
+		require.NotEqual(t, draw(src), draw(src))
+		seen := make(map[int64]bool)
+		for i := 0; i < 1000; i++ {
+			n := src.Int63n(10)
+			require.True(t, n >= 0 && n < 10, n)
+			seen[n] = true
+			f := src.Float64()
+			require.True(t, f >= 0 && f < 1, f)
+			require.GreaterOrEqual(t, src.ExpFloat64(), float64(0))
+		}
+		require.Len(t, seen, 10)
+		require.Panics(t, func() { src.Int63n(0) })
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		for _, src := range []Source{NewSecure(), NewSeeded(1)} {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						draw(src)
+					}
+				}()
+			}
+			wg.Wait()
+		}
+	})
+}
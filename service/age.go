@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"go.uber.org/zap"
+)
+
+// eligibility records which unspent outputs of the wallet are old enough to be churned
+type eligibility struct {
+	// key images of the outputs that have unlocked and reached their age
+	eligible map[string]bool
+	// subaddresses with unlocked outputs that have not reached their age
+	young map[client.SubaddressIndex]bool
+	// accounts whose outputs could not be listed, none of which are churned until the next scan
+	failed map[uint64]bool
+	// set when outputs need no age, so that every unlocked output that is not frozen may be churned
+	all bool
+}
+
+// output returns whether the output with the given key image may be churned. When no age is
+// required callers must check the output is unlocked and not frozen themselves
+func (e *eligibility) output(keyImage string) bool {
+	return e.all || e.eligible[keyImage]
+}
+
+// address returns whether part of the balance of a subaddress may be churned, which is only
+// once none of the unlocked outputs the wallet could pick as inputs are too young
+func (e *eligibility) address(accountIndex, addressIndex uint64) bool {
+	return !e.failed[accountIndex] && !e.young[client.SubaddressIndex{Major: accountIndex, Minor: addressIndex}]
+}
+
+// scanEligibility checks the unspent outputs of every account against the wallet height, logging
+// the amount that can not be churned yet and how long until the next output can be. Without a
+// minimum output age the wallet is not queried, as every unlocked output may be churned
+func (s *Service) scanEligibility() (*eligibility, error) {
+	if s.maxAge == 0 {
+		return &eligibility{all: true}, nil
+	}
+	var height uint64
+	if err := s.call("get_height", func(ctx context.Context) error {
+		var err error
+		height, err = s.mc.GetHeight(ctx, s.cfg.WalletName)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	var accts *wallet.ResponseGetAccounts
+	if err := s.call("get_accounts", func(ctx context.Context) error {
+		var err error
+		accts, err = s.mc.GetAccounts(ctx, s.cfg.WalletName)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	ages := s.outputAges()
+	elig := &eligibility{
+		eligible: make(map[string]bool),
+		young:    make(map[client.SubaddressIndex]bool),
+		failed:   make(map[uint64]bool),
+	}
+	seen := make(map[string]bool)
+	var waiting int
+	var locked, next uint64
+	for _, acct := range accts.SubaddressAccounts {
+		var outputs []client.Output
+		if err := s.call("incoming_transfers", func(ctx context.Context) error {
+			var err error
+			outputs, err = s.mc.UnspentOutputs(ctx, s.cfg.WalletName, acct.AccountIndex)
+			return err
+		}); err != nil {
+			s.l.Error("failed to get unspent outputs", zap.Uint64("account.index", acct.AccountIndex), zap.Error(err))
+			elig.failed[acct.AccountIndex] = true
+			continue
+		}
+		for _, out := range outputs {
+			if out.Spent || out.KeyImage == "" {
+				continue
+			}
+			seen[out.KeyImage] = true
+			// frozen outputs are the inputs of scheduled churns, or were frozen by the user
+			if out.Frozen {
+				continue
+			}
+			at := eligibleAt(out, s.outputAge(ages, out.KeyImage), height)
+			if at <= height {
+				elig.eligible[out.KeyImage] = true
+				continue
+			}
+			if out.Unlocked {
+				elig.young[out.Subaddress] = true
+			}
+			waiting++
+			locked += out.Amount
+			if next == 0 || at-height < next {
+				next = at - height
+			}
+			s.l.Debug(
+				"output not yet churnable",
+				zap.Uint64("account.index", out.Subaddress.Major),
+				zap.Uint64("address.index", out.Subaddress.Minor),
+				zap.Uint64("amount", out.Amount),
+				zap.Bool("unlocked", out.Unlocked),
+				zap.Bool("coinbase", out.Coinbase),
+				zap.Uint64("blocks.until.churnable", at-height),
+				zap.Duration("time.until.churnable", time.Duration(at-height)*client.BlockTime),
+			)
+		}
+	}
+	// the ages of outputs in accounts that could not be listed are kept until they can be
+	if len(elig.failed) == 0 {
+		s.forgetOutputAges(ages, seen)
+	}
+	if waiting > 0 {
+		s.l.Info(
+			"outputs not yet churnable",
+			zap.Int("count", waiting),
+			zap.Uint64("amount", locked),
+			zap.Uint64("blocks.until.next", next),
+			zap.Duration("time.until.next", time.Duration(next)*client.BlockTime),
+		)
+	}
+	return elig, nil
+}
+
+// eligibleAt returns the height at which out has unlocked and is at least age blocks old
+func eligibleAt(out client.Output, age, height uint64) uint64 {
+	at := out.BlockHeight + age
+	if !out.Unlocked {
+		unlock := out.UnlockHeight()
+		// still locked past its unlock height, so it was sent with a later unlock time
+		if unlock <= height {
+			unlock = height + 1
+		}
+		if unlock > at {
+			at = unlock
+		}
+	}
+	return at
+}
+
+// outputAges returns the recorded ages outputs must reach, by key image
+func (s *Service) outputAges() map[string]uint64 {
+	records, err := s.db.GetOutputAges()
+	if err != nil {
+		s.l.Error("failed to get output ages from database", zap.Error(err))
+	}
+	ages := make(map[string]uint64, len(records))
+	for _, rec := range records {
+		ages[rec.KeyImage] = uint64(rec.Age)
+	}
+	return ages
+}
+
+// outputAge returns the age the output with the given key image must reach, choosing it at random
+// between the minimum and maximum the first time the output is seen
+func (s *Service) outputAge(ages map[string]uint64, keyImage string) uint64 {
+	if s.minAge == s.maxAge {
+		return s.minAge
+	}
+	if age, ok := ages[keyImage]; ok {
+		return age
+	}
+	age := s.minAge + uint64(s.rand.Int63n(int64(s.maxAge-s.minAge)+1))
+	if err := s.db.AddOutputAge(keyImage, age); err != nil {
+		s.l.Error("failed to record output age", zap.Error(err))
+	}
+	ages[keyImage] = age
+	return age
+}
+
+// forgetOutputAges removes the recorded ages of outputs that are no longer unspent
+func (s *Service) forgetOutputAges(ages map[string]uint64, unspent map[string]bool) {
+	for keyImage := range ages {
+		if unspent[keyImage] {
+			continue
+		}
+		if err := s.db.DeleteOutputAge(keyImage); err != nil {
+			s.l.Error("failed to forget output age", zap.Error(err))
+		}
+	}
+}
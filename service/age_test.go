@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/random"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEligibleAt(t *testing.T) {
+	tests := []struct {
+		name string
+		out  client.Output
+		age  uint64
+		want uint64
+	}{
+		{"locked", client.Output{BlockHeight: 100}, 0, 110},
+		{"locked coinbase", client.Output{BlockHeight: 100, Coinbase: true}, 0, 160},
+		{"older than unlock", client.Output{BlockHeight: 100}, 20, 120},
+		{"unlocked", client.Output{BlockHeight: 100, Unlocked: true}, 5, 105},
+		{"unlock time", client.Output{BlockHeight: 50}, 0, 106},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, eligibleAt(tt.out, tt.age, 105), tt.name)
+	}
+}
+
+func TestServiceOutputAge(t *testing.T) {
+	ctx := context.Background()
+	for _, churnOutputs := range []bool{false, true} {
+		churnOutputs := churnOutputs
+		name := "Balances"
+		if churnOutputs {
+			name = "Outputs"
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.ChurnOutputs = churnOutputs
+			cfg.MinOutputAge = 20
+			cfg.MaxOutputAge = 30
+
+			fw := client.NewFakeWallet(cfg.WalletName)
+			srv := newTestServiceWithRand(t, cfg, fw, random.NewSeeded(1))
+			srv.createChurnAccount(cfg.ChurnAccountIndex)
+			acct, err := fw.GetAddress(ctx, cfg.WalletName, 0, 0)
+			require.NoError(t, err)
+			source := acct.Addresses[0].Address
+			scan := func() int {
+				srv.handleGetChurnTick()
+				addrs, err := srv.DB().GetUnscheduledAddresses()
+				require.NoError(t, err)
+				return len(addrs)
+			}
+
+			// an unlocked output is only churned once it reaches the age chosen for it
+			require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+			fw.MineBlocks(client.FakeUnlockBlocks)
+			require.Equal(t, 0, scan())
+			ages, err := srv.DB().GetOutputAges()
+			require.NoError(t, err)
+			require.Len(t, ages, 1)
+			age := uint64(ages[0].Age)
+			require.True(t, age >= cfg.MinOutputAge && age <= cfg.MaxOutputAge, age)
+			fw.MineBlocks(age - client.FakeUnlockBlocks - 1)
+			require.Equal(t, 0, scan())
+			fw.MineBlocks(1)
+			require.Equal(t, 1, scan())
+			require.NoError(t, srv.DB().DeleteAddress(source))
+
+			// a younger output received at the same subaddress holds back churning its balance, but
+			// not churning the old output on its own
+			require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(0.5)))
+			fw.MineBlocks(client.FakeUnlockBlocks)
+			if churnOutputs {
+				require.Equal(t, 1, scan())
+				addrs, err := srv.DB().GetUnscheduledAddresses()
+				require.NoError(t, err)
+				require.Equal(t, ages[0].KeyImage, addrs[0].KeyImage)
+			} else {
+				require.Equal(t, 0, scan())
+			}
+
+			// coinbase outputs stay locked for longer
+			require.NoError(t, fw.FundCoinbase(0, 0, wallet.Float64ToXMR(2)))
+			fw.MineBlocks(cfg.MaxOutputAge)
+			outputs, err := fw.UnspentOutputs(ctx, cfg.WalletName, 0)
+			require.NoError(t, err)
+			elig, err := srv.scanEligibility()
+			require.NoError(t, err)
+			for _, out := range outputs {
+				require.Equal(t, !out.Coinbase, elig.output(out.KeyImage))
+			}
+			require.True(t, elig.address(0, 0))
+			fw.MineBlocks(client.CoinbaseUnlockBlocks - cfg.MaxOutputAge)
+			elig, err = srv.scanEligibility()
+			require.NoError(t, err)
+			for _, out := range outputs {
+				require.True(t, elig.output(out.KeyImage))
+			}
+
+			// the ages of spent outputs are forgotten
+			ages, err = srv.DB().GetOutputAges()
+			require.NoError(t, err)
+			require.Len(t, ages, 3)
+			dest, err := fw.GetAddress(ctx, cfg.WalletName, cfg.ChurnAccountIndex)
+			require.NoError(t, err)
+			_, err = fw.SweepAll(ctx, client.TransferOpts{
+				WalletName:   cfg.WalletName,
+				Destinations: map[string]uint64{dest.Address: 0},
+			})
+			require.NoError(t, err)
+			_, err = srv.scanEligibility()
+			require.NoError(t, err)
+			ages, err = srv.DB().GetOutputAges()
+			require.NoError(t, err)
+			require.Len(t, ages, 0)
+		})
+	}
+}
+
+// outputsWallet counts the calls listing unspent outputs, failing those of one account when set
+type outputsWallet struct {
+	*client.FakeWallet
+	calls   int
+	fail    bool
+	account uint64
+}
+
+func (ow *outputsWallet) UnspentOutputs(ctx context.Context, walletName string, accountIndex uint64) ([]client.Output, error) {
+	ow.calls++
+	if ow.fail && accountIndex == ow.account {
+		return nil, errors.New("account listing failed")
+	}
+	return ow.FakeWallet.UnspentOutputs(ctx, walletName, accountIndex)
+}
+
+func TestServiceEligibility(t *testing.T) {
+	t.Run("NoAge", func(t *testing.T) {
+		cfg := testConfig(t)
+		ow := &outputsWallet{FakeWallet: newFundedWallet(t, cfg)}
+		srv := newTestService(t, cfg, ow)
+		elig, err := srv.scanEligibility()
+		require.NoError(t, err)
+		require.Equal(t, 0, ow.calls)
+		require.True(t, elig.address(0, 0))
+	})
+	t.Run("FailedAccount", func(t *testing.T) {
+		cfg := testConfig(t)
+		cfg.MinOutputAge = 20
+		cfg.MaxOutputAge = 30
+		ow := &outputsWallet{FakeWallet: newFundedWallet(t, cfg)}
+		srv := newTestServiceWithRand(t, cfg, ow, random.NewSeeded(1))
+		srv.createChurnAccount(cfg.ChurnAccountIndex)
+		ow.MineBlocks(cfg.MaxOutputAge)
+		elig, err := srv.scanEligibility()
+		require.NoError(t, err)
+		require.True(t, elig.address(0, 0))
+
+		// the other accounts are still scanned, while the failed one is neither churned nor
+		// has the ages of its outputs forgotten
+		ow.fail = true
+		ow.calls = 0
+		elig, err = srv.scanEligibility()
+		require.NoError(t, err)
+		require.True(t, ow.calls > 1)
+		require.False(t, elig.address(0, 0))
+		require.True(t, elig.address(cfg.ChurnAccountIndex, 0))
+		ages, err := srv.DB().GetOutputAges()
+		require.NoError(t, err)
+		require.Len(t, ages, 1)
+	})
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errCircuitOpen is returned instead of calling the wallet while the circuit breaker is open
+var errCircuitOpen = errors.New("wallet rpc circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (bs breakerState) String() string {
+	switch bs {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops calls to the wallet after threshold consecutive failures.
+// Once cooldown has passed a single trial call is let through, closing the breaker
+// if it succeeds and reopening it otherwise. A threshold below 1 disables the breaker
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	l         *zap.Logger
+
+	mux      sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(l *zap.Logger, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		l:         l.Named("breaker"),
+	}
+}
+
+// Allow returns errCircuitOpen if calls to the wallet should not be made
+func (cb *circuitBreaker) Allow() error {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	switch cb.state {
+	case breakerOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return errCircuitOpen
+		}
+		cb.setState(breakerHalfOpen)
+		return nil
+	case breakerHalfOpen:
+		// only the trial call is allowed through
+		return errCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// Ready returns whether or not a call made now would be allowed, without changing state
+func (cb *circuitBreaker) Ready() bool {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	return cb.state == breakerClosed || (cb.state == breakerOpen && time.Since(cb.openedAt) >= cb.cooldown)
+}
+
+// State returns the current state of the breaker
+func (cb *circuitBreaker) State() breakerState {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	return cb.state
+}
+
+// Success records a call that reached the wallet
+func (cb *circuitBreaker) Success() {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.failures = 0
+	if cb.state != breakerClosed {
+		cb.setState(breakerClosed)
+	}
+}
+
+// Failure records a call that failed to reach the wallet
+func (cb *circuitBreaker) Failure() {
+	if cb.threshold <= 0 {
+		return
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.failures++
+	if cb.state == breakerHalfOpen || (cb.state == breakerClosed && cb.failures >= cb.threshold) {
+		cb.openedAt = time.Now()
+		cb.setState(breakerOpen)
+	}
+}
+
+// setState changes the state of the breaker, logging the transition. Must be called with mux held
+func (cb *circuitBreaker) setState(state breakerState) {
+	prev := cb.state
+	cb.state = state
+	fields := []zap.Field{
+		zap.String("breaker.from", prev.String()),
+		zap.String("breaker.to", state.String()),
+	}
+	switch state {
+	case breakerOpen:
+		cb.l.Warn(
+			"wallet rpc unavailable, pausing scanning and relaying",
+			append(fields, zap.Int("failures", cb.failures), zap.Duration("cooldown", cb.cooldown))...,
+		)
+	case breakerHalfOpen:
+		cb.l.Info("probing wallet rpc", fields...)
+	default:
+		cb.l.Info("wallet rpc available, resuming scanning and relaying", fields...)
+	}
+}
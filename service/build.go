@@ -0,0 +1,108 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/db"
+	"go.uber.org/zap"
+)
+
+// errNoTransaction is returned when the wallet reports creating a transfer without returning its transaction
+var errNoTransaction = errors.New("wallet returned no transaction")
+
+// newTransferID returns a random id for a planned transfer, shaped like a metadata hash
+func newTransferID() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// planTransaction schedules a churn of addr without building its transaction, which is
+// done by relayScheduled moments before it is relayed
+func (s *Service) planTransaction(addr db.Address) {
+	sendAmt := s.sendAmount(addr)
+	if sendAmt == 0 {
+		return
+	}
+	id, err := newTransferID()
+	if err != nil {
+		s.l.Error("failed to generate transfer id", zap.Error(err))
+		return
+	}
+	churnToAddr, err := s.getChurnToAddress()
+	if err != nil {
+		s.l.Error("failed to get churn to address", zap.Error(err))
+		return
+	}
+	if err := s.db.PlanTransaction(addr.Address, churnToAddr, id, sendAmt); err != nil {
+		s.l.Error("failed to store transaction", zap.Error(err), zap.String("metadata.sha256", id))
+		s.keepSpareAddress(churnToAddr)
+		return
+	}
+	delay := s.delays.Delay(s.rand)
+	s.l.Info(
+		"transaction planned",
+		zap.String("metadata.sha256", id),
+		zap.Float64("delay.minutes", delay.Minutes()),
+	)
+	round, target := s.chooseRound(addr)
+	s.scheduleBuilt(addr, id, round, target, time.Now().Add(delay))
+}
+
+// needsBuild returns whether a scheduled transfer has not been built yet, or was built
+// longer than the maximum metadata age ago
+func (s *Service) needsBuild(tx db.Transfer) bool {
+	if tx.TxMetadata == "" {
+		return true
+	}
+	return s.cfg.MaxMetadataAge > 0 && time.Since(tx.BuiltAt) > s.cfg.MaxMetadataAge
+}
+
+// rebuildTx builds a new transaction for a scheduled transfer, replacing any metadata it had,
+// and returns the updated transfer. It returns an error for the scheduler to retry or hold the
+// transfer, or nil and no transfer if it was cancelled instead. A transfer too large to be sent
+// in a single transaction keeps the first, and the others are scheduled on their own like those
+// created by handleCreateTx, so that the address is not planned and split again forever
+func (s *Service) rebuildTx(tx db.Transfer) (*db.Transfer, error) {
+	addr, err := s.db.GetAddress(tx.SourceAddress)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := s.buildTx(*addr, tx.Destination, uint64(tx.Amount))
+	switch {
+	case err == nil:
+	case errors.Is(err, client.ErrNotEnoughUnlockedMoney), errors.Is(err, errFeeOverCap):
+		return nil, &deferral{until: time.Now().Add(s.cfg.ScanInterval), reason: err.Error()}
+	case isTransient(err) || errors.Is(err, errCircuitOpen):
+		return nil, err
+	default:
+		// the address is churned again once a scan finds it with a balance to churn
+		s.l.Error("failed to build transaction, unscheduling", zap.Error(err), zap.String("metadata.sha256", tx.TxMetadataHash))
+		if err := s.sched.Cancel(tx.SourceAddress, tx.TxMetadataHash); err != nil {
+			s.l.Error("failed to unschedule transaction", zap.Error(err), zap.String("metadata.sha256", tx.TxMetadataHash))
+		}
+		return nil, nil
+	}
+	if len(txs) == 0 {
+		return nil, errNoTransaction
+	}
+	built := txs[0]
+	if err := s.db.RebuildTransaction(tx.SourceAddress, tx.TxMetadataHash, built.metadata, built.hash, built.amount, built.fee); err != nil {
+		s.l.Error("failed to store rebuilt transaction", zap.Error(err), zap.String("metadata.sha256", tx.TxMetadataHash))
+		return nil, err
+	}
+	s.l.Info("transaction built", zap.String("metadata.sha256", tx.TxMetadataHash), zap.Uint64("fee", built.fee))
+	if len(txs) > 1 {
+		s.l.Info("transfer split into several transactions", zap.String("metadata.sha256", tx.TxMetadataHash), zap.Int("count", len(txs)))
+	}
+	for _, extra := range txs[1:] {
+		s.scheduleCreated(*addr, extra, uint64(tx.Round), uint64(tx.Target))
+	}
+	return s.db.GetTransaction(tx.SourceAddress, tx.TxMetadataHash)
+}
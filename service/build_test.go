@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/config"
+	"github.com/bonedaddy/mychurnero/db"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceBuild(t *testing.T) {
+	ctx := context.Background()
+	// newService returns a service churning a single funded address, with its transfer scheduled
+	newService := func(t *testing.T, cfg *config.Config) (*Service, *client.FakeWallet, db.Transfer) {
+		fw := newFundedWallet(t, cfg)
+		srv := newTestService(t, cfg, fw)
+		srv.createChurnAccount(cfg.ChurnAccountIndex)
+		srv.handleGetChurnTick()
+		srv.createTransactions()
+		txs, err := srv.DB().GetUnrelayedTransactions()
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+		return srv, fw, txs[0]
+	}
+	relayed := func(t *testing.T, srv *Service) db.Transfer {
+		txs, err := srv.DB().GetRelayedTransactions()
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+		return txs[0]
+	}
+
+	t.Run("JustInTime", func(t *testing.T) {
+		cfg := testConfig(t)
+		cfg.JustInTime = true
+		srv, fw, tx := newService(t, cfg)
+		// only the intent is stored until the send time
+		require.Empty(t, tx.TxMetadata)
+		require.Empty(t, tx.TxHash)
+		require.NotEmpty(t, tx.Destination)
+		require.GreaterOrEqual(t, uint64(tx.Amount), cfg.MinChurnAmount)
+		require.Equal(t, 0, fw.Unrelayed())
+
+		require.NoError(t, srv.relayScheduled(tx))
+		got := relayed(t, srv)
+		require.Equal(t, tx.TxMetadataHash, got.TxMetadataHash)
+		require.NotEmpty(t, got.TxHash)
+		require.NotEmpty(t, got.TxMetadata)
+		require.NotZero(t, got.Fee)
+		status, err := fw.TxStatus(ctx, cfg.WalletName, got.TxHash)
+		require.NoError(t, err)
+		require.Equal(t, client.TxPending, status.State)
+	})
+	t.Run("FeeOverCap", func(t *testing.T) {
+		cfg := testConfig(t)
+		cfg.JustInTime = true
+		srv, _, tx := newService(t, cfg)
+		// a transaction that can not be built within the fee cap is held back until fees may have dropped
+		srv.feeCap.maxFee = 1
+		err := srv.relayScheduled(tx)
+		var held *deferral
+		require.True(t, errors.As(err, &held), err)
+		require.True(t, held.until.After(time.Now()))
+		unrelayed, err := srv.DB().GetUnrelayedTransactions()
+		require.NoError(t, err)
+		require.Len(t, unrelayed, 1)
+		require.Empty(t, unrelayed[0].TxMetadata)
+	})
+	t.Run("Split", func(t *testing.T) {
+		cfg := testConfig(t)
+		cfg.JustInTime = true
+		srv, fw, tx := newService(t, cfg)
+		// a transfer that no longer fits in one transaction relays the first, scheduling the others on their own
+		fw.SplitThreshold = uint64(tx.Amount) / 2
+		// with funds left for the fee of each
+		require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+		fw.MineBlocks(client.FakeUnlockBlocks)
+		require.NoError(t, srv.relayScheduled(tx))
+		got := relayed(t, srv)
+		require.Equal(t, tx.TxMetadataHash, got.TxMetadataHash)
+		unrelayed, err := srv.DB().GetUnrelayedTransactions()
+		require.NoError(t, err)
+		require.Len(t, unrelayed, 1)
+		require.NotEmpty(t, unrelayed[0].TxMetadata)
+		require.Equal(t, tx.Round, unrelayed[0].Round)
+		require.Equal(t, uint64(tx.Amount), uint64(got.Amount+unrelayed[0].Amount))
+		require.Equal(t, 1, fw.Unrelayed())
+		require.NoError(t, srv.relayScheduled(unrelayed[0]))
+		require.Equal(t, 0, fw.Unrelayed())
+	})
+	t.Run("MaxMetadataAge", func(t *testing.T) {
+		cfg := testConfig(t)
+		cfg.MaxMetadataAge = time.Hour
+		srv, _, tx := newService(t, cfg)
+		require.NotEmpty(t, tx.TxMetadata)
+		require.False(t, srv.needsBuild(tx))
+
+		// once stale the prebuilt transaction is discarded and a new one relayed in its place
+		srv.cfg.MaxMetadataAge = time.Nanosecond
+		time.Sleep(time.Millisecond)
+		require.True(t, srv.needsBuild(tx))
+		require.NoError(t, srv.relayScheduled(tx))
+		got := relayed(t, srv)
+		require.Equal(t, tx.TxMetadataHash, got.TxMetadataHash)
+		require.NotEqual(t, tx.TxHash, got.TxHash)
+		require.NotEqual(t, tx.TxMetadata, got.TxMetadata)
+	})
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/db"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+// createdTx is a transaction created without being relayed
+type createdTx struct {
+	metadata    string
+	hash        string
+	destination string
+	amount      uint64
+	fee         uint64
+}
+
+// errFeeOverCap is returned when a transaction is over the fee cap even at the lowest priority
+var errFeeOverCap = errors.New("transaction fee is over the fee cap at every priority")
+
+// feeCap limits the fee paid by a single transaction. A zero limit is disabled
+type feeCap struct {
+	maxFee   uint64
+	maxRatio float64
+}
+
+// check returns an error if the fee of tx is over either limit
+func (fc feeCap) check(tx createdTx) error {
+	if fc.maxFee > 0 && tx.fee > fc.maxFee {
+		return fmt.Errorf("fee %d is above the maximum of %d", tx.fee, fc.maxFee)
+	}
+	if fc.maxRatio > 0 && float64(tx.fee) > fc.maxRatio*float64(tx.amount) {
+		return fmt.Errorf("fee %d is more than %g of the amount %d", tx.fee, fc.maxRatio, tx.amount)
+	}
+	return nil
+}
+
+// lowerPriority returns the next cheaper priority, or false if p is already the cheapest.
+// The wallet default is treated as normal priority
+func lowerPriority(p wallet.Priority) (wallet.Priority, bool) {
+	switch {
+	case p == wallet.PriorityUnimportant:
+		return p, false
+	case p <= wallet.PriorityNormal:
+		return wallet.PriorityUnimportant, true
+	default:
+		return p - 1, true
+	}
+}
+
+// budgetWindow limits the total fees relayed within a rolling period
+type budgetWindow struct {
+	name   string
+	period time.Duration
+	limit  uint64
+}
+
+// feeBudget holds back relays once the fees recorded in the database's fee ledger
+// would exceed the limit of any window
+type feeBudget struct {
+	db      *db.Client
+	windows []budgetWindow
+}
+
+func newFeeBudget(dbc *db.Client, daily, monthly uint64) *feeBudget {
+	fb := &feeBudget{db: dbc}
+	if daily > 0 {
+		fb.windows = append(fb.windows, budgetWindow{name: "daily", period: 24 * time.Hour, limit: daily})
+	}
+	if monthly > 0 {
+		fb.windows = append(fb.windows, budgetWindow{name: "monthly", period: 30 * 24 * time.Hour, limit: monthly})
+	}
+	return fb
+}
+
+// maxFee returns the largest fee a single transaction may pay and still fit the budget, or 0 if unlimited
+func (fb *feeBudget) maxFee() uint64 {
+	var limit uint64
+	for _, w := range fb.windows {
+		if limit == 0 || w.limit < limit {
+			limit = w.limit
+		}
+	}
+	return limit
+}
+
+// hold returns a deferral until enough fees have left the budget's windows for a relay paying
+// fee to fit, or nil if it already fits. fee must not be above maxFee. Ledger entries older
+// than every window are pruned
+func (fb *feeBudget) hold(fee uint64, now time.Time) (*deferral, error) {
+	if len(fb.windows) == 0 {
+		return nil, nil
+	}
+	var longest time.Duration
+	for _, w := range fb.windows {
+		if w.period > longest {
+			longest = w.period
+		}
+	}
+	if err := fb.db.PruneFees(now.Add(-longest)); err != nil {
+		return nil, err
+	}
+	var held *deferral
+	for _, w := range fb.windows {
+		entries, err := fb.db.GetFeesSince(now.Add(-w.period))
+		if err != nil {
+			return nil, err
+		}
+		var spent uint64
+		for _, entry := range entries {
+			spent += uint64(entry.Fee)
+		}
+		if spent+fee <= w.limit {
+			continue
+		}
+		// wait for enough of the oldest fees to leave the window
+		release := now.Add(w.period)
+		for _, entry := range entries {
+			spent -= uint64(entry.Fee)
+			if spent+fee <= w.limit {
+				release = entry.RelayedAt.Add(w.period)
+				break
+			}
+		}
+		if held == nil || release.After(held.until) {
+			held = &deferral{
+				until:  release,
+				reason: fmt.Sprintf("%s fee budget of %d would be exceeded", w.name, w.limit),
+			}
+		}
+	}
+	return held, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/db"
+	"go.uber.org/zap"
+)
+
+// freezeInputs freezes the outputs a scheduled churn from addr may spend, so that nothing else
+// using the wallet spends them and invalidates the stored transaction. That is the output being
+// churned, or every unspent output of the subaddress when churning part of its balance. Outputs
+// are recorded before being frozen, so that one is never left frozen without a record to thaw it by
+func (s *Service) freezeInputs(addr db.Address) {
+	keyImages := []string{addr.KeyImage}
+	if addr.KeyImage == "" {
+		var outputs []client.Output
+		if err := s.call("incoming_transfers", func(ctx context.Context) error {
+			var err error
+			outputs, err = s.mc.UnspentOutputs(ctx, s.cfg.WalletName, uint64(addr.AccountIndex))
+			return err
+		}); err != nil {
+			s.l.Warn("failed to get outputs to freeze", zap.Error(err), zap.String("address", addr.Address))
+			return
+		}
+		keyImages = keyImages[:0]
+		for _, out := range outputs {
+			// outputs frozen by anyone else are left for them to thaw
+			if out.Subaddress.Minor == uint64(addr.AddressIndex) && !out.Spent && !out.Frozen && out.KeyImage != "" {
+				keyImages = append(keyImages, out.KeyImage)
+			}
+		}
+	}
+	for _, keyImage := range keyImages {
+		if err := s.db.AddFrozenOutput(addr.Address, keyImage); err != nil {
+			s.l.Error("failed to record frozen output", zap.Error(err), zap.String("address", addr.Address))
+			continue
+		}
+		if err := s.call("freeze", func(ctx context.Context) error {
+			return s.mc.Freeze(ctx, s.cfg.WalletName, keyImage)
+		}); err != nil {
+			s.l.Warn("failed to freeze output", zap.Error(err), zap.String("address", addr.Address))
+			if err := s.db.DeleteFrozenOutput(keyImage); err != nil {
+				s.l.Error("failed to forget frozen output", zap.Error(err), zap.String("address", addr.Address))
+			}
+		}
+	}
+}
+
+// thawInputs thaws the outputs frozen for churns from sourceAddress. Outputs the wallet no longer
+// knows of are forgotten, while those that fail to thaw are kept to be thawed again later
+func (s *Service) thawInputs(sourceAddress string) {
+	outputs, err := s.db.GetFrozenOutputs(sourceAddress)
+	if err != nil {
+		s.l.Error("failed to get frozen outputs from database", zap.Error(err), zap.String("address", sourceAddress))
+		return
+	}
+	for _, out := range outputs {
+		keyImage := out.KeyImage
+		if err := s.call("thaw", func(ctx context.Context) error {
+			return s.mc.Thaw(ctx, s.cfg.WalletName, keyImage)
+		}); err != nil && !errors.Is(err, client.ErrInvalidKeyImage) {
+			s.l.Warn("failed to thaw output", zap.Error(err), zap.String("address", sourceAddress))
+			continue
+		}
+		if err := s.db.DeleteFrozenOutput(keyImage); err != nil {
+			s.l.Error("failed to forget frozen output", zap.Error(err), zap.String("address", sourceAddress))
+		}
+	}
+}
+
+// refreezeInputs freezes the outputs of sourceAddress again if a churn from it is still scheduled
+func (s *Service) refreezeInputs(sourceAddress string) {
+	scheduled, err := s.scheduledSources()
+	if err != nil {
+		s.l.Error("failed to get scheduled transactions from database", zap.Error(err))
+		return
+	}
+	if !scheduled[sourceAddress] {
+		return
+	}
+	addr, err := s.db.GetAddress(sourceAddress)
+	if err != nil {
+		s.l.Error("failed to get source address", zap.Error(err), zap.String("address", sourceAddress))
+		return
+	}
+	s.freezeInputs(*addr)
+}
+
+// scheduledSources returns the source addresses of all scheduled transfers
+func (s *Service) scheduledSources() (map[string]bool, error) {
+	txs, err := s.db.GetTransactionsInState(db.TransferScheduled)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]bool, len(txs))
+	for _, tx := range txs {
+		sources[tx.SourceAddress] = true
+	}
+	return sources, nil
+}
+
+// reconcileFrozen thaws outputs left frozen for addresses without a scheduled churn, and freezes
+// the outputs of those with one, as an unclean shutdown may have left either undone
+func (s *Service) reconcileFrozen() {
+	scheduled, err := s.scheduledSources()
+	if err != nil {
+		s.l.Error("failed to get scheduled transactions from database", zap.Error(err))
+		return
+	}
+	frozen, err := s.db.GetFrozenOutputs("")
+	if err != nil {
+		s.l.Error("failed to get frozen outputs from database", zap.Error(err))
+		return
+	}
+	thawed := make(map[string]bool)
+	for _, out := range frozen {
+		if !scheduled[out.SourceAddress] && !thawed[out.SourceAddress] {
+			thawed[out.SourceAddress] = true
+			s.thawInputs(out.SourceAddress)
+		}
+	}
+	for source := range scheduled {
+		s.refreezeInputs(source)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceFreeze(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+
+	fw := newFundedWallet(t, cfg)
+	srv := newTestService(t, cfg, fw)
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	frozen := func() int {
+		outputs, err := fw.UnspentOutputs(ctx, cfg.WalletName, 0)
+		require.NoError(t, err)
+		count := 0
+		for _, out := range outputs {
+			if out.Frozen {
+				count++
+			}
+		}
+		return count
+	}
+
+	// the inputs of a scheduled churn are frozen, so nothing else can spend them
+	srv.handleGetChurnTick()
+	srv.createTransactions()
+	txs, err := srv.DB().GetUnrelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	require.Equal(t, 1, frozen())
+	records, err := srv.DB().GetFrozenOutputs(txs[0].SourceAddress)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	_, err = fw.Transfer(ctx, client.TransferOpts{
+		WalletName:   cfg.WalletName,
+		Destinations: map[string]uint64{txs[0].Destination: wallet.Float64ToXMR(0.1)},
+	})
+	require.Error(t, err)
+
+	// reconciling freezes what was thawed behind our back, and thaws what is no longer scheduled
+	require.NoError(t, fw.Thaw(ctx, cfg.WalletName, records[0].KeyImage))
+	require.NoError(t, srv.DB().AddFrozenOutput("released", "unknown"))
+	srv.reconcileFrozen()
+	require.Equal(t, 1, frozen())
+	records, err = srv.DB().GetFrozenOutputs("")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, txs[0].SourceAddress, records[0].SourceAddress)
+
+	// and they are thawed to be relayed
+	require.NoError(t, srv.relayScheduled(txs[0]))
+	relayed, err := srv.DB().GetRelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, relayed, 1)
+	require.Equal(t, 0, frozen())
+	records, err = srv.DB().GetFrozenOutputs("")
+	require.NoError(t, err)
+	require.Len(t, records, 0)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceChurnOutputs(t *testing.T) {
+	ctx := context.Background()
+	for _, justInTime := range []bool{false, true} {
+		justInTime := justInTime
+		name := "Prebuilt"
+		if justInTime {
+			name = "JustInTime"
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.ChurnOutputs = true
+			cfg.JustInTime = justInTime
+
+			// two outputs large enough to churn are received at the same subaddress
+			fw := client.NewFakeWallet(cfg.WalletName)
+			require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+			require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(0.5)))
+			require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(0.01)))
+			fw.MineBlocks(client.FakeUnlockBlocks)
+			srv := newTestService(t, cfg, fw)
+			srv.createChurnAccount(cfg.ChurnAccountIndex)
+			outputs, err := fw.UnspentOutputs(ctx, cfg.WalletName, 0)
+			require.NoError(t, err)
+			require.Len(t, outputs, 3)
+
+			// each is churned on its own, in full
+			swept := make(map[string]bool)
+			for i := 0; i < 2; i++ {
+				srv.handleGetChurnTick()
+				addrs, err := srv.DB().GetUnscheduledAddresses()
+				require.NoError(t, err)
+				require.Len(t, addrs, 1)
+				require.NotEmpty(t, addrs[0].KeyImage)
+				require.False(t, swept[addrs[0].KeyImage])
+				swept[addrs[0].KeyImage] = true
+
+				srv.createTransactions()
+				txs, err := srv.DB().GetUnrelayedTransactions()
+				require.NoError(t, err)
+				require.Len(t, txs, 1)
+				require.NoError(t, srv.relayScheduled(txs[0]))
+				relayed, err := srv.DB().GetRelayedTransactions()
+				require.NoError(t, err)
+				require.Len(t, relayed, 1)
+				require.Equal(t, addrs[0].Balance, relayed[0].Amount+relayed[0].Fee)
+
+				fw.MineBlocks(client.FakeConfirmationThreshold + 1)
+				srv.trackRelayedTransfers()
+				left, err := srv.DB().GetTransactions()
+				require.NoError(t, err)
+				require.Len(t, left, 0)
+			}
+
+			// leaving only the output below the minimum, and no change
+			outputs, err = fw.UnspentOutputs(ctx, cfg.WalletName, 0)
+			require.NoError(t, err)
+			require.Len(t, outputs, 1)
+			require.Equal(t, wallet.Float64ToXMR(0.01), outputs[0].Amount)
+			srv.handleGetChurnTick()
+			addrs, err := srv.DB().GetUnscheduledAddresses()
+			require.NoError(t, err)
+			require.Len(t, addrs, 0)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+
+	"github.com/bonedaddy/mychurnero/db"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"go.uber.org/zap"
+)
+
+// reconcile repairs the database after an unclean shutdown by comparing it with what the
+// wallet actually relayed. Transfers caught mid relay are marked relayed, failed or returned
+// to the schedule, scheduled addresses left without transfers are released, outputs are frozen
+// or thawed to match what is scheduled, and churn account subaddresses that were created but never
+// used are kept for the next churns. It must run before the scheduler is loaded
+func (s *Service) reconcile() {
+	s.reconcileRelays()
+	released, err := s.db.ReleaseOrphanedAddresses()
+	if err != nil {
+		s.l.Error("failed to release orphaned addresses", zap.Error(err))
+	} else if released > 0 {
+		s.l.Warn("released scheduled addresses without transfers", zap.Int64("count", released))
+	}
+	s.reconcileFrozen()
+	s.recordSpareAddresses()
+}
+
+// reconcileRelays resolves transfers whose relay was started but never recorded as finished,
+// by looking up the hash stored when they were built in the source account's transfers
+func (s *Service) reconcileRelays() {
+	// a relay in flight must not be mistaken for an interrupted one
+	s.relayMux.Lock()
+	defer s.relayMux.Unlock()
+	txs, err := s.db.GetTransactionsInState(db.TransferRelaying)
+	if err != nil {
+		s.l.Error("failed to get relaying transactions from database", zap.Error(err))
+		return
+	}
+	// the type of each transfer relayed from an account, by account index and hash
+	accounts := make(map[uint]map[string]string)
+	for _, tx := range txs {
+		addr, err := s.db.GetAddress(tx.SourceAddress)
+		if err != nil {
+			s.l.Error("failed to get source address of transaction", zap.Error(err), zap.String("metadata.sha256", tx.TxMetadataHash))
+			continue
+		}
+		relayed, ok := accounts[addr.AccountIndex]
+		if !ok {
+			if relayed, err = s.relayedTransfers(uint64(addr.AccountIndex)); err != nil {
+				// without knowing what reached the network the transfer is left for the next reconciliation
+				s.l.Error("failed to get wallet transfers", zap.Error(err), zap.Uint("account.index", addr.AccountIndex))
+				continue
+			}
+			accounts[addr.AccountIndex] = relayed
+		}
+		s.resolveRelay(tx, relayed)
+	}
+}
+
+// reconcileRelay resolves a single transfer whose relay failed after it may have reached the wallet,
+// returning the state it was moved to. It is left relaying if the wallet's transfers can not be read
+func (s *Service) reconcileRelay(tx db.Transfer) db.TransferState {
+	addr, err := s.db.GetAddress(tx.SourceAddress)
+	if err != nil {
+		s.l.Error("failed to get source address of transaction", zap.Error(err), zap.String("metadata.sha256", tx.TxMetadataHash))
+		return db.TransferRelaying
+	}
+	relayed, err := s.relayedTransfers(uint64(addr.AccountIndex))
+	if err != nil {
+		s.l.Error("failed to get wallet transfers", zap.Error(err), zap.Uint("account.index", addr.AccountIndex))
+		return db.TransferRelaying
+	}
+	return s.resolveRelay(tx, relayed)
+}
+
+// resolveRelay moves a relaying transfer to the state matching the wallet's record of its hash, given
+// the type of each transfer relayed from its account by hash, and returns the state it was moved to
+func (s *Service) resolveRelay(tx db.Transfer, relayed map[string]string) db.TransferState {
+	switch relayed[tx.TxHash] {
+	case "out", "pending", "pool":
+		if err := s.db.SetRelayed(tx.SourceAddress, tx.TxMetadataHash, tx.TxHash); err != nil {
+			s.l.Error("failed to set tx hash in database", zap.Error(err), zap.String("tx.hash", tx.TxHash))
+			return db.TransferRelaying
+		}
+		s.l.Info("interrupted relay reached the network", zap.String("tx.hash", tx.TxHash))
+		return db.TransferRelayed
+	case "failed":
+		s.failTransfer(tx, "interrupted relay failed")
+		return db.TransferFailed
+	default:
+		if err := s.db.ScheduleTransaction(tx.SourceAddress, tx.TxMetadataHash, tx.SendTime); err != nil {
+			s.l.Error("failed to reschedule transaction", zap.Error(err), zap.String("metadata.sha256", tx.TxMetadataHash))
+			return db.TransferRelaying
+		}
+		s.sched.Schedule(tx.SourceAddress, tx.TxMetadataHash, tx.SendTime)
+		s.l.Info("interrupted relay did not reach the network, rescheduling", zap.String("metadata.sha256", tx.TxMetadataHash))
+		return db.TransferScheduled
+	}
+}
+
+// relayedTransfers returns the type of each transfer the wallet relayed from an account, by hash
+func (s *Service) relayedTransfers(accountIndex uint64) (map[string]string, error) {
+	var resp *wallet.ResponseGetTransfers
+	if err := s.call("get_transfers", func(ctx context.Context) error {
+		var err error
+		resp, err = s.mc.GetTransfers(ctx, s.cfg.WalletName, accountIndex)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	relayed := make(map[string]string)
+	for _, transfers := range [][]*wallet.Transfer{resp.Out, resp.Pending, resp.Pool, resp.Failed} {
+		for _, transfer := range transfers {
+			relayed[transfer.TxID] = transfer.Type
+		}
+	}
+	return relayed, nil
+}
+
+// recordSpareAddresses keeps churn account subaddresses that never received funds and are not the
+// destination of a stored transfer, so that they are used before any new subaddress is created
+func (s *Service) recordSpareAddresses() {
+	var resp *wallet.ResponseGetAddress
+	if err := s.call("get_address", func(ctx context.Context) error {
+		var err error
+		resp, err = s.mc.GetAddress(ctx, s.cfg.WalletName, s.cfg.ChurnAccountIndex)
+		return err
+	}); err != nil {
+		s.l.Error("failed to get churn account addresses", zap.Error(err))
+		return
+	}
+	txs, err := s.db.GetTransactions()
+	if err != nil {
+		s.l.Error("failed to get transactions from database", zap.Error(err))
+		return
+	}
+	destinations := make(map[string]bool, len(txs))
+	for _, tx := range txs {
+		destinations[tx.Destination] = true
+	}
+	for _, addr := range resp.Addresses {
+		// the primary address of the account is never churned to
+		if addr.AddressIndex == 0 || addr.Used || destinations[addr.Address] {
+			continue
+		}
+		if err := s.db.AddSpareAddress(addr.Address); err != nil {
+			s.l.Error("failed to record spare churn address", zap.Error(err))
+		}
+	}
+}
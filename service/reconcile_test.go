@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceReconcile(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+
+	fw := newFundedWallet(t, cfg)
+	srv := newTestService(t, cfg, fw)
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+
+	// build a churn of the funded address and start relaying it, as if the process then died
+	startRelay := func() *db.Transfer {
+		srv.handleGetChurnTick()
+		srv.createTransactions()
+		txs, err := srv.DB().GetUnrelayedTransactions()
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+		require.NotEmpty(t, txs[0].TxHash)
+		tx, err := srv.DB().StartRelay(txs[0].SourceAddress, txs[0].TxMetadataHash)
+		require.NoError(t, err)
+		return tx
+	}
+	inState := func(state db.TransferState) []db.Transfer {
+		txs, err := srv.DB().GetTransactionsInState(state)
+		require.NoError(t, err)
+		return txs
+	}
+	spares := func() int {
+		spares, err := srv.DB().GetSpareAddresses()
+		require.NoError(t, err)
+		return len(spares)
+	}
+
+	// a relay that never reached the wallet returns to the schedule
+	tx := startRelay()
+	first := tx.Destination
+	srv.reconcile()
+	require.Len(t, inState(db.TransferScheduled), 1)
+	require.Equal(t, 0, spares())
+	require.NoError(t, srv.relayTx(tx.SourceAddress, tx.TxMetadataHash))
+	require.NoError(t, fw.FailTx(tx.TxHash))
+	srv.trackRelayedTransfers()
+
+	// a relay that reached the network but failed releases its address, and the
+	// churn to addresses left unused by both failures are kept
+	tx = startRelay()
+	second := tx.Destination
+	require.NotEqual(t, first, second)
+	txHash, err := fw.Relay(ctx, cfg.WalletName, tx.TxMetadata)
+	require.NoError(t, err)
+	require.Equal(t, tx.TxHash, txHash)
+	require.NoError(t, fw.FailTx(txHash))
+	srv.reconcile()
+	txs, err := srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 0)
+	addrs, err := srv.DB().GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	require.Equal(t, 2, spares())
+
+	// a relay that reached the network is recorded as relayed, reusing the oldest spare address
+	tx = startRelay()
+	require.Equal(t, first, tx.Destination)
+	require.Equal(t, 1, spares())
+	_, err = fw.Relay(ctx, cfg.WalletName, tx.TxMetadata)
+	require.NoError(t, err)
+	srv.reconcile()
+	relayed := inState(db.TransferRelayed)
+	require.Len(t, relayed, 1)
+	require.Equal(t, tx.TxHash, relayed[0].TxHash)
+	require.Empty(t, inState(db.TransferRelaying))
+	require.Equal(t, 1, spares())
+	fees, err := srv.DB().GetFeesSince(tx.CreatedAt)
+	require.NoError(t, err)
+	require.Len(t, fees, 1)
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/random"
+	"go.uber.org/zap"
+)
+
+// retryPolicy controls how wallet rpc calls failing with transient errors are retried
+type retryPolicy struct {
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	rand        random.Source
+}
+
+// backoff returns how long to wait before the given retry, starting at 1. The delay
+// doubles with each attempt up to maxBackoff, or minBackoff if that is lower, with full
+// jitter applied to it
+func (rp retryPolicy) backoff(attempt int) time.Duration {
+	if rp.minBackoff <= 0 {
+		return 0
+	}
+	limit := rp.maxBackoff
+	if limit < rp.minBackoff {
+		limit = rp.minBackoff
+	}
+	delay := rp.minBackoff
+	for i := 1; i < attempt && delay < limit; i++ {
+		if delay > limit/2 {
+			delay = limit
+		} else {
+			delay *= 2
+		}
+	}
+	return time.Duration(rp.rand.Int63n(int64(delay))) + 1
+}
+
+// isTransient returns whether or not err was caused by failing to reach the wallet, or its daemon,
+// as opposed to an error returned by the wallet itself, in which case retrying is pointless
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if _, ok := client.AsRPCError(err); ok {
+		return client.IsTemporary(err)
+	}
+	return true
+}
+
+// call runs fn against the wallet, retrying transient failures according to the
+// retry policy while the circuit breaker allows it
+func (s *Service) call(op string, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		if err := s.breaker.Allow(); err != nil {
+			return err
+		}
+		err := fn(s.ctx)
+		if s.ctx.Err() != nil {
+			// shutting down, this says nothing about the wallet
+			return err
+		}
+		if errors.Is(err, client.ErrWalletNotOpen) && attempt < s.retry.maxAttempts {
+			s.breaker.Success()
+			s.reopenWallet(op)
+			continue
+		}
+		if !isTransient(err) {
+			// the wallet answered, even if with an error
+			s.breaker.Success()
+			return err
+		}
+		s.breaker.Failure()
+		if attempt >= s.retry.maxAttempts {
+			return err
+		}
+		delay := s.retry.backoff(attempt)
+		s.l.Warn(
+			"wallet rpc call failed, retrying",
+			zap.String("op", op),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", delay),
+			zap.Error(err),
+		)
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return err
+		}
+	}
+}
+
+// callOnce runs fn against the wallet a single time while the circuit breaker allows it, for calls
+// that must not be repeated without first checking whether the last attempt took effect. A wallet
+// that is not open is reopened, leaving the call for the caller to retry
+func (s *Service) callOnce(op string, fn func(ctx context.Context) error) error {
+	if err := s.breaker.Allow(); err != nil {
+		return err
+	}
+	err := fn(s.ctx)
+	switch {
+	case s.ctx.Err() != nil:
+		// shutting down, this says nothing about the wallet
+	case errors.Is(err, client.ErrWalletNotOpen):
+		s.breaker.Success()
+		s.reopenWallet(op)
+	case isTransient(err):
+		s.breaker.Failure()
+	default:
+		s.breaker.Success()
+	}
+	return err
+}
+
+// reopenWallet opens the wallet again after a call found it closed, as monero-wallet-rpc was likely restarted
+func (s *Service) reopenWallet(op string) {
+	s.l.Warn("wallet not open, reopening", zap.String("op", op))
+	if err := s.mc.OpenWallet(s.ctx, s.cfg.WalletName); err != nil {
+		s.l.Error("failed to reopen wallet", zap.Error(err))
+	}
+}
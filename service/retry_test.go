@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/db"
+	"github.com/bonedaddy/mychurnero/random"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// flakyWallet fails relaying, scanning, listing transfers and balances as if the wallet rpc was
+// unreachable while down is set. When relayErr is set relaying fails with it instead, and when
+// lostReply is set relaying succeeds but the reply never arrives. The replies of the next
+// lostCreates accounts and subaddresses created are lost as well
+type flakyWallet struct {
+	*client.FakeWallet
+	mux         sync.Mutex
+	down        bool
+	calls       int
+	relays      int
+	relayErr    error
+	lostReply   bool
+	lostCreates int
+}
+
+func (fw *flakyWallet) setDown(down bool) {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	fw.down = down
+}
+
+func (fw *flakyWallet) fail() error {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	fw.calls++
+	if fw.down {
+		return errors.New("dial tcp 127.0.0.1:6061: connect: connection refused")
+	}
+	return nil
+}
+
+func (fw *flakyWallet) Calls() int {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	return fw.calls
+}
+
+func (fw *flakyWallet) Relay(ctx context.Context, walletName, txMetadata string) (string, error) {
+	fw.mux.Lock()
+	fw.relays++
+	fw.mux.Unlock()
+	if err := fw.fail(); err != nil {
+		return "", err
+	}
+	fw.mux.Lock()
+	relayErr, lostReply := fw.relayErr, fw.lostReply
+	fw.mux.Unlock()
+	if relayErr != nil {
+		return "", relayErr
+	}
+	txHash, err := fw.FakeWallet.Relay(ctx, walletName, txMetadata)
+	if err == nil && lostReply {
+		return "", errors.New("read tcp 127.0.0.1:6061: connection reset by peer")
+	}
+	return txHash, err
+}
+
+func (fw *flakyWallet) Relays() int {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	return fw.relays
+}
+
+// lostCreate returns an error in place of the reply to a create call while lostCreates is set
+func (fw *flakyWallet) lostCreate(err error) error {
+	fw.mux.Lock()
+	defer fw.mux.Unlock()
+	if err != nil || fw.lostCreates == 0 {
+		return err
+	}
+	fw.lostCreates--
+	return errors.New("read tcp 127.0.0.1:6061: i/o timeout")
+}
+
+func (fw *flakyWallet) NewAccount(ctx context.Context, walletName, label string) (*wallet.ResponseCreateAccount, error) {
+	resp, err := fw.FakeWallet.NewAccount(ctx, walletName, label)
+	if err := fw.lostCreate(err); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (fw *flakyWallet) NewAddress(ctx context.Context, walletName string, accountIndex uint64) (string, error) {
+	addr, err := fw.FakeWallet.NewAddress(ctx, walletName, accountIndex)
+	if err := fw.lostCreate(err); err != nil {
+		return "", err
+	}
+	return addr, nil
+}
+
+func (fw *flakyWallet) GetChurnableAddresses(ctx context.Context, walletName string, churnAccountIndex, minBalance uint64) (*client.ChurnableAccounts, error) {
+	if err := fw.fail(); err != nil {
+		return nil, err
+	}
+	return fw.FakeWallet.GetChurnableAddresses(ctx, walletName, churnAccountIndex, minBalance)
+}
+
+func (fw *flakyWallet) GetTransfers(ctx context.Context, walletName string, accountIndex uint64) (*wallet.ResponseGetTransfers, error) {
+	if err := fw.fail(); err != nil {
+		return nil, err
+	}
+	return fw.FakeWallet.GetTransfers(ctx, walletName, accountIndex)
+}
+
+func (fw *flakyWallet) AddressBalance(ctx context.Context, walletName string, address string, accountIndex uint64, addressIndex ...uint64) (uint64, error) {
+	if err := fw.fail(); err != nil {
+		return 0, err
+	}
+	return fw.FakeWallet.AddressBalance(ctx, walletName, address, accountIndex, addressIndex...)
+}
+
+func TestServiceRetry(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MinDelayMinutes = 0
+	cfg.MaxDelayMinutes = 0
+	cfg.RetryMaxAttempts = 2
+	cfg.RetryMinBackoff = time.Millisecond
+	cfg.RetryMaxBackoff = time.Millisecond * 5
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = time.Millisecond * 200
+
+	fw := &flakyWallet{FakeWallet: newFundedWallet(t, cfg)}
+
+	srv := newTestService(t, cfg, fw)
+
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	srv.handleGetChurnTick()
+	srv.createTransactions()
+	require.Equal(t, 1, fw.Unrelayed())
+
+	// the relay fails, and so does checking whether it reached the wallet, opening the breaker
+	fw.setDown(true)
+	go srv.sched.Run(srv.ctx)
+	// the transfer is left relaying until the wallet can be asked about it
+	require.Eventually(t, func() bool {
+		txs, err := srv.DB().GetTransactionsInState(db.TransferRelaying)
+		return err == nil && len(txs) == 1 && srv.breaker.State() == breakerOpen
+	}, time.Second*5, time.Millisecond*5)
+	require.Equal(t, 1, fw.Relays())
+
+	// scanning is paused while the breaker is open
+	calls := fw.Calls()
+	srv.handleGetChurnTick()
+	require.Equal(t, calls, fw.Calls())
+
+	// once the wallet is back the next reconciliation returns the transfer to the schedule
+	fw.setDown(false)
+	require.Eventually(t, func() bool {
+		srv.reconcileRelays()
+		txs, err := srv.DB().GetRelayedTransactions()
+		return err == nil && len(txs) == 1
+	}, time.Second*5, time.Millisecond*10)
+	require.Equal(t, 0, fw.Unrelayed())
+	require.Equal(t, breakerClosed, srv.breaker.State())
+	require.Equal(t, 0, srv.sched.Len())
+}
+
+func TestServiceRelayNotRepeated(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MinDelayMinutes = 0
+	cfg.MaxDelayMinutes = 0
+	cfg.RetryMaxAttempts = 3
+	cfg.RetryMinBackoff = time.Millisecond
+	cfg.RetryMaxBackoff = time.Millisecond * 5
+	cfg.BreakerThreshold = -1
+
+	fw := &flakyWallet{FakeWallet: newFundedWallet(t, cfg)}
+
+	srv := newTestService(t, cfg, fw)
+
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	srv.handleGetChurnTick()
+	srv.createTransactions()
+	txs, err := srv.DB().GetUnrelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	tx := txs[0]
+
+	// a relay that fails is tried once, and left relaying while the wallet can not be asked about it
+	fw.setDown(true)
+	require.NoError(t, srv.relayTx(tx.SourceAddress, tx.TxMetadataHash))
+	require.Equal(t, 1, fw.Relays())
+	relaying, err := srv.DB().GetTransactionsInState(db.TransferRelaying)
+	require.NoError(t, err)
+	require.Len(t, relaying, 1)
+
+	// it never reached the wallet, so goes back on the schedule once the wallet is back
+	fw.setDown(false)
+	srv.reconcileRelays()
+	txs, err = srv.DB().GetUnrelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	require.Equal(t, 1, srv.sched.Len())
+
+	// a relay whose reply was lost is found in the wallet's transfers rather than sent again
+	fw.mux.Lock()
+	fw.lostReply = true
+	fw.mux.Unlock()
+	require.NoError(t, srv.relayTx(tx.SourceAddress, tx.TxMetadataHash))
+	require.Equal(t, 2, fw.Relays())
+	require.Equal(t, 0, fw.Unrelayed())
+	relayed, err := srv.DB().GetRelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, relayed, 1)
+	require.Equal(t, tx.TxHash, relayed[0].TxHash)
+}
+
+func TestServiceCreateNotRepeated(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	cfg.RetryMaxAttempts = 3
+	cfg.RetryMinBackoff = time.Millisecond
+	cfg.RetryMaxBackoff = time.Millisecond * 5
+
+	fw := &flakyWallet{FakeWallet: client.NewFakeWallet(cfg.WalletName), lostCreates: 2}
+	srv := newTestService(t, cfg, fw)
+
+	// an account created without a reply is found when the accounts are listed again
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	accts, err := fw.GetAccounts(ctx, cfg.WalletName)
+	require.NoError(t, err)
+	require.Len(t, accts.SubaddressAccounts, int(cfg.ChurnAccountIndex)+1)
+
+	// a subaddress is created once, its failure left to the caller
+	before, err := fw.GetAddress(ctx, cfg.WalletName, cfg.ChurnAccountIndex)
+	require.NoError(t, err)
+	_, err = srv.getChurnToAddress()
+	require.Error(t, err)
+	after, err := fw.GetAddress(ctx, cfg.WalletName, cfg.ChurnAccountIndex)
+	require.NoError(t, err)
+	require.Len(t, after.Addresses, len(before.Addresses)+1)
+	addr, err := srv.getChurnToAddress()
+	require.NoError(t, err)
+	require.NotEmpty(t, addr)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	rp := retryPolicy{minBackoff: time.Second, maxBackoff: time.Minute, rand: random.NewSeeded(1)}
+	for attempt := 1; attempt < 100; attempt++ {
+		delay := rp.backoff(attempt)
+		require.True(t, delay > 0 && delay <= time.Minute, delay)
+	}
+	// without a maximum the doubling stops at the minimum rather than overflowing
+	rp.maxBackoff = 0
+	for attempt := 1; attempt < 100; attempt++ {
+		delay := rp.backoff(attempt)
+		require.True(t, delay > 0 && delay <= time.Second, delay)
+	}
+	rp.minBackoff, rp.maxBackoff = time.Duration(1<<62), time.Duration(1<<63-1)
+	for attempt := 1; attempt < 100; attempt++ {
+		require.True(t, rp.backoff(attempt) > 0)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	cb := newCircuitBreaker(logger, 2, time.Millisecond*50)
+
+	require.NoError(t, cb.Allow())
+	cb.Failure()
+	require.Equal(t, breakerClosed, cb.State())
+	cb.Failure()
+	require.Equal(t, breakerOpen, cb.State())
+	require.Equal(t, errCircuitOpen, cb.Allow())
+	require.False(t, cb.Ready())
+
+	// a single trial call is allowed after the cooldown
+	time.Sleep(time.Millisecond * 60)
+	require.True(t, cb.Ready())
+	require.NoError(t, cb.Allow())
+	require.Equal(t, breakerHalfOpen, cb.State())
+	require.Error(t, cb.Allow())
+	// a failed trial reopens the breaker
+	cb.Failure()
+	require.Equal(t, breakerOpen, cb.State())
+
+	time.Sleep(time.Millisecond * 60)
+	require.NoError(t, cb.Allow())
+	cb.Success()
+	require.Equal(t, breakerClosed, cb.State())
+	require.NoError(t, cb.Allow())
+
+	// a threshold of 0 never opens the breaker
+	cb = newCircuitBreaker(logger, 0, time.Minute)
+	for i := 0; i < 10; i++ {
+		cb.Failure()
+	}
+	require.NoError(t, cb.Allow())
+}
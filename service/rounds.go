@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/db"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"go.uber.org/zap"
+)
+
+// chooseRound returns the round a churn from addr brings its funds to, and the number of rounds
+// they are churned for. Funds entering the churn account are given a random number of rounds
+func (s *Service) chooseRound(addr db.Address) (uint64, uint64) {
+	if uint64(addr.AccountIndex) == s.cfg.ChurnAccountIndex {
+		if round, err := s.db.GetChurnRound(addr.Address); err == nil {
+			return uint64(round.Round) + 1, uint64(round.Target)
+		}
+	}
+	target := uint64(s.minRounds) + uint64(s.rand.Int63n(int64(s.maxRounds-s.minRounds)+1))
+	return 1, target
+}
+
+// rechurn returns whether the balance at addr already went through a churn round. These are swept
+// in full, leaving nothing behind once the round is purged on confirmation. This only applies to
+// addresses churned by balance, churned outputs are always swept on their own
+func (s *Service) rechurn(addr db.Address) bool {
+	if s.cfg.ChurnOutputs || addr.KeyImage != "" || uint64(addr.AccountIndex) != s.cfg.ChurnAccountIndex {
+		return false
+	}
+	_, err := s.db.GetChurnRound(addr.Address)
+	return err == nil
+}
+
+// scanChurnRounds adds churn account subaddresses whose funds are old enough to churn but have not
+// reached their target number of rounds to the database to be churned again, returning how many were added
+func (s *Service) scanChurnRounds(elig *eligibility) int {
+	rounds, err := s.db.GetChurnRounds()
+	if err != nil {
+		s.l.Error("failed to get churn rounds from database", zap.Error(err))
+		return 0
+	}
+	if len(rounds) == 0 {
+		return 0
+	}
+	var resp *wallet.ResponseGetAddress
+	if err := s.call("get_address", func(ctx context.Context) error {
+		var err error
+		resp, err = s.mc.GetAddress(ctx, s.cfg.WalletName, s.cfg.ChurnAccountIndex)
+		return err
+	}); err != nil {
+		s.l.Error("failed to get churn account addresses", zap.Error(err))
+		return 0
+	}
+	indices := make(map[string]uint64, len(resp.Addresses))
+	for _, addr := range resp.Addresses {
+		indices[addr.Address] = addr.AddressIndex
+	}
+	var (
+		outputs map[uint64]client.Output
+		held    map[uint64]bool
+	)
+	if s.cfg.ChurnOutputs {
+		if outputs, held, err = s.churnAccountOutputs(elig); err != nil {
+			s.l.Error("failed to get churn account outputs", zap.Error(err))
+			return 0
+		}
+	}
+	var toChurn int
+	for _, round := range rounds {
+		index, ok := indices[round.Address]
+		if !ok {
+			s.l.Warn("churned address is not in the churn account", zap.String("address", round.Address))
+			continue
+		}
+		if s.cfg.ChurnOutputs {
+			out, ok := outputs[index]
+			if !ok {
+				if !held[index] {
+					s.settleRound(round.Address)
+				}
+				continue
+			}
+			err = s.db.AddOutput(s.cfg.WalletName, round.Address, resp.Address, out.KeyImage, s.cfg.ChurnAccountIndex, index, out.Amount)
+		} else {
+			if !elig.address(s.cfg.ChurnAccountIndex, index) {
+				continue
+			}
+			var balance uint64
+			if err := s.call("get_balance", func(ctx context.Context) error {
+				var err error
+				balance, err = s.mc.AddressBalance(ctx, s.cfg.WalletName, round.Address, s.cfg.ChurnAccountIndex, index)
+				return err
+			}); err != nil {
+				s.l.Error("failed to get address balance", zap.Error(err), zap.String("address", round.Address))
+				continue
+			}
+			if balance < s.cfg.MinChurnAmount {
+				continue
+			}
+			err = s.db.AddAddress(s.cfg.WalletName, round.Address, resp.Address, s.cfg.ChurnAccountIndex, index, balance)
+		}
+		if err != nil {
+			s.l.Error("failed to add address to database", zap.String("address", round.Address), zap.Error(err))
+			continue
+		}
+		toChurn++
+	}
+	return toChurn
+}
+
+// churnAccountOutputs returns the first output old enough to churn of at least the minimum churn
+// amount received at each churn account subaddress, by address index, along with the indices of
+// the subaddresses holding any unspent output of at least that amount
+func (s *Service) churnAccountOutputs(elig *eligibility) (map[uint64]client.Output, map[uint64]bool, error) {
+	var outputs []client.Output
+	if err := s.call("incoming_transfers", func(ctx context.Context) error {
+		var err error
+		outputs, err = s.mc.UnspentOutputs(ctx, s.cfg.WalletName, s.cfg.ChurnAccountIndex)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+	byIndex := make(map[uint64]client.Output, len(outputs))
+	held := make(map[uint64]bool, len(outputs))
+	for _, out := range outputs {
+		if out.Spent || out.Amount < s.cfg.MinChurnAmount {
+			continue
+		}
+		held[out.Subaddress.Minor] = true
+		if !out.Unlocked || out.Frozen || !elig.output(out.KeyImage) {
+			continue
+		}
+		if _, ok := byIndex[out.Subaddress.Minor]; !ok {
+			byIndex[out.Subaddress.Minor] = out
+		}
+	}
+	return byIndex, held, nil
+}
+
+// settleRound drops the churn round of a churn account subaddress whose outputs have all been
+// churned, unless one of them is still being churned
+func (s *Service) settleRound(address string) {
+	if _, err := s.db.GetAddress(address); err == nil {
+		return
+	}
+	if err := s.db.DeleteChurnRound(address); err != nil {
+		s.l.Error("failed to delete churn round", zap.String("address", address), zap.Error(err))
+	}
+}
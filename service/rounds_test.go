@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/bonedaddy/mychurnero/db"
+	"github.com/bonedaddy/mychurnero/random"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceChurnRounds(t *testing.T) {
+	ctx := context.Background()
+	for _, churnOutputs := range []bool{false, true} {
+		churnOutputs := churnOutputs
+		name := "Balances"
+		if churnOutputs {
+			name = "Outputs"
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MinChurnRounds = 2
+			cfg.MaxChurnRounds = 2
+			cfg.ChurnOutputs = churnOutputs
+
+			fw := newFundedWallet(t, cfg)
+
+			srv := newTestServiceWithRand(t, cfg, fw, random.NewSeeded(1))
+			srv.createChurnAccount(cfg.ChurnAccountIndex)
+			acct, err := fw.GetAddress(ctx, cfg.WalletName, 0, 0)
+			require.NoError(t, err)
+			source := acct.Addresses[0].Address
+
+			// churn relays and confirms the transfers created by the next scan, returning them by source
+			churn := func(t *testing.T) map[string]db.Transfer {
+				srv.handleGetChurnTick()
+				srv.createTransactions()
+				txs, err := srv.DB().GetUnrelayedTransactions()
+				require.NoError(t, err)
+				bySource := make(map[string]db.Transfer, len(txs))
+				for _, tx := range txs {
+					require.NoError(t, srv.relayScheduled(tx))
+					bySource[tx.SourceAddress] = tx
+				}
+				fw.MineBlocks(client.FakeConfirmationThreshold + 1)
+				srv.trackRelayedTransfers()
+				left, err := srv.DB().GetTransactions()
+				require.NoError(t, err)
+				require.Len(t, left, 0)
+				return bySource
+			}
+
+			// funds entering the churn account are churned again until they reach their target
+			first, ok := churn(t)[source]
+			require.True(t, ok)
+			require.Equal(t, uint(1), first.Round)
+			require.Equal(t, uint(2), first.Target)
+			rec, err := srv.DB().GetChurnRound(first.Destination)
+			require.NoError(t, err)
+			require.Equal(t, uint(1), rec.Round)
+			require.Equal(t, uint(2), rec.Target)
+
+			second, ok := churn(t)[first.Destination]
+			require.True(t, ok)
+			require.Equal(t, uint(2), second.Round)
+			require.Equal(t, uint(2), second.Target)
+			_, err = srv.DB().GetChurnRound(second.Destination)
+			require.Error(t, err)
+			// the second round leaves no change behind in the churn account, where it would never be churned
+			fw.MineBlocks(client.FakeUnlockBlocks)
+			churnAcct, err := fw.GetAddress(ctx, cfg.WalletName, cfg.ChurnAccountIndex, 0)
+			require.NoError(t, err)
+			change, err := fw.AddressBalance(ctx, cfg.WalletName, churnAcct.Addresses[0].Address, cfg.ChurnAccountIndex, 0)
+			require.NoError(t, err)
+			require.Zero(t, change)
+
+			// once settled the funds are not churned again
+			srv.handleGetChurnTick()
+			_, err = srv.DB().GetChurnRound(first.Destination)
+			require.Error(t, err)
+			addrs, err := srv.DB().GetUnscheduledAddresses()
+			require.NoError(t, err)
+			for _, addr := range addrs {
+				require.NotEqual(t, first.Destination, addr.Address)
+				require.NotEqual(t, second.Destination, addr.Address)
+			}
+		})
+	}
+}
+
+func TestServiceChurnRoundOutputs(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	cfg.MinChurnRounds = 2
+	cfg.MaxChurnRounds = 2
+	cfg.ChurnOutputs = true
+
+	fw := newFundedWallet(t, cfg)
+	srv := newTestServiceWithRand(t, cfg, fw, random.NewSeeded(1))
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+
+	// churn relays and confirms the single transfer created by the next scan
+	churn := func(t *testing.T) db.Transfer {
+		srv.handleGetChurnTick()
+		srv.createTransactions()
+		txs, err := srv.DB().GetUnrelayedTransactions()
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+		require.NoError(t, srv.relayScheduled(txs[0]))
+		fw.MineBlocks(client.FakeConfirmationThreshold + 1)
+		srv.trackRelayedTransfers()
+		return txs[0]
+	}
+
+	// a second output received at a churned subaddress
+	first := churn(t)
+	churnAcct, err := fw.GetAddress(ctx, cfg.WalletName, cfg.ChurnAccountIndex)
+	require.NoError(t, err)
+	var index uint64
+	for _, addr := range churnAcct.Addresses {
+		if addr.Address == first.Destination {
+			index = addr.AddressIndex
+		}
+	}
+	require.NotZero(t, index)
+	require.NoError(t, fw.Fund(cfg.ChurnAccountIndex, index, wallet.Float64ToXMR(0.5)))
+	fw.MineBlocks(client.FakeUnlockBlocks)
+	outputs, err := fw.UnspentOutputs(ctx, cfg.WalletName, cfg.ChurnAccountIndex)
+	require.NoError(t, err)
+	amounts := make(map[string]uint64, len(outputs))
+	for _, out := range outputs {
+		if out.Subaddress.Minor == index {
+			amounts[out.KeyImage] = out.Amount
+		}
+	}
+	require.Len(t, amounts, 2)
+
+	// each output is swept on its own in the second round, the subaddress settling once both are churned
+	for i := 0; i < 2; i++ {
+		srv.handleGetChurnTick()
+		addrs, err := srv.DB().GetUnscheduledAddresses()
+		require.NoError(t, err)
+		require.Len(t, addrs, 1)
+		require.False(t, srv.rechurn(addrs[0]))
+		amount, ok := amounts[addrs[0].KeyImage]
+		require.True(t, ok)
+		delete(amounts, addrs[0].KeyImage)
+
+		second := churn(t)
+		require.Equal(t, first.Destination, second.SourceAddress)
+		require.Equal(t, uint(2), second.Round)
+		require.Equal(t, amount, uint64(second.Amount+second.Fee))
+		_, err = srv.DB().GetChurnRound(first.Destination)
+		if i == 0 {
+			require.NoError(t, err)
+		}
+	}
+	srv.handleGetChurnTick()
+	_, err = srv.DB().GetChurnRound(first.Destination)
+	require.Error(t, err)
+	left, err := fw.AddressBalance(ctx, cfg.WalletName, first.Destination, cfg.ChurnAccountIndex, index)
+	require.NoError(t, err)
+	require.Zero(t, left)
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/db"
+	"go.uber.org/zap"
+)
+
+// scheduledTransfer is a single entry in the scheduler's queue
+type scheduledTransfer struct {
+	sourceAddress  string
+	txMetadataHash string
+	sendTime       time.Time
+	index          int // position in the heap, maintained by transferQueue
+}
+
+// transferQueue is a min-heap of scheduled transfers ordered by send time
+type transferQueue []*scheduledTransfer
+
+func (q transferQueue) Len() int { return len(q) }
+
+func (q transferQueue) Less(i, j int) bool { return q[i].sendTime.Before(q[j].sendTime) }
+
+func (q transferQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *transferQueue) Push(x interface{}) {
+	entry := x.(*scheduledTransfer)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *transferQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*q = old[:n-1]
+	return entry
+}
+
+// deferral is returned by the relay function to hold a transfer back until a later time.
+// Unlike other errors it does not count as a failure to relay
+type deferral struct {
+	until  time.Time
+	reason string
+}
+
+func (d *deferral) Error() string {
+	return "relay deferred until " + d.until.Format(time.RFC3339) + ": " + d.reason
+}
+
+// scheduler keeps track of all pending transfers using a single timer that fires
+// at the earliest send time. When the timer fires the database is consulted for
+// sendable transfers, which are relayed one at a time by the relay function.
+// Transfers the relay function fails to relay are requeued, waiting longer after
+// each consecutive failure as given by the backoff function. Transfers it defers
+// are moved to the time it gives, both in the queue and the database.
+type scheduler struct {
+	db       *db.Client
+	relay    func(db.Transfer) error
+	backoff  func(attempt int) time.Duration
+	l        *zap.Logger
+	mux      sync.Mutex
+	queue    transferQueue
+	entries  map[string]*scheduledTransfer
+	failures map[string]int
+	wake     chan struct{}
+}
+
+func newScheduler(l *zap.Logger, dbc *db.Client, relay func(db.Transfer) error, backoff func(attempt int) time.Duration) *scheduler {
+	return &scheduler{
+		db:       dbc,
+		relay:    relay,
+		backoff:  backoff,
+		l:        l.Named("scheduler"),
+		entries:  make(map[string]*scheduledTransfer),
+		failures: make(map[string]int),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func schedulerKey(sourceAddress, txMetadataHash string) string {
+	return sourceAddress + "-" + txMetadataHash
+}
+
+// Load populates the queue with all unrelayed transfers currently in the database. Transfers
+// left built but never given a send time, by a crash while scheduling, are cancelled
+func (sc *scheduler) Load() error {
+	built, err := sc.db.GetTransactionsInState(db.TransferBuilt)
+	if err != nil {
+		return err
+	}
+	for _, tx := range built {
+		sc.l.Warn("cancelling unscheduled transaction", zap.String("metadata.sha256", tx.TxMetadataHash))
+		if err := sc.db.CancelTransaction(tx.SourceAddress, tx.TxMetadataHash); err != nil {
+			return err
+		}
+	}
+	txs, err := sc.db.GetUnrelayedTransactions()
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		sc.Schedule(tx.SourceAddress, tx.TxMetadataHash, tx.SendTime)
+	}
+	return nil
+}
+
+// Schedule adds a transfer to the queue, or updates its send time if already queued
+func (sc *scheduler) Schedule(sourceAddress, txMetadataHash string, sendTime time.Time) {
+	sc.mux.Lock()
+	key := schedulerKey(sourceAddress, txMetadataHash)
+	if entry, ok := sc.entries[key]; ok {
+		entry.sendTime = sendTime
+		heap.Fix(&sc.queue, entry.index)
+	} else {
+		entry := &scheduledTransfer{
+			sourceAddress:  sourceAddress,
+			txMetadataHash: txMetadataHash,
+			sendTime:       sendTime,
+		}
+		heap.Push(&sc.queue, entry)
+		sc.entries[key] = entry
+	}
+	sc.mux.Unlock()
+	sc.notify()
+}
+
+// Cancel removes an unrelayed transfer from the queue, if queued, and from the database,
+// releasing the source address
+func (sc *scheduler) Cancel(sourceAddress, txMetadataHash string) error {
+	sc.remove(sourceAddress, txMetadataHash)
+	return sc.db.CancelTransaction(sourceAddress, txMetadataHash)
+}
+
+// Fail removes a transfer that will never be relayed or confirmed from the queue, if queued,
+// and from the database, releasing the source address
+func (sc *scheduler) Fail(sourceAddress, txMetadataHash string) error {
+	sc.remove(sourceAddress, txMetadataHash)
+	return sc.db.FailTransaction(sourceAddress, txMetadataHash)
+}
+
+// remove drops a transfer from the queue, returning false if it was not queued
+func (sc *scheduler) remove(sourceAddress, txMetadataHash string) bool {
+	sc.mux.Lock()
+	key := schedulerKey(sourceAddress, txMetadataHash)
+	entry, ok := sc.entries[key]
+	if ok {
+		heap.Remove(&sc.queue, entry.index)
+		delete(sc.entries, key)
+	}
+	delete(sc.failures, key)
+	sc.mux.Unlock()
+	if ok {
+		sc.notify()
+	}
+	return ok
+}
+
+// Len returns the number of queued transfers
+func (sc *scheduler) Len() int {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	return sc.queue.Len()
+}
+
+// Run processes the queue until the context is cancelled
+func (sc *scheduler) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sc.wake:
+		case <-timer.C:
+			sc.relayDue(time.Now())
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next, ok := sc.nextSendTime(); ok {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// notify wakes up the run loop so it can recompute the earliest deadline
+func (sc *scheduler) notify() {
+	select {
+	case sc.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sc *scheduler) nextSendTime() (time.Time, bool) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if sc.queue.Len() == 0 {
+		return time.Time{}, false
+	}
+	return sc.queue[0].sendTime, true
+}
+
+// popDue removes all entries from the queue whose send time is at or before now
+func (sc *scheduler) popDue(now time.Time) map[string]*scheduledTransfer {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	due := make(map[string]*scheduledTransfer)
+	for sc.queue.Len() > 0 && !sc.queue[0].sendTime.After(now) {
+		entry := heap.Pop(&sc.queue).(*scheduledTransfer)
+		key := schedulerKey(entry.sourceAddress, entry.txMetadataHash)
+		delete(sc.entries, key)
+		due[key] = entry
+	}
+	return due
+}
+
+// retry requeues a transfer that could not be relayed
+func (sc *scheduler) retry(sourceAddress, txMetadataHash string, err error) {
+	key := schedulerKey(sourceAddress, txMetadataHash)
+	sc.mux.Lock()
+	sc.failures[key]++
+	attempt := sc.failures[key]
+	sc.mux.Unlock()
+	delay := sc.backoff(attempt)
+	sc.l.Warn(
+		"failed to relay transaction, requeueing",
+		zap.String("metadata.sha256", txMetadataHash),
+		zap.Int("attempt", attempt),
+		zap.Duration("backoff", delay),
+		zap.Error(err),
+	)
+	sc.Schedule(sourceAddress, txMetadataHash, time.Now().Add(delay))
+}
+
+// hold moves a transfer that was deferred to the time it was deferred until
+func (sc *scheduler) hold(sourceAddress, txMetadataHash string, d *deferral) {
+	sc.l.Info(
+		"holding back transaction",
+		zap.String("metadata.sha256", txMetadataHash),
+		zap.Time("until", d.until),
+		zap.String("reason", d.reason),
+	)
+	// persisted so that the transfer is still held back after a restart
+	if err := sc.db.ScheduleTransaction(sourceAddress, txMetadataHash, d.until); err != nil {
+		sc.l.Error("failed to update send time", zap.Error(err), zap.String("metadata.sha256", txMetadataHash))
+	}
+	sc.Schedule(sourceAddress, txMetadataHash, d.until)
+}
+
+// relayDue relays every queued transfer whose send time has passed. The database
+// is the source of truth, so anything that was relayed or removed in the meantime is skipped
+func (sc *scheduler) relayDue(now time.Time) {
+	due := sc.popDue(now)
+	if len(due) == 0 {
+		return
+	}
+	txs, err := sc.db.GetSendableTransactions()
+	if err != nil {
+		for _, entry := range due {
+			sc.retry(entry.sourceAddress, entry.txMetadataHash, err)
+		}
+		return
+	}
+	for _, tx := range txs {
+		key := schedulerKey(tx.SourceAddress, tx.TxMetadataHash)
+		if due[key] == nil {
+			continue
+		}
+		if err := sc.relay(tx); err != nil {
+			var d *deferral
+			if errors.As(err, &d) {
+				sc.hold(tx.SourceAddress, tx.TxMetadataHash, d)
+			} else {
+				sc.retry(tx.SourceAddress, tx.TxMetadataHash, err)
+			}
+			continue
+		}
+		sc.mux.Lock()
+		delete(sc.failures, key)
+		sc.mux.Unlock()
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/db"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestScheduler(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	dbc, err := db.NewClient(logger, filepath.Join(t.TempDir(), "scheduler.db"))
+	require.NoError(t, err)
+	require.NoError(t, dbc.Setup())
+	t.Cleanup(func() {
+		require.NoError(t, dbc.Close())
+	})
+
+	var (
+		mux      sync.Mutex
+		relayed  []string
+		failures int
+		held     bool
+	)
+	now := time.Now()
+	holdUntil := now.Add(time.Millisecond * 350)
+	sched := newScheduler(logger, dbc, func(tx db.Transfer) error {
+		mux.Lock()
+		defer mux.Unlock()
+		// flaky fails twice before being relayed
+		if tx.SourceAddress == "flaky" && failures < 2 {
+			failures++
+			return errors.New("connection refused")
+		}
+		// held is deferred once, which must not count as a failure
+		if tx.SourceAddress == "held" && !held {
+			held = true
+			return &deferral{until: holdUntil, reason: "testing"}
+		}
+		relayed = append(relayed, tx.SourceAddress)
+		if _, err := dbc.StartRelay(tx.SourceAddress, tx.TxMetadataHash); err != nil {
+			t.Error(err)
+		}
+		if err := dbc.SetRelayed(tx.SourceAddress, tx.TxMetadataHash, "txhash-"+tx.SourceAddress); err != nil {
+			t.Error(err)
+		}
+		return nil
+	}, func(attempt int) time.Duration {
+		return time.Millisecond * 10 * time.Duration(attempt)
+	})
+
+	txs := []struct {
+		address  string
+		sendTime time.Time
+	}{
+		{"late", now.Add(time.Millisecond * 500)},
+		{"flaky", now.Add(time.Millisecond * 200)},
+		{"held", now.Add(time.Millisecond * 20)},
+		{"cancelled", now.Add(time.Millisecond * 100)},
+		{"early", now.Add(time.Millisecond * 50)},
+		{"overdue", now.Add(-time.Minute)},
+	}
+	for _, tx := range txs {
+		require.NoError(t, dbc.AddAddress("wallet", tx.address, "base", 0, 0, 100))
+		require.NoError(t, dbc.BuildTransaction(tx.address, "", "meta-"+tx.address, "hash-"+tx.address, "", 0, 0))
+		require.NoError(t, dbc.ScheduleTransaction(tx.address, "hash-"+tx.address, tx.sendTime))
+	}
+	// a transfer never given a send time is cancelled on load
+	require.NoError(t, dbc.AddAddress("wallet", "built", "base", 0, 0, 100))
+	require.NoError(t, dbc.BuildTransaction("built", "", "meta-built", "hash-built", "", 0, 0))
+	// overdue is loaded from the database, the rest are scheduled directly
+	require.NoError(t, sched.Load())
+	require.Equal(t, 6, sched.Len())
+
+	require.NoError(t, sched.Cancel("cancelled", "hash-cancelled"))
+	require.Equal(t, 5, sched.Len())
+	require.Error(t, sched.Cancel("cancelled", "hash-cancelled"))
+	require.False(t, sched.remove("cancelled", "hash-cancelled"))
+	addr, err := dbc.GetAddress("cancelled")
+	require.NoError(t, err)
+	require.Equal(t, db.AddressDiscovered, addr.State)
+	addr, err = dbc.GetAddress("built")
+	require.NoError(t, err)
+	require.Equal(t, db.AddressDiscovered, addr.State)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sched.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return len(relayed) == 5
+	}, time.Second*5, time.Millisecond*10)
+	require.Equal(t, []string{"overdue", "early", "flaky", "held", "late"}, relayed)
+	require.Equal(t, 2, failures)
+	tx, err := dbc.GetTransaction("held", "hash-held")
+	require.NoError(t, err)
+	require.True(t, tx.SendTime.Equal(holdUntil))
+	require.Equal(t, 0, sched.Len())
+
+	unrelayed, err := dbc.GetUnrelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, unrelayed, 0)
+}
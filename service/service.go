@@ -4,13 +4,16 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"math/rand"
-	"strings"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/bonedaddy/mychurnero/client"
 	"github.com/bonedaddy/mychurnero/config"
 	"github.com/bonedaddy/mychurnero/db"
+	"github.com/bonedaddy/mychurnero/random"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
 	"go.bobheadxi.dev/zapx/zapx"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
@@ -19,55 +22,240 @@ import (
 // Service provides monero churning service that takes care of automatically scanning the wallet
 // determining which addresses need to be churned, and scheduling the sending of those addresses
 type Service struct {
-	mc     *client.Client
-	db     *db.Client
-	ctx    context.Context
-	cancel context.CancelFunc
-	cfg    *config.Config
-	l      *zap.Logger
+	mc      client.WalletRPC
+	db      *db.Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+	cfg     *config.Config
+	l       *zap.Logger
+	sched   *scheduler
+	breaker *circuitBreaker
+	retry   retryPolicy
+	feeCap  feeCap
+	budget  *feeBudget
+	// the monerod used by the wallet, nil if no daemon address is configured
+	daemon *client.Daemon
+	// chooses the priority of new transactions
+	priority client.PriorityPolicy
+	// chooses how long to wait before relaying new transactions
+	delays config.DelayDistribution
+	// the source of every random choice
+	rand random.Source
+	// the range the number of rounds new funds are churned for is chosen from
+	minRounds, maxRounds uint
+	// the range the number of blocks an output must age before it is churned is chosen from
+	minAge, maxAge uint64
+	// the ring size required by consensus, resolved at startup
+	ringSize uint64
+	// held while relaying, so that a relay in flight is never reconciled
+	relayMux sync.Mutex
 }
 
 // New returns a new Service starting all needed internal subprocesses
 func New(ctx context.Context, cfg *config.Config) (*Service, error) {
-	// seed random number generation
-	rand.Seed(time.Now().UnixNano())
+	cl, err := client.NewClient(cfg.RPCAddress, ClientOptions(cfg)...)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithWallet(ctx, cfg, cl)
+}
+
+// ClientOptions returns the options used to connect to the monero-wallet-rpc described by cfg
+func ClientOptions(cfg *config.Config) []client.Option {
+	opts := []client.Option{
+		client.WithDigestAuth(cfg.RPCUsername, cfg.RPCPassword),
+		client.WithTLS(client.TLSOptions{
+			CACertPath:   cfg.RPCCACert,
+			CertPath:     cfg.RPCClientCert,
+			KeyPath:      cfg.RPCClientKey,
+			Fingerprints: cfg.RPCCertFingerprints,
+		}),
+		client.WithProxy(cfg.ProxyURL),
+		client.WithTimeouts(client.Timeouts{
+			Scan:    cfg.ScanTimeout,
+			Create:  cfg.CreateTimeout,
+			Relay:   cfg.RelayTimeout,
+			Confirm: cfg.ConfirmTimeout,
+		}),
+	}
+	if cfg.RPCWalletFile {
+		opts = append(opts, client.WithWalletFile())
+	}
+	return opts
+}
+
+// DaemonOptions returns the options used to connect to the monerod described by cfg
+func DaemonOptions(cfg *config.Config) []client.Option {
+	return []client.Option{
+		client.WithDigestAuth(cfg.DaemonUsername, cfg.DaemonPassword),
+		client.WithTLS(client.TLSOptions{
+			CACertPath:   cfg.DaemonCACert,
+			CertPath:     cfg.DaemonClientCert,
+			KeyPath:      cfg.DaemonClientKey,
+			Fingerprints: cfg.DaemonCertFingerprints,
+		}),
+		client.WithProxy(cfg.ProxyURL),
+		client.WithTimeouts(client.Timeouts{
+			Scan:    cfg.ScanTimeout,
+			Create:  cfg.CreateTimeout,
+			Relay:   cfg.RelayTimeout,
+			Confirm: cfg.ConfirmTimeout,
+		}),
+	}
+}
+
+// newDaemon returns a client for cfg.DaemonAddress, or nil if no daemon is configured
+func newDaemon(cfg *config.Config) (*client.Daemon, error) {
+	if cfg.DaemonAddress == "" {
+		return nil, nil
+	}
+	return client.NewDaemon(cfg.DaemonAddress, DaemonOptions(cfg)...)
+}
+
+// NewPriorityPolicy returns the priority policy described by cfg, drawing random choices
+// from src. The network policy requires a daemon
+func NewPriorityPolicy(cfg *config.Config, daemon *client.Daemon, src random.Source) (client.PriorityPolicy, error) {
+	switch cfg.PriorityPolicy {
+	case "fixed":
+		if cfg.Priority > uint(client.PriorityHighest) {
+			return nil, fmt.Errorf("invalid priority %d", cfg.Priority)
+		}
+		return client.FixedPriority(cfg.Priority), nil
+	case "", "weighted":
+		weights := client.PriorityWeights(cfg.PriorityWeights)
+		if len(weights) == 0 {
+			weights = client.DefaultPriorityWeights
+		}
+		return client.WeightedPriority{Weights: weights, Rand: src}, weights.Validate()
+	case "network":
+		if daemon == nil {
+			return nil, errors.New("the network priority policy requires a daemon address")
+		}
+		return client.NetworkPriority{Daemon: daemon, Fallback: wallet.Priority(cfg.Priority)}, nil
+	default:
+		return nil, fmt.Errorf("unknown priority policy %q", cfg.PriorityPolicy)
+	}
+}
+
+// NewWithWallet is like New, but uses the given wallet instead of connecting to cfg.RPCAddress.
+// The wallet is closed along with the service
+func NewWithWallet(ctx context.Context, cfg *config.Config, cl client.WalletRPC) (*Service, error) {
+	return NewWithRand(ctx, cfg, cl, random.NewSecure())
+}
 
+// NewWithRand is like NewWithWallet, but draws every random choice from src. Outside of
+// tests src must be cryptographically secure, or the churns can be predicted
+func NewWithRand(ctx context.Context, cfg *config.Config, cl client.WalletRPC, src random.Source) (*Service, error) {
 	l, err := zapx.New(cfg.LogPath, true)
 	if err != nil {
+		cl.Close()
 		return nil, err
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-
-	cl, err := client.NewClient(cfg.RPCAddress)
+	daemon, err := newDaemon(cfg)
 	if err != nil {
-		cancel()
+		cl.Close()
+		return nil, err
+	}
+	priority, err := NewPriorityPolicy(cfg, daemon, src)
+	if err != nil {
+		cl.Close()
+		return nil, err
+	}
+	delays, err := cfg.Delays()
+	if err != nil {
+		cl.Close()
+		return nil, err
+	}
+	minRounds, maxRounds, err := cfg.ChurnRounds()
+	if err != nil {
+		cl.Close()
+		return nil, err
+	}
+	minAge, maxAge, err := cfg.OutputAges()
+	if err != nil {
+		cl.Close()
+		return nil, err
+	}
+	ringSize, err := client.ResolveRingSize(ctx, daemon, cfg.RingSize)
+	if err != nil {
+		cl.Close()
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+
 	// open the wallet
-	if err := cl.OpenWallet(cfg.WalletName); err != nil {
+	if err := cl.OpenWallet(ctx, cfg.WalletName); err != nil {
 		cancel()
 		cl.Close()
 		return nil, err
 	}
 
-	db, err := db.NewClient(l, cfg.DBPath)
+	dbc, err := db.NewClient(l, cfg.DBPath)
 	if err != nil {
 		cancel()
 		cl.Close()
 		return nil, err
 	}
-	db.Setup()
+	if err := dbc.Setup(); err != nil {
+		cancel()
+		dbc.Close()
+		cl.Close()
+		return nil, err
+	}
 
-	return &Service{cl, db, ctx, cancel, cfg, l.Named("service")}, nil
+	srv := &Service{mc: cl, db: dbc, ctx: ctx, cancel: cancel, cfg: cfg, l: l.Named("service"), ringSize: ringSize, priority: priority, delays: delays, rand: src, daemon: daemon}
+	srv.minRounds, srv.maxRounds = minRounds, maxRounds
+	srv.minAge, srv.maxAge = minAge, maxAge
+	srv.l.Info("using ring size", zap.Uint64("ring.size", ringSize))
+	if daemon == nil && cfg.RingSize == 0 {
+		srv.l.Warn("no daemon address is set, assuming the default ring size which the network may no longer accept", zap.Uint64("ring.size", ringSize))
+	}
+	srv.checkDaemonSync()
+	srv.breaker = newCircuitBreaker(srv.l, cfg.BreakerThreshold, cfg.BreakerCooldown)
+	srv.retry = retryPolicy{
+		maxAttempts: cfg.RetryMaxAttempts,
+		minBackoff:  cfg.RetryMinBackoff,
+		maxBackoff:  cfg.RetryMaxBackoff,
+		rand:        src,
+	}
+	srv.budget = newFeeBudget(dbc, cfg.DailyFeeBudget, cfg.MonthlyFeeBudget)
+	// a transaction paying more than a whole budget window allows could never be relayed
+	srv.feeCap = feeCap{maxFee: cfg.MaxFeePerTx, maxRatio: cfg.MaxFeeRatio}
+	if limit := srv.budget.maxFee(); limit > 0 && (srv.feeCap.maxFee == 0 || limit < srv.feeCap.maxFee) {
+		srv.feeCap.maxFee = limit
+	}
+	srv.sched = newScheduler(srv.l, dbc, srv.relayScheduled, srv.relayBackoff)
+	return srv, nil
 }
 
 // MC returns the underlying monero-wallet-rpc client
-func (s *Service) MC() *client.Client {
+func (s *Service) MC() client.WalletRPC {
 	return s.mc
 }
 
+// Daemon returns the monerod client, or nil if no daemon address is configured
+func (s *Service) Daemon() *client.Daemon {
+	return s.daemon
+}
+
+// checkDaemonSync warns if the daemon has not caught up with the network, since
+// balances and confirmations seen through it are then out of date
+func (s *Service) checkDaemonSync() {
+	if s.daemon == nil {
+		return
+	}
+	info, err := s.daemon.Info(s.ctx)
+	if err != nil {
+		s.l.Warn("failed to get daemon info", zap.Error(err))
+		return
+	}
+	if !info.Synced() {
+		s.l.Warn("daemon is not synchronized", zap.Uint64("height", info.Height), zap.Uint64("target.height", info.TargetHeight))
+	}
+}
+
 // DB returns the underlying database client
 func (s *Service) DB() *db.Client {
 	return s.db
@@ -83,7 +271,13 @@ func (s *Service) Start() {
 
 	s.createChurnAccount(s.cfg.ChurnAccountIndex)
 	s.l.Info("mychurnero started")
-	s.rescheduleTransactions()
+	// repair anything left behind by an unclean shutdown before loading the schedule
+	s.reconcile()
+	// load any transactions that were scheduled before a restart
+	if err := s.sched.Load(); err != nil {
+		s.l.Error("failed to load scheduled transactions", zap.Error(err))
+	}
+	go s.sched.Run(s.ctx)
 	go func() {
 		// call the ticker functions manually first
 		// since if we dont do this this we have to wait
@@ -104,7 +298,9 @@ func (s *Service) Start() {
 			select {
 			case <-deleteTxTicker.C:
 				s.l.Info("handling tx confirmation checks")
-				s.deleteSpentTransfers()
+				// relays whose outcome could not be checked when they failed
+				s.reconcileRelays()
+				s.trackRelayedTransfers()
 
 			case <-getChurnTicker.C:
 				s.l.Info("getting churnable addresses")
@@ -137,51 +333,134 @@ func (s *Service) Close() error {
 	return closeErr
 }
 
-// creates the account to churn funds ti if it does not exist
+// creates the account to churn funds to if it does not exist. A failed attempt may still have
+// created the account, so the accounts are listed again before creating it another time
 func (s *Service) createChurnAccount(churnAccountIndex uint64) {
-	accts, err := s.mc.GetAccounts(s.cfg.WalletName)
-	if err != nil {
-		s.l.Error("failed to get all accounts", zap.Error(err))
-		return
-	}
+	for attempt := 1; ; attempt++ {
+		var accts *wallet.ResponseGetAccounts
+		err := s.call("get_accounts", func(ctx context.Context) error {
+			var err error
+			accts, err = s.mc.GetAccounts(ctx, s.cfg.WalletName)
+			return err
+		})
+		if err != nil {
+			s.l.Error("failed to get all accounts", zap.Error(err))
+			return
+		}
 
-	var churnAcctExists bool
-	for _, subacct := range accts.SubaddressAccounts {
-		if subacct.AccountIndex == churnAccountIndex {
-			churnAcctExists = true
+		for _, subacct := range accts.SubaddressAccounts {
+			if subacct.AccountIndex == churnAccountIndex {
+				return
+			}
 		}
-	}
 
-	if !churnAcctExists {
-		resp, err := s.mc.NewAccount(s.cfg.WalletName, "churn-account")
-		if err != nil {
+		var resp *wallet.ResponseCreateAccount
+		err = s.callOnce("create_account", func(ctx context.Context) error {
+			var err error
+			resp, err = s.mc.NewAccount(ctx, s.cfg.WalletName, "churn-account")
+			return err
+		})
+		if err == nil {
+			if resp.AccountIndex != churnAccountIndex {
+				s.l.Warn("new created account does not match desried churn account index")
+			}
+			return
+		}
+		if !isTransient(err) && !errors.Is(err, client.ErrWalletNotOpen) || attempt >= s.retry.maxAttempts {
 			s.l.Error("failed to create churn account", zap.Error(err))
 			return
 		}
-		if resp.AccountIndex != churnAccountIndex {
-			s.l.Warn("new created account does not match desried churn account index")
+		delay := s.retry.backoff(attempt)
+		s.l.Warn("failed to create churn account, checking accounts again", zap.Duration("backoff", delay), zap.Error(err))
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
 			return
 		}
 	}
 }
 
-// returns an address we can use to send churned funds to
+// returns an address we can use to send churned funds to, preferring a
+// churn account subaddress that was created before but never used
 func (s *Service) getChurnToAddress() (string, error) {
-	return s.mc.NewAddress(s.cfg.WalletName, s.cfg.ChurnAccountIndex)
+	addr, err := s.db.TakeSpareAddress()
+	if err != nil {
+		s.l.Warn("failed to get spare churn address", zap.Error(err))
+	}
+	if addr != "" {
+		return addr, nil
+	}
+	// not retried, as a failed attempt may have created an address that would then be skipped
+	err = s.callOnce("create_address", func(ctx context.Context) error {
+		var err error
+		addr, err = s.mc.NewAddress(ctx, s.cfg.WalletName, s.cfg.ChurnAccountIndex)
+		return err
+	})
+	return addr, err
+}
+
+// keepSpareAddress records a churn to address that no transaction was built for, so that it is used next
+func (s *Service) keepSpareAddress(addr string) {
+	if err := s.db.AddSpareAddress(addr); err != nil {
+		s.l.Warn("failed to record spare churn address", zap.Error(err))
+	}
+}
+
+// walletAvailable returns false while the circuit breaker is open, logging that work is being skipped
+func (s *Service) walletAvailable(op string) bool {
+	if s.breaker.Ready() {
+		return true
+	}
+	s.l.Warn("wallet rpc unavailable, skipping", zap.String("op", op))
+	return false
 }
 
 func (s *Service) handleGetChurnTick() {
-	addrs, err := s.mc.GetChurnableAddresses(
-		s.cfg.WalletName,
-		s.cfg.ChurnAccountIndex,
-		s.cfg.MinChurnAmount,
-	)
+	if !s.walletAvailable("scan") {
+		return
+	}
+	elig, err := s.scanEligibility()
 	if err != nil {
+		s.l.Error("failed to check which outputs are old enough to churn", zap.Error(err))
 		return
 	}
 	var toChurn int
+	if s.cfg.ChurnOutputs {
+		toChurn = s.scanOutputs(elig)
+	} else {
+		toChurn = s.scanAddresses(elig)
+	}
+	toChurn += s.scanChurnRounds(elig)
+	if toChurn > 0 {
+		s.l.Info("churnable addresses found", zap.Int("count", toChurn))
+	}
+}
+
+// scanAddresses adds subaddresses outside of the churn account with a balance to churn to the
+// database, returning how many were added. Those with unlocked outputs too young to churn are
+// left for a later scan, as the wallet may pick any of them as inputs
+func (s *Service) scanAddresses(elig *eligibility) int {
+	var addrs *client.ChurnableAccounts
+	err := s.call("get_churnable_addresses", func(ctx context.Context) error {
+		var err error
+		addrs, err = s.mc.GetChurnableAddresses(
+			ctx,
+			s.cfg.WalletName,
+			s.cfg.ChurnAccountIndex,
+			s.cfg.MinChurnAmount,
+		)
+		return err
+	})
+	if err != nil {
+		s.l.Error("failed to get churnable addresses", zap.Error(err))
+		return 0
+	}
+	var toChurn int
 	for _, acct := range addrs.Accounts {
 		for _, sub := range acct.Subaddresses {
+			if !elig.address(acct.AccountIndex, sub.AddressIndex) {
+				continue
+			}
 			if err := s.db.AddAddress(
 				s.cfg.WalletName,
 				sub.Address,
@@ -200,9 +479,50 @@ func (s *Service) handleGetChurnTick() {
 			}
 		}
 	}
-	if toChurn > 0 {
-		s.l.Info("churnable addresses found", zap.Int("count", toChurn))
+	return toChurn
+}
+
+// scanOutputs adds a single unlocked output old enough to churn of each subaddress outside of the
+// churn account to the database, returning how many were added. Further outputs of a subaddress
+// are churned once the churn of the first has confirmed
+func (s *Service) scanOutputs(elig *eligibility) int {
+	var outputs []client.ChurnableOutput
+	err := s.call("incoming_transfers", func(ctx context.Context) error {
+		var err error
+		outputs, err = s.mc.GetChurnableOutputs(
+			ctx,
+			s.cfg.WalletName,
+			s.cfg.ChurnAccountIndex,
+			s.cfg.MinChurnAmount,
+		)
+		return err
+	})
+	if err != nil {
+		s.l.Error("failed to get churnable outputs", zap.Error(err))
+		return 0
 	}
+	var toChurn int
+	seen := make(map[string]bool, len(outputs))
+	for _, out := range outputs {
+		if seen[out.Address] || !elig.output(out.KeyImage) {
+			continue
+		}
+		seen[out.Address] = true
+		if err := s.db.AddOutput(
+			s.cfg.WalletName,
+			out.Address,
+			out.BaseAddress,
+			out.KeyImage,
+			out.AccountIndex,
+			out.AddressIndex,
+			out.Amount,
+		); err != nil {
+			s.l.Error("failed to add output to database", zap.String("address", out.Address), zap.Error(err))
+			continue
+		}
+		toChurn++
+	}
+	return toChurn
 }
 
 func (s *Service) createTransactions() {
@@ -212,61 +532,83 @@ func (s *Service) createTransactions() {
 	}
 
 	for _, addr := range addrs {
+		if !s.walletAvailable("create") {
+			return
+		}
+		if s.cfg.JustInTime {
+			s.planTransaction(addr)
+			continue
+		}
 
-		metaDataHashes := s.handleCreateTx(addr)
-		if metaDataHashes == nil {
+		created := s.handleCreateTx(addr)
+		if created == nil {
 			continue
 		}
+		round, target := s.chooseRound(addr)
+		for _, tx := range created {
+			s.scheduleCreated(addr, tx, round, target)
+		}
+	}
+}
 
-		for _, meta := range metaDataHashes {
+// scheduleCreated stores a transaction created to churn addr and schedules it to be relayed after a random delay
+func (s *Service) scheduleCreated(addr db.Address, tx createdTx, round, target uint64) {
+	txMetaHash := s.hashMetadata(tx.metadata)
+	delay := s.delays.Delay(s.rand)
+	sendTime := time.Now().Add(delay)
 
-			txMetaHash := s.hashMetadata(meta)
-			delay := s.getRandomSendDelay()
-			sendTime := time.Now().Add(delay)
+	s.l.Info(
+		"unrelayed transaction created",
+		zap.String("metadata.sha256", txMetaHash),
+		zap.Uint64("fee", tx.fee),
+		zap.Float64("delay.minutes", delay.Minutes()),
+	)
 
-			s.l.Info(
-				"unrelayed transaction created",
-				zap.String("metadata.sha256", txMetaHash),
-				zap.Float64("delay.minutes", delay.Minutes()),
-			)
+	if err := s.db.BuildTransaction(
+		addr.Address,
+		tx.destination,
+		tx.metadata,
+		txMetaHash,
+		tx.hash,
+		tx.amount,
+		tx.fee,
+	); err != nil {
+		s.l.Error(
+			"failed to store transaction",
+			zap.Error(err),
+			zap.String("metadata.sha256", txMetaHash),
+		)
+		return
+	}
+	s.scheduleBuilt(addr, txMetaHash, round, target, sendTime)
+}
 
-			if err := s.db.ScheduleTransaction(
-				addr.Address,
-				meta,
-				txMetaHash,
-				sendTime,
-			); err != nil {
-				s.l.Error(
-					"failed to schedule transaction",
-					zap.Error(err),
-					zap.String("metadata.sha256", txMetaHash),
-				)
-				continue
-			}
-			// TODO(bonedaddy): enable better scheduling instead of creating a bunch of goroutiens
-			go func(sourceAddr string) {
-				now := time.Now()
-				diff := sendTime.Sub(now)
-				ticker := time.NewTicker(diff)
-				<-ticker.C
-				ticker.Stop()
-				tx, err := s.db.GetTransaction(sourceAddr, txMetaHash)
-				if err != nil {
-					s.l.Error(
-						"failed to get transaction from database",
-						zap.Error(err),
-						zap.String("metadata.sha256", txMetaHash),
-					)
-					return
-				}
-				s.relayTx(sourceAddr, tx.TxMetadata, txMetaHash)
-			}(addr.Address)
-		}
-
-	}
-}
-
-func (s *Service) deleteSpentTransfers() {
+// scheduleBuilt records the churn round of a built transfer and schedules it to be relayed at
+// sendTime, cancelling the transfer if either fails. The outputs it may spend are frozen until then
+func (s *Service) scheduleBuilt(addr db.Address, metaHash string, round, target uint64, sendTime time.Time) {
+	sourceAddress := addr.Address
+	err := s.db.SetRound(sourceAddress, metaHash, round, target)
+	if err == nil {
+		err = s.db.ScheduleTransaction(sourceAddress, metaHash, sendTime)
+	}
+	if err != nil {
+		s.l.Error(
+			"failed to schedule transaction",
+			zap.Error(err),
+			zap.String("metadata.sha256", metaHash),
+		)
+		if err := s.sched.Cancel(sourceAddress, metaHash); err != nil {
+			s.l.Error("failed to cancel transaction", zap.Error(err), zap.String("metadata.sha256", metaHash))
+		}
+		return
+	}
+	s.freezeInputs(addr)
+	s.sched.Schedule(sourceAddress, metaHash, sendTime)
+}
+
+// trackRelayedTransfers checks the status of every relayed transfer. Transfers are deleted
+// once final, and failed transfers release their source address so that it is churned again
+func (s *Service) trackRelayedTransfers() {
 	txs, err := s.db.GetRelayedTransactions()
 	if err != nil {
 		s.l.Error(
@@ -277,7 +619,15 @@ func (s *Service) deleteSpentTransfers() {
 	}
 
 	for _, tx := range txs {
-		confirmed, err := s.mc.TxConfirmed(s.cfg.WalletName, tx.TxHash)
+		if !s.walletAvailable("confirm") {
+			return
+		}
+		var status *client.TxStatus
+		err := s.call("get_transfer_by_txid", func(ctx context.Context) error {
+			var err error
+			status, err = s.mc.TxStatus(ctx, s.cfg.WalletName, tx.TxHash)
+			return err
+		})
 		if err != nil {
 			s.l.Error(
 				"failed to get tx confirmation status",
@@ -287,12 +637,23 @@ func (s *Service) deleteSpentTransfers() {
 			continue
 		}
 
-		if confirmed {
-			if err := s.db.DeleteTransaction(
-				tx.SourceAddress,
-				tx.TxHash,
-				tx.TxMetadataHash,
-			); err != nil {
+		switch status.State {
+		case client.TxPending:
+			if tx.State == db.TransferConfirmed {
+				// the block it was mined in was orphaned
+				s.setConfirmed(tx, false)
+			}
+			if status.DoubleSpendSeen {
+				s.l.Warn("double spend seen for pending transaction", zap.String("tx.hash", tx.TxHash))
+			}
+		case client.TxConfirmed:
+			if tx.State == db.TransferRelayed && !s.setConfirmed(tx, true) {
+				continue
+			}
+			if !status.Final() {
+				continue
+			}
+			if err := s.db.PurgeTransaction(tx.SourceAddress, tx.TxMetadataHash); err != nil {
 				s.l.Error(
 					"failed to delete transaction from database",
 					zap.Error(err),
@@ -300,34 +661,57 @@ func (s *Service) deleteSpentTransfers() {
 				)
 				continue
 			}
-			s.l.Error("transaction purged from database", zap.String("tx.hash", tx.TxHash))
+			s.l.Info("transaction purged from database", zap.String("tx.hash", tx.TxHash))
+		case client.TxFailed:
+			s.failTransfer(tx, "transaction failed")
+		case client.TxUnknown:
+			if s.droppedByDaemon(tx.TxHash) {
+				s.failTransfer(tx, "transaction unknown to wallet and daemon")
+				continue
+			}
+			s.l.Warn("transaction unknown to wallet", zap.String("tx.hash", tx.TxHash))
 		}
+	}
+}
 
+// setConfirmed records whether a relayed transfer has been mined, returning false on failure
+func (s *Service) setConfirmed(tx db.Transfer, confirmed bool) bool {
+	if err := s.db.SetConfirmed(tx.SourceAddress, tx.TxMetadataHash, confirmed); err != nil {
+		s.l.Error("failed to update transaction state", zap.Error(err), zap.String("tx.hash", tx.TxHash))
+		return false
 	}
+	return true
 }
 
-// rescheduleTransactions should only be used at startup to see
-// if any existing unrelayed transactions are stored in the database, and if so
-// send it
-func (s *Service) rescheduleTransactions() error {
-	txs, err := s.db.GetUnrelayedTransactions()
+// droppedByDaemon returns whether the daemon has no record of the transaction. Without
+// a daemon this can not be told, so the transaction is assumed to still exist
+func (s *Service) droppedByDaemon(txHash string) bool {
+	if s.daemon == nil {
+		return false
+	}
+	_, missed, err := s.daemon.Transactions(s.ctx, []string{txHash})
 	if err != nil {
-		return err
+		s.l.Error("failed to get transaction from daemon", zap.Error(err), zap.String("tx.hash", txHash))
+		return false
 	}
-	for _, tx := range txs {
-		tx := tx
-		go func() {
-			now := time.Now()
-			if now.After(tx.SendTime) {
-				goto SEND
-			}
-			time.Sleep(tx.SendTime.Sub(now))
-			goto SEND
-		SEND:
-			s.relayTx(tx.SourceAddress, tx.TxMetadata, tx.TxMetadataHash)
-		}()
+	return len(missed) > 0
+}
+
+// failTransfer removes a transfer that will never confirm, so that its
+// source address is churned again
+func (s *Service) failTransfer(tx db.Transfer, reason string) {
+	if err := s.sched.Fail(tx.SourceAddress, tx.TxMetadataHash); err != nil {
+		s.l.Error(
+			"failed to release transaction",
+			zap.Error(err),
+			zap.String("tx.hash", tx.TxHash),
+			zap.String("metadata.sha256", tx.TxMetadataHash),
+		)
+		return
 	}
-	return nil
+	s.l.Warn("releasing source address", zap.String("reason", reason), zap.String("tx.hash", tx.TxHash))
+	// inputs are thawed before relaying, but may have been frozen again for a churn since cancelled
+	s.thawInputs(tx.SourceAddress)
 }
 
 func (s *Service) hashMetadata(txMetadata string) string {
@@ -335,97 +719,392 @@ func (s *Service) hashMetadata(txMetadata string) string {
 	return hex.EncodeToString(hashed[:])
 }
 
-func (s *Service) getRandomSendDelay() time.Duration {
-	random := rand.Int63n(s.cfg.MaxDelayMinutes-s.cfg.MinDelayMinutes+1) + s.cfg.MinDelayMinutes
-	dur := time.Duration(random) * time.Minute
-	return dur
+// sendAmount returns the amount to churn from addr, which is all of it when churning a single output
+// or funds already churned. It returns 0 if the address can not be churned yet
+func (s *Service) sendAmount(addr db.Address) uint64 {
+	if addr.KeyImage != "" || s.rechurn(addr) {
+		return uint64(addr.Balance)
+	}
+	reserve, err := s.feeReserve(addr)
+	if err != nil {
+		s.l.Warn("failed to estimate the fee, skipping address", zap.String("sender.address", addr.Address), zap.Error(err))
+		return 0
+	}
+	amount := s.getRandomBalance(uint64(addr.Balance), reserve)
+	if amount == 0 {
+		// the address is tried again on the next scan, by which time it may have received more
+		s.l.Info(
+			"balance too small to churn once the fee is paid",
+			zap.String("sender.address", addr.Address),
+			zap.Uint("balance", addr.Balance),
+			zap.Uint64("fee.reserve", reserve),
+		)
+	}
+	return amount
+}
+
+// feeReserve returns how much of the balance of addr to keep back for the fee when sending part of it,
+// the fee the wallet estimates for spending all of it at the highest priority. A transfer of part of
+// the balance spends no more inputs, and is never built at a higher priority
+func (s *Service) feeReserve(addr db.Address) (uint64, error) {
+	var fee uint64
+	err := s.call("estimate_fee", func(ctx context.Context) error {
+		var err error
+		fee, err = s.mc.EstimateFee(ctx, client.TransferOpts{
+			Priority:       client.PriorityHighest,
+			Destinations:   map[string]uint64{addr.Address: 0},
+			AccountIndex:   uint64(addr.AccountIndex),
+			SubaddrIndices: []uint64{uint64(addr.AddressIndex)},
+			WalletName:     s.cfg.WalletName,
+			RingSize:       s.ringSize,
+		})
+		return err
+	})
+	return fee, err
 }
 
-// returns random balance to send
-func (s *Service) getRandomBalance(currentBalance uint64) uint64 {
-	if currentBalance < s.cfg.MinChurnAmount {
+// returns random balance to send, leaving reserve for the fee so that the wallet does not refuse
+// the transfer. Returns 0 if the balance can not cover both the minimum churn amount and the fee
+func (s *Service) getRandomBalance(currentBalance, reserve uint64) uint64 {
+	if currentBalance < s.cfg.MinChurnAmount+reserve {
 		return 0
-	} else if currentBalance == s.cfg.MinChurnAmount {
-		return currentBalance
 	}
-	return uint64(rand.Int63n(
-		int64(currentBalance)-int64(s.cfg.MinChurnAmount)+1,
+	return uint64(s.rand.Int63n(
+		int64(currentBalance-reserve-s.cfg.MinChurnAmount)+1,
 	) + int64(s.cfg.MinChurnAmount))
 }
 
-func (s *Service) relayTx(sourceAddr, txData, metaHash string) {
-	txHash, err := s.mc.Relay(s.cfg.WalletName, txData)
+// relayBackoff returns how long the scheduler waits before retrying a relay that failed attempt times.
+// While the circuit breaker is open this is at least the breaker's cooldown
+func (s *Service) relayBackoff(attempt int) time.Duration {
+	delay := s.retry.backoff(attempt)
+	if s.breaker.State() != breakerClosed && delay < s.cfg.BreakerCooldown {
+		delay = s.cfg.BreakerCooldown
+	}
+	return delay
+}
+
+// relayScheduled relays a scheduled transfer, holding it back if its fee does not fit the fee budget.
+// Planned transfers, and those whose metadata has grown stale, are built first. The wallet will not
+// spend frozen outputs, so they are thawed beforehand and frozen again should the transfer remain scheduled
+func (s *Service) relayScheduled(tx db.Transfer) error {
+	s.thawInputs(tx.SourceAddress)
+	defer s.refreezeInputs(tx.SourceAddress)
+	return s.relayThawed(tx)
+}
+
+// relayThawed relays a scheduled transfer whose inputs have been thawed
+func (s *Service) relayThawed(tx db.Transfer) error {
+	if s.needsBuild(tx) {
+		built, err := s.rebuildTx(tx)
+		if err != nil || built == nil {
+			return err
+		}
+		tx = *built
+	}
+	fee := uint64(tx.Fee)
+	if limit := s.budget.maxFee(); limit > 0 && fee > limit {
+		// only possible if the budget was lowered after the transfer was created
+		s.l.Warn("transaction fee is above the fee budget, unscheduling", zap.String("metadata.sha256", tx.TxMetadataHash))
+		if err := s.sched.Cancel(tx.SourceAddress, tx.TxMetadataHash); err != nil {
+			s.l.Error("failed to unschedule transaction", zap.Error(err), zap.String("metadata.sha256", tx.TxMetadataHash))
+		}
+		return nil
+	}
+	held, err := s.budget.hold(fee, time.Now())
 	if err != nil {
-		s.l.Error("failed to relay transaction", zap.Error(err), zap.String("metadata.sha256", metaHash))
-		return
+		return err
+	}
+	if held != nil {
+		return held
+	}
+	return s.relayTx(tx.SourceAddress, tx.TxMetadataHash)
+}
+
+// relayTx relays the scheduled transaction, returning an error if it should be retried later
+func (s *Service) relayTx(sourceAddr, metaHash string) error {
+	s.relayMux.Lock()
+	defer s.relayMux.Unlock()
+	tx, err := s.db.StartRelay(sourceAddr, metaHash)
+	if err != nil {
+		s.l.Error("failed to start relaying transaction", zap.Error(err), zap.String("metadata.sha256", metaHash))
+		return nil
 	}
-	if err := s.db.SetTxHash(sourceAddr, metaHash, txHash); err != nil {
+	var txHash string
+	// relaying is not idempotent, so a failed relay is never repeated before checking whether it went through
+	err = s.callOnce("relay_tx", func(ctx context.Context) error {
+		var err error
+		txHash, err = s.mc.Relay(ctx, s.cfg.WalletName, tx.TxMetadata)
+		return err
+	})
+	switch {
+	case err == nil:
+	case s.ctx.Err() != nil:
+		// shutting down, the transfer is left relaying to be reconciled on the next startup
+		return nil
+	case errors.Is(err, errCircuitOpen) || errors.Is(err, client.ErrWalletNotOpen):
+		// the wallet was never asked to relay, so the transfer goes back on the schedule to be retried
+		if err := s.db.ScheduleTransaction(sourceAddr, metaHash, tx.SendTime); err != nil {
+			s.l.Error("failed to reschedule transaction", zap.Error(err), zap.String("metadata.sha256", metaHash))
+		}
+		return err
+	case isTransient(err):
+		// the wallet may have relayed the transaction before the call failed, so the hash stored
+		// when it was built is looked up before it is relayed again. If the wallet can not be
+		// asked the transfer is left relaying for the next reconciliation
+		s.l.Warn("relay failed, checking whether it reached the network", zap.Error(err), zap.String("tx.hash", tx.TxHash))
+		if s.reconcileRelay(*tx) == db.TransferScheduled {
+			return err
+		}
+		return nil
+	default:
+		// the transaction can never be relayed, so release the address for a new one to be created
+		s.l.Error("transaction can not be relayed, unscheduling", zap.Error(err), zap.String("metadata.sha256", metaHash))
+		if err := s.sched.Fail(sourceAddr, metaHash); err != nil {
+			s.l.Error("failed to unschedule transaction", zap.Error(err), zap.String("metadata.sha256", metaHash))
+		}
+		return nil
+	}
+	if err := s.db.SetRelayed(sourceAddr, metaHash, txHash); err != nil {
 		s.l.Error("Failed to set tx hash in database", zap.Error(err))
-		return
+		return nil
 	}
 	s.logRelay(txHash)
+	return nil
 }
 
-func (s *Service) handleCreateTx(addr db.Address) []string {
+func (s *Service) handleCreateTx(addr db.Address) (created []createdTx) {
+	sendAmt := s.sendAmount(addr)
+	if sendAmt == 0 {
+		return nil
+	}
 	churnToAddr, err := s.getChurnToAddress()
 	if err != nil {
 		s.l.Error("failed to get churn to address", zap.Error(err))
 		return nil
 	}
+	defer func() {
+		if created == nil {
+			s.keepSpareAddress(churnToAddr)
+		}
+	}()
+
+	txs, err := s.buildTx(addr, churnToAddr, sendAmt)
+	switch {
+	case err == nil:
+		return txs
+	case errors.Is(err, client.ErrNotEnoughUnlockedMoney):
+		// the address is tried again on the next scan, by which time the funds may have unlocked
+		s.l.Info("waiting for funds to unlock", zap.String("sender.address", addr.Address))
+	case errors.Is(err, errFeeOverCap):
+		// the address is tried again on the next scan, by which time fees may have dropped
+	default:
+		s.handleTxFail(addr, sendAmt, err)
+	}
+	return nil
+}
+
+// buildTx creates unrelayed transactions sending sendAmt from addr to dest at the priority chosen
+// by the priority policy. Transactions over the fee cap are discarded and rebuilt at a lower
+// priority, returning errFeeOverCap once there is no lower priority to try
+func (s *Service) buildTx(addr db.Address, dest string, sendAmt uint64) ([]createdTx, error) {
+	priority, err := s.priority.Priority(s.ctx)
+	if err != nil {
+		s.l.Warn("failed to choose transaction priority, using the wallet default", zap.Error(err))
+		priority = wallet.PriorityDefault
+	}
+	for {
+		txs, err := s.createTx(addr, dest, sendAmt, priority)
+		if err != nil {
+			return nil, err
+		}
+		var overBudget error
+		for _, tx := range txs {
+			if overBudget = s.feeCap.check(tx); overBudget != nil {
+				break
+			}
+		}
+		if overBudget == nil {
+			return txs, nil
+		}
+		// the transactions were never relayed, so dropping their metadata discards them
+		lower, ok := lowerPriority(priority)
+		s.l.Warn(
+			"transaction fee over budget, discarding",
+			zap.Error(overBudget),
+			zap.String("sender.address", addr.Address),
+			zap.Uint64("send.amount", sendAmt),
+			zap.Uint("priority", uint(priority)),
+			zap.Bool("rebuilding", ok),
+		)
+		if !ok {
+			return nil, errFeeOverCap
+		}
+		priority = lower
+	}
+}
 
-	sendAmt := s.getRandomBalance(uint64(addr.Balance))
-	var metaDataHashes []string
-	resp, err := s.mc.Transfer(client.TransferOpts{
-		Priority:       client.RandomPriority(),
-		Destinations:   map[string]uint64{churnToAddr: sendAmt},
+// createTx creates unrelayed transactions sending sendAmt from addr to dest, splitting
+// the transfer into several transactions if it is too large for one
+func (s *Service) createTx(addr db.Address, dest string, sendAmt uint64, priority wallet.Priority) ([]createdTx, error) {
+	if addr.KeyImage != "" {
+		return s.sweepTx(addr, dest, priority)
+	}
+	if s.rechurn(addr) {
+		return s.sweepAllTx(addr, dest, priority)
+	}
+	opts := client.TransferOpts{
+		Priority:       priority,
+		Destinations:   map[string]uint64{dest: sendAmt},
 		AccountIndex:   uint64(addr.AccountIndex),
 		SubaddrIndices: []uint64{uint64(addr.AddressIndex)},
 		WalletName:     s.cfg.WalletName,
 		DoNotRelay:     true,
+		RingSize:       s.ringSize,
+	}
+	var resp *wallet.ResponseTransfer
+	err := s.call("transfer", func(ctx context.Context) error {
+		var err error
+		resp, err = s.mc.Transfer(ctx, opts)
+		return err
 	})
-	if err != nil && strings.Contains(err.Error(), "try /transfer_split") {
-		resp, err := s.mc.TransferSplit(client.TransferOpts{
-			Priority:       client.RandomPriority(),
-			Destinations:   map[string]uint64{churnToAddr: sendAmt},
-			AccountIndex:   uint64(addr.AccountIndex),
-			SubaddrIndices: []uint64{uint64(addr.AddressIndex)},
-			WalletName:     s.cfg.WalletName,
-			DoNotRelay:     true,
-		})
-		if err != nil {
-			s.l.Error("failed to create split transfer", zap.Error(err))
-			return nil
-		}
-		for _, meta := range resp.TxMetadataList {
-			metaDataHashes = append(metaDataHashes, meta)
-		}
-	} else if err != nil {
-		s.handleTxFail(
-			addr.Address,
-			sendAmt,
-			uint64(addr.AccountIndex),
-			uint64(addr.AddressIndex),
-			err,
-		)
-		return nil
-	} else {
-		metaDataHashes = append(metaDataHashes, resp.TxMetadata)
+	if err == nil {
+		return []createdTx{{
+			metadata:    resp.TxMetadata,
+			hash:        resp.TxHash,
+			destination: dest,
+			amount:      resp.Amount,
+			fee:         resp.Fee,
+		}}, nil
+	}
+	if !errors.Is(err, client.ErrTxTooBig) {
+		return nil, err
+	}
+	var split *wallet.ResponseTransferSplit
+	if err := s.call("transfer_split", func(ctx context.Context) error {
+		var err error
+		split, err = s.mc.TransferSplit(ctx, opts)
+		return err
+	}); err != nil {
+		return nil, err
 	}
-	return metaDataHashes
+	txs := make([]createdTx, 0, len(split.TxMetadataList))
+	for i, meta := range split.TxMetadataList {
+		tx := createdTx{metadata: meta, destination: dest}
+		if i < len(split.TxHashList) {
+			tx.hash = split.TxHashList[i]
+		}
+		if i < len(split.AmountList) {
+			tx.amount = split.AmountList[i]
+		}
+		if i < len(split.FeeList) {
+			tx.fee = split.FeeList[i]
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
 }
 
-func (s *Service) handleTxFail(address string, sendAmt, accountIndex, addressIndex uint64, txErr error) {
-	haveBal, err := s.mc.AddressBalance(s.cfg.WalletName, address, accountIndex, addressIndex)
-	if err != nil {
-		return
+// sweepTx creates an unrelayed transaction sending all of the output of addr to dest, less the fee
+func (s *Service) sweepTx(addr db.Address, dest string, priority wallet.Priority) ([]createdTx, error) {
+	opts := client.TransferOpts{
+		Priority:       priority,
+		Destinations:   map[string]uint64{dest: 0},
+		AccountIndex:   uint64(addr.AccountIndex),
+		SubaddrIndices: []uint64{uint64(addr.AddressIndex)},
+		WalletName:     s.cfg.WalletName,
+		DoNotRelay:     true,
+		KeyImage:       addr.KeyImage,
+		RingSize:       s.ringSize,
 	}
-	s.l.Error(
-		"failed to create transfer",
+	var resp *client.ResponseSweepSingle
+	if err := s.call("sweep_single", func(ctx context.Context) error {
+		var err error
+		resp, err = s.mc.SweepSingle(ctx, opts)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if resp.TxMetadata == "" {
+		return nil, errNoTransaction
+	}
+	return []createdTx{{
+		metadata:    resp.TxMetadata,
+		hash:        resp.TxHash,
+		destination: dest,
+		amount:      resp.Amount,
+		fee:         resp.Fee,
+	}}, nil
+}
+
+// sweepAllTx creates unrelayed transactions sending every unlocked output at addr to dest
+func (s *Service) sweepAllTx(addr db.Address, dest string, priority wallet.Priority) ([]createdTx, error) {
+	opts := client.TransferOpts{
+		Priority:       priority,
+		Destinations:   map[string]uint64{dest: 0},
+		AccountIndex:   uint64(addr.AccountIndex),
+		SubaddrIndices: []uint64{uint64(addr.AddressIndex)},
+		WalletName:     s.cfg.WalletName,
+		DoNotRelay:     true,
+		RingSize:       s.ringSize,
+	}
+	var resp *wallet.ResponseSweepAll
+	if err := s.call("sweep_all", func(ctx context.Context) error {
+		var err error
+		resp, err = s.mc.SweepAll(ctx, opts)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	txs := make([]createdTx, 0, len(resp.TxMetadataList))
+	for i, meta := range resp.TxMetadataList {
+		tx := createdTx{metadata: meta, destination: dest}
+		if i < len(resp.TxHashList) {
+			tx.hash = resp.TxHashList[i]
+		}
+		if i < len(resp.AmountList) {
+			tx.amount = resp.AmountList[i]
+		}
+		if i < len(resp.FeeList) {
+			tx.fee = resp.FeeList[i]
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// handleTxFail logs a failure to create a transfer from addr. If retrying can not succeed the address
+// is forgotten until it is found again by a later scan, which also refreshes its balance
+func (s *Service) handleTxFail(addr db.Address, sendAmt uint64, txErr error) {
+	// retrying with the stored balance can not succeed
+	forget := errors.Is(txErr, client.ErrNotEnoughMoney) ||
+		errors.Is(txErr, client.ErrInvalidAddress) ||
+		errors.Is(txErr, client.ErrInvalidIndex) ||
+		errors.Is(txErr, client.ErrInvalidKeyImage) ||
+		errors.Is(txErr, client.ErrTxNotPossible)
+	accountIndex, addressIndex := uint64(addr.AccountIndex), uint64(addr.AddressIndex)
+	fields := []zap.Field{
 		zap.Error(txErr),
-		zap.String("sender.address", address),
+		zap.String("sender.address", addr.Address),
 		zap.Uint64("account.index", accountIndex),
 		zap.Uint64("address.index", addressIndex),
 		zap.Uint64("send.amount", sendAmt),
-		zap.Uint64("address.balance", haveBal),
-	)
+	}
+	// the unlocked balance only helps explain the failure, so the address is handled the same without it
+	var haveBal uint64
+	if err := s.call("get_balance", func(ctx context.Context) error {
+		var err error
+		haveBal, err = s.mc.AddressBalance(ctx, s.cfg.WalletName, addr.Address, accountIndex, addressIndex)
+		return err
+	}); err != nil {
+		s.l.Warn("failed to get address balance", zap.Error(err), zap.String("sender.address", addr.Address))
+	} else {
+		fields = append(fields, zap.Uint64("address.balance", haveBal))
+	}
+	s.l.Error("failed to create transfer", fields...)
+	if forget {
+		if err := s.db.DeleteAddress(addr.Address); err != nil {
+			s.l.Error("failed to remove address from database", zap.Error(err), zap.String("address", addr.Address))
+		}
+	}
 }
@@ -2,18 +2,59 @@ package service
 
 import (
 	"context"
-	"os"
+	"errors"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/bonedaddy/mychurnero/client"
 	"github.com/bonedaddy/mychurnero/config"
+	"github.com/bonedaddy/mychurnero/random"
+	"github.com/bonedaddy/mychurnero/testenv/daemonrpc"
+	"github.com/bonedaddy/mychurnero/testenv/walletrpc"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
 	"github.com/stretchr/testify/require"
 )
 
-func TestService(t *testing.T) {
+// testConfig returns the default config with the database and log kept in a temporary directory
+func testConfig(t *testing.T) *config.Config {
+	cfg := config.DefaultConfig()
+	dir := t.TempDir()
+	cfg.DBPath = filepath.Join(dir, "mychurnero.db")
+	cfg.LogPath = filepath.Join(dir, "mychurnero.log")
+	return cfg
+}
+
+// newFundedWallet returns a fake wallet with an unlocked output of 1 XMR at its primary address
+func newFundedWallet(t *testing.T, cfg *config.Config) *client.FakeWallet {
+	fw := client.NewFakeWallet(cfg.WalletName)
+	require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+	fw.MineBlocks(client.FakeUnlockBlocks)
+	return fw
+}
+
+// newTestService returns a service churning mc, which is closed when the test ends
+func newTestService(t *testing.T, cfg *config.Config, mc client.WalletRPC) *Service {
+	return newTestServiceWithRand(t, cfg, mc, random.NewSecure())
+}
+
+// newTestServiceWithRand is like newTestService, but draws every random choice from src
+func newTestServiceWithRand(t *testing.T, cfg *config.Config, mc client.WalletRPC, src random.Source) *Service {
+	srv, err := NewWithRand(context.Background(), cfg, mc, src)
+	require.NoError(t, err)
 	t.Cleanup(func() {
-		os.RemoveAll("test_path")
+		require.NoError(t, srv.Close())
 	})
-	srv, err := New(context.Background(), config.DefaultConfig())
+	return srv
+}
+
+func TestService(t *testing.T) {
+	rpc := walletrpc.New()
+	t.Cleanup(rpc.Close)
+	cfg := testConfig(t)
+	cfg.RPCAddress = rpc.URL()
+	rpc.AddWallet(cfg.WalletName)
+	srv, err := New(context.Background(), cfg)
 	require.NoError(t, err)
 	srv.MC()
 	srv.DB()
@@ -21,3 +62,415 @@ func TestService(t *testing.T) {
 	err = srv.Close()
 	require.NoError(t, err)
 }
+
+func TestServiceRingSize(t *testing.T) {
+	ctx := context.Background()
+	daemon := daemonrpc.New()
+	t.Cleanup(daemon.Close)
+	cfg := testConfig(t)
+
+	// without a daemon the configured ring size must at least be one consensus has required
+	cfg.RingSize = 12
+	_, err := NewWithWallet(ctx, cfg, client.NewFakeWallet(cfg.WalletName))
+	require.Error(t, err)
+
+	// with a daemon it must be the one its hard fork version requires
+	cfg.DaemonAddress = daemon.URL()
+	cfg.RingSize = 11
+	_, err = NewWithWallet(ctx, cfg, client.NewFakeWallet(cfg.WalletName))
+	require.Error(t, err)
+	daemon.SetHardForkVersion(14)
+	srv, err := NewWithWallet(ctx, cfg, client.NewFakeWallet(cfg.WalletName))
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), srv.ringSize)
+	require.NoError(t, srv.Close())
+
+	cfg.RingSize = 0
+	daemon.SetHardForkVersion(16)
+	srv, err = NewWithWallet(ctx, cfg, client.NewFakeWallet(cfg.WalletName))
+	require.NoError(t, err)
+	require.Equal(t, uint64(16), srv.ringSize)
+	require.NoError(t, srv.Close())
+	require.Equal(t, 3, daemon.Calls("hard_fork_info"))
+
+	// the daemon's tls settings are applied, and an http daemon address refused with them
+	cfg.DaemonCACert = filepath.Join(t.TempDir(), "ca.pem")
+	_, err = NewWithWallet(ctx, cfg, client.NewFakeWallet(cfg.WalletName))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "https")
+}
+
+func TestServiceTxErrors(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MinDelayMinutes = 0
+	cfg.MaxDelayMinutes = 0
+	cfg.RetryMaxAttempts = 1
+
+	fw := &flakyWallet{FakeWallet: client.NewFakeWallet(cfg.WalletName)}
+	srv := newTestService(t, cfg, fw)
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	acct, err := fw.GetAddress(context.Background(), cfg.WalletName, 0, 0)
+	require.NoError(t, err)
+	source := acct.Addresses[0].Address
+
+	// locked funds are waited on, leaving the address to be retried
+	require.NoError(t, fw.Fund(0, 0, wallet.Float64ToXMR(1)))
+	require.NoError(t, srv.DB().AddAddress(cfg.WalletName, source, source, 0, 0, wallet.Float64ToXMR(0.5)))
+	srv.createTransactions()
+	addrs, err := srv.DB().GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+
+	// the address is forgotten when it does not have the funds we thought
+	fw.MineBlocks(client.FakeUnlockBlocks)
+	require.NoError(t, srv.DB().AddAddress(cfg.WalletName, source, source, 0, 0, wallet.Float64ToXMR(3)))
+	cfg.MinChurnAmount = wallet.Float64ToXMR(2)
+	srv.createTransactions()
+	addrs, err = srv.DB().GetAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 0)
+	cfg.MinChurnAmount = wallet.Float64ToXMR(0.1)
+
+	// transactions that can never be relayed are unscheduled
+	srv.handleGetChurnTick()
+	srv.createTransactions()
+	txs, err := srv.DB().GetUnrelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	fw.relayErr = client.NewRPCError(wallet.ErrGenericTransferError, "Reason: double spend")
+	require.NoError(t, srv.relayTx(txs[0].SourceAddress, txs[0].TxMetadataHash))
+	txs, err = srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 0)
+	addrs, err = srv.DB().GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+
+	// the address is forgotten even when its balance can not be looked up
+	fw.setDown(true)
+	srv.handleTxFail(addrs[0], uint64(addrs[0].Balance), client.ErrNotEnoughMoney)
+	addrs, err = srv.DB().GetAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 0)
+}
+
+func TestServiceChurnLifecycle(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MinDelayMinutes = 0
+	cfg.MaxDelayMinutes = 0
+
+	fw := newFundedWallet(t, cfg)
+
+	srv := newTestService(t, cfg, fw)
+	go srv.sched.Run(srv.ctx)
+
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	srv.handleGetChurnTick()
+	addrs, err := srv.DB().GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+
+	srv.createTransactions()
+	addrs, err = srv.DB().GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 0)
+
+	// wait for the scheduler to relay the transaction
+	require.Eventually(t, func() bool {
+		txs, err := srv.DB().GetRelayedTransactions()
+		return err == nil && len(txs) == 1
+	}, time.Second*5, time.Millisecond*10)
+	require.Equal(t, 0, fw.Unrelayed())
+
+	// unconfirmed transactions are kept
+	srv.trackRelayedTransfers()
+	txs, err := srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+
+	fw.MineBlocks(client.FakeConfirmationThreshold + 1)
+	srv.trackRelayedTransfers()
+	txs, err = srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 0)
+	all, err := srv.DB().GetAddresses()
+	require.NoError(t, err)
+	require.Len(t, all, 0)
+
+	accts, err := fw.GetAccounts(context.Background(), cfg.WalletName)
+	require.NoError(t, err)
+	require.Greater(t, accts.SubaddressAccounts[cfg.ChurnAccountIndex].UnlockedBalance, uint64(0))
+}
+
+// feeWallet records the priority and fee of every transfer created
+type feeWallet struct {
+	*client.FakeWallet
+	priorities []wallet.Priority
+	fees       []uint64
+}
+
+func (fw *feeWallet) Transfer(ctx context.Context, opts client.TransferOpts) (*wallet.ResponseTransfer, error) {
+	resp, err := fw.FakeWallet.Transfer(ctx, opts)
+	if err == nil {
+		fw.priorities = append(fw.priorities, opts.Priority)
+		fw.fees = append(fw.fees, resp.Fee)
+	}
+	return resp, err
+}
+
+func TestServiceFeeCap(t *testing.T) {
+	cfg := testConfig(t)
+
+	fw := &feeWallet{FakeWallet: newFundedWallet(t, cfg)}
+	srv := newTestService(t, cfg, fw)
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	srv.handleGetChurnTick()
+
+	// nothing is scheduled when even the cheapest priority is over budget
+	srv.feeCap = feeCap{maxFee: client.FakeBaseFee - 1}
+	srv.createTransactions()
+	require.NotEmpty(t, fw.priorities)
+	require.Equal(t, wallet.PriorityUnimportant, fw.priorities[len(fw.priorities)-1])
+	txs, err := srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 0)
+
+	srv.feeCap = feeCap{maxRatio: 1e-9}
+	srv.createTransactions()
+	txs, err = srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 0)
+
+	// over budget transactions are rebuilt at a lower priority until one fits
+	fw.priorities, fw.fees = nil, nil
+	srv.feeCap = feeCap{maxFee: client.FakeBaseFee}
+	srv.createTransactions()
+	require.LessOrEqual(t, fw.fees[len(fw.fees)-1], client.FakeBaseFee)
+	for i, priority := range fw.priorities[1:] {
+		lower, ok := lowerPriority(fw.priorities[i])
+		require.True(t, ok)
+		require.Equal(t, lower, priority)
+	}
+	txs, err = srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	addrs, err := srv.DB().GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 0)
+}
+
+func TestServiceFeeReserve(t *testing.T) {
+	cfg := testConfig(t)
+	fw := newFundedWallet(t, cfg)
+	srv := newTestService(t, cfg, fw)
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	srv.handleGetChurnTick()
+	addrs, err := srv.DB().GetUnscheduledAddresses()
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	balance := uint64(addrs[0].Balance)
+
+	// the fee of spending the whole balance at the highest priority is kept back
+	reserve, err := srv.feeReserve(addrs[0])
+	require.NoError(t, err)
+	require.Greater(t, reserve, client.FakeBaseFee)
+	require.Equal(t, 0, fw.Unrelayed())
+	cfg.MinChurnAmount = balance - reserve + 1
+	require.Zero(t, srv.sendAmount(addrs[0]))
+	cfg.MinChurnAmount = balance - reserve
+	require.Equal(t, balance-reserve, srv.sendAmount(addrs[0]))
+}
+
+func TestServiceFeeBudget(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	cfg.DailyFeeBudget = client.FakeBaseFee * 3 / 2
+
+	fw := client.NewFakeWallet(cfg.WalletName)
+	srv, err := NewWithWallet(ctx, cfg, fw)
+	require.NoError(t, err)
+	// no single transaction may pay more than the whole budget
+	require.Equal(t, cfg.DailyFeeBudget, srv.feeCap.maxFee)
+
+	// schedule two transfers each paying the base fee, only one of which fits the budget
+	var sources []string
+	for i := 0; i < 2; i++ {
+		acct, err := fw.NewAccount(ctx, cfg.WalletName, "source")
+		require.NoError(t, err)
+		require.NoError(t, fw.Fund(acct.AccountIndex, 0, wallet.Float64ToXMR(1)))
+		sources = append(sources, acct.Address)
+	}
+	fw.MineBlocks(client.FakeUnlockBlocks)
+	for i, source := range sources {
+		resp, err := fw.Transfer(ctx, client.TransferOpts{
+			WalletName:   cfg.WalletName,
+			Destinations: map[string]uint64{source: wallet.Float64ToXMR(0.5)},
+			AccountIndex: uint64(i + 1),
+			Priority:     wallet.PriorityUnimportant,
+			DoNotRelay:   true,
+		})
+		require.NoError(t, err)
+		require.NoError(t, srv.DB().AddAddress(cfg.WalletName, source, source, uint64(i+1), 0, wallet.Float64ToXMR(1)))
+		metaHash := srv.hashMetadata(resp.TxMetadata)
+		require.NoError(t, srv.DB().BuildTransaction(source, "", resp.TxMetadata, metaHash, resp.TxHash, resp.Amount, resp.Fee))
+		require.NoError(t, srv.DB().ScheduleTransaction(source, metaHash, time.Now()))
+	}
+	txs, err := srv.DB().GetSendableTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+
+	start := time.Now()
+	require.NoError(t, srv.relayScheduled(txs[0]))
+	err = srv.relayScheduled(txs[1])
+	var held *deferral
+	require.True(t, errors.As(err, &held), err)
+	// held until the first fee leaves the daily window
+	require.True(t, held.until.After(start.Add(24*time.Hour)))
+	require.True(t, held.until.Before(time.Now().Add(24*time.Hour)))
+	require.NoError(t, srv.Close())
+
+	// the ledger survives restarts
+	srv = newTestService(t, cfg, fw)
+	err = srv.relayScheduled(txs[1])
+	require.True(t, errors.As(err, &held), err)
+	unrelayed, err := srv.DB().GetUnrelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, unrelayed, 1)
+
+	// transfers paying more than the whole budget are released to be rebuilt
+	srv.budget = newFeeBudget(srv.DB(), client.FakeBaseFee-1, 0)
+	require.NoError(t, srv.relayScheduled(txs[1]))
+	unrelayed, err = srv.DB().GetUnrelayedTransactions()
+	require.NoError(t, err)
+	require.Len(t, unrelayed, 0)
+}
+
+func TestServicePriorityPolicy(t *testing.T) {
+	ctx := context.Background()
+	daemon := daemonrpc.New()
+	t.Cleanup(daemon.Close)
+	cfg := testConfig(t)
+
+	for _, policy := range []string{"network", "unknown"} {
+		cfg.PriorityPolicy = policy
+		_, err := NewWithWallet(ctx, cfg, client.NewFakeWallet(cfg.WalletName))
+		require.Error(t, err, policy)
+	}
+	cfg.PriorityPolicy = "fixed"
+	cfg.Priority = 5
+	_, err := NewWithWallet(ctx, cfg, client.NewFakeWallet(cfg.WalletName))
+	require.Error(t, err)
+	cfg.PriorityPolicy = "weighted"
+	cfg.PriorityWeights = []uint{0, 0, 0}
+	_, err = NewWithWallet(ctx, cfg, client.NewFakeWallet(cfg.WalletName))
+	require.Error(t, err)
+	cfg.PriorityWeights = nil
+	src := random.NewSeeded(1)
+	policy, err := NewPriorityPolicy(cfg, nil, src)
+	require.NoError(t, err)
+	require.Equal(t, client.WeightedPriority{Weights: client.DefaultPriorityWeights, Rand: src}, policy)
+
+	// transactions are created with the priority the policy chooses
+	cfg.DaemonAddress = daemon.URL()
+	cfg.PriorityPolicy = "network"
+	cfg.Priority = uint(wallet.PriorityNormal)
+	cfg.MaxFeePerTx = 0
+	daemon.SetFees([]uint64{20, 80, 320, 4000})
+	daemon.AddPoolTx(4000*1500, 1500)
+	fw := &feeWallet{FakeWallet: newFundedWallet(t, cfg)}
+	srv := newTestService(t, cfg, fw)
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+	srv.handleGetChurnTick()
+	srv.createTransactions()
+	require.Equal(t, []wallet.Priority{client.PriorityHighest}, fw.priorities)
+	require.Equal(t, 1, daemon.Calls("get_transaction_pool"))
+}
+
+func TestServiceFailedTransfers(t *testing.T) {
+	daemon := daemonrpc.New()
+	t.Cleanup(daemon.Close)
+	cfg := testConfig(t)
+
+	fw := newFundedWallet(t, cfg)
+	srv := newTestService(t, cfg, fw)
+	srv.createChurnAccount(cfg.ChurnAccountIndex)
+
+	// relay a churn of the funded address, returning its hash
+	relay := func() string {
+		srv.handleGetChurnTick()
+		srv.createTransactions()
+		txs, err := srv.DB().GetUnrelayedTransactions()
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+		require.NoError(t, srv.relayTx(txs[0].SourceAddress, txs[0].TxMetadataHash))
+		relayed, err := srv.DB().GetRelayedTransactions()
+		require.NoError(t, err)
+		require.Len(t, relayed, 1)
+		return relayed[0].TxHash
+	}
+	unscheduled := func() int {
+		addrs, err := srv.DB().GetUnscheduledAddresses()
+		require.NoError(t, err)
+		return len(addrs)
+	}
+
+	// a failed churn releases its source address, which is churned again
+	txHash := relay()
+	require.Equal(t, 0, unscheduled())
+	require.NoError(t, fw.FailTx(txHash))
+	srv.trackRelayedTransfers()
+	require.Equal(t, 1, unscheduled())
+	txs, err := srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 0)
+
+	// without a daemon a transaction unknown to the wallet is waited on
+	txHash = relay()
+	fw.ForgetTx(txHash)
+	srv.trackRelayedTransfers()
+	require.Equal(t, 0, unscheduled())
+
+	txs, err = srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+
+	// with a daemon that does not know it either, it was dropped
+	srv.daemon, err = client.NewDaemon(daemon.URL())
+	require.NoError(t, err)
+	srv.trackRelayedTransfers()
+	require.Equal(t, 1, daemon.Calls("get_transactions"))
+	require.Equal(t, 1, unscheduled())
+	txs, err = srv.DB().GetTransactions()
+	require.NoError(t, err)
+	require.Len(t, txs, 0)
+}
+
+func TestServiceRand(t *testing.T) {
+	ctx := context.Background()
+	// draw returns the amounts, delays and priorities chosen by a service using a seeded source
+	draw := func(seed int64) ([]uint64, []time.Duration, []wallet.Priority) {
+		cfg := testConfig(t)
+		cfg.DelayDistribution = "lognormal"
+		srv := newTestServiceWithRand(t, cfg, client.NewFakeWallet(cfg.WalletName), random.NewSeeded(seed))
+		var (
+			amounts    []uint64
+			delays     []time.Duration
+			priorities []wallet.Priority
+		)
+		for i := 0; i < 10; i++ {
+			amounts = append(amounts, srv.getRandomBalance(wallet.Float64ToXMR(1), client.FakeBaseFee))
+			delays = append(delays, srv.delays.Delay(srv.rand))
+			priority, err := srv.priority.Priority(ctx)
+			require.NoError(t, err)
+			priorities = append(priorities, priority)
+		}
+		return amounts, delays, priorities
+	}
+	amounts, delays, priorities := draw(1)
+	sameAmounts, sameDelays, samePriorities := draw(1)
+	require.Equal(t, amounts, sameAmounts)
+	require.Equal(t, delays, sameDelays)
+	require.Equal(t, priorities, samePriorities)
+	otherAmounts, _, _ := draw(2)
+	require.NotEqual(t, amounts, otherAmounts)
+}
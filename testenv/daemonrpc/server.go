@@ -0,0 +1,360 @@
+// Package daemonrpc provides a local stand-in for the rpc interface of monerod, serving
+// scripted network state so that the daemon client can be tested without a running node
+package daemonrpc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/gorilla/rpc/v2/json2"
+)
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *json2.Error    `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+// Server is an http server emulating monerod
+type Server struct {
+	srv *httptest.Server
+
+	mux     sync.Mutex
+	version uint
+	status  string
+	fees    []uint64
+	pool    []client.PoolTx
+	height  uint64
+	target  uint64
+	txs     map[string]*client.DaemonTx
+	calls   map[string]int
+}
+
+// New starts a new server listening on a random local port. The network starts synchronized at
+// height 1000 and hard fork version 16 with an empty transaction pool
+func New() *Server {
+	s := &Server{
+		version: 16,
+		status:  "OK",
+		fees:    []uint64{20000, 80000, 320000, 4000000},
+		height:  1000,
+		txs:     make(map[string]*client.DaemonTx),
+		calls:   make(map[string]int),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// URL returns the base address of the server, as given to monero-wallet-rpc with --daemon-address
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SetHardForkVersion sets the hard fork version reported by hard_fork_info
+func (s *Server) SetHardForkVersion(version uint) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.version = version
+}
+
+// SetFees sets the fee per byte of each priority returned by get_fee_estimate
+func (s *Server) SetFees(fees []uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.fees = fees
+}
+
+// AddPoolTx adds a transaction of the given weight and fee to the transaction pool, returning its hash
+func (s *Server) AddPoolTx(fee, weight uint64) string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.addPoolTx(randomHex(int(weight)), fee, true)
+}
+
+func (s *Server) addPoolTx(txHex string, fee uint64, relayed bool) string {
+	txHash := TxHash(txHex)
+	weight := uint64(len(txHex) / 2)
+	s.pool = append(s.pool, client.PoolTx{
+		IDHash:     txHash,
+		BlobSize:   weight,
+		Weight:     weight,
+		Fee:        fee,
+		Relayed:    relayed,
+		DoNotRelay: !relayed,
+	})
+	s.txs[txHash] = &client.DaemonTx{TxHash: txHash, AsHex: txHex, InPool: true}
+	return txHash
+}
+
+// ClearPool removes all transactions from the transaction pool
+func (s *Server) ClearPool() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, tx := range s.pool {
+		delete(s.txs, tx.IDHash)
+	}
+	s.pool = nil
+}
+
+// MineBlocks adds n blocks to the chain, the first of which includes every transaction in the pool
+func (s *Server) MineBlocks(n uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if n == 0 {
+		return
+	}
+	for _, tx := range s.pool {
+		mined := s.txs[tx.IDHash]
+		mined.InPool = false
+		mined.BlockHeight = s.height
+		mined.BlockTimestamp = time.Now().Unix()
+	}
+	s.pool = nil
+	s.height += n
+	if s.target != 0 && s.target < s.height {
+		s.target = s.height
+	}
+}
+
+// Height returns the current height of the chain
+func (s *Server) Height() uint64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.height
+}
+
+// SetTargetHeight makes the daemon report it is still syncing up to height, 0 marks it synchronized
+func (s *Server) SetTargetHeight(height uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.target = height
+}
+
+// TxHash returns the hash the server gives the hex encoded transaction. Unlike monerod this
+// is the sha256 of the transaction blob, since the blobs sent to the server are not parsed
+func TxHash(txHex string) string {
+	sum := sha256.Sum256([]byte(txHex))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetStatus sets the status returned with every response, for example BUSY
+// to emulate a daemon that is still syncing
+func (s *Server) SetStatus(status string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.status = status
+}
+
+// Calls returns the number of times method has been called
+func (s *Server) Calls(method string) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.calls[method]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path != "/json_rpc" {
+		s.serveEndpoint(w, r)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp := response{Version: "2.0", ID: req.ID}
+	s.mux.Lock()
+	s.calls[req.Method]++
+	s.mux.Unlock()
+	h, ok := handlers[req.Method]
+	if !ok {
+		resp.Error = &json2.Error{Code: json2.E_NO_METHOD, Message: "Method not found"}
+	} else if result, err := h(s, req.Params); err != nil {
+		resp.Error = &json2.Error{Code: json2.E_SERVER, Message: err.Error()}
+	} else {
+		resp.Result = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&resp)
+}
+
+// serveEndpoint serves the daemon's other endpoints, which take and return plain json
+func (s *Server) serveEndpoint(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	h, ok := endpoints[method]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	params, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mux.Lock()
+	s.calls[method]++
+	s.mux.Unlock()
+	result, err := h(s, params)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+var handlers = map[string]handler{
+	"hard_fork_info": func(s *Server, params json.RawMessage) (interface{}, error) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		return map[string]interface{}{
+			"earliest_height": 0,
+			"enabled":         true,
+			"state":           0,
+			"status":          s.status,
+			"threshold":       0,
+			"version":         s.version,
+			"votes":           10080,
+			"voting":          s.version,
+			"window":          10080,
+		}, nil
+	},
+	"get_fee_estimate": func(s *Server, params json.RawMessage) (interface{}, error) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		var fee uint64
+		if len(s.fees) > 0 {
+			fee = s.fees[0]
+		}
+		return map[string]interface{}{
+			"fee":               fee,
+			"fees":              s.fees,
+			"quantization_mask": 10000,
+			"status":            s.status,
+		}, nil
+	},
+	"get_info": func(s *Server, params json.RawMessage) (interface{}, error) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		target := s.target
+		if target == 0 {
+			target = s.height
+		}
+		return &client.DaemonInfo{
+			Height:                   s.height,
+			TargetHeight:             target,
+			Synchronized:             target <= s.height,
+			Nettype:                  "testnet",
+			TopBlockHash:             TxHash(strconv.FormatUint(s.height, 10)),
+			TxPoolSize:               uint64(len(s.pool)),
+			OutgoingConnectionsCount: 8,
+			Version:                  "0.18.0.0-release",
+			Status:                   s.status,
+		}, nil
+	},
+}
+
+// endpoints are the daemon's other rpc methods, served at /<name>
+var endpoints = map[string]handler{
+	"get_height": func(s *Server, params json.RawMessage) (interface{}, error) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		return map[string]interface{}{
+			"hash":   TxHash(strconv.FormatUint(s.height, 10)),
+			"height": s.height,
+			"status": s.status,
+		}, nil
+	},
+	"get_transactions": func(s *Server, params json.RawMessage) (interface{}, error) {
+		var req struct {
+			TxsHashes []string `json:"txs_hashes"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		txs := []client.DaemonTx{}
+		missed := []string{}
+		for _, txHash := range req.TxsHashes {
+			if tx, ok := s.txs[txHash]; ok {
+				txs = append(txs, *tx)
+			} else {
+				missed = append(missed, txHash)
+			}
+		}
+		return map[string]interface{}{
+			"txs":       txs,
+			"missed_tx": missed,
+			"status":    s.status,
+		}, nil
+	},
+	"send_raw_transaction": func(s *Server, params json.RawMessage) (interface{}, error) {
+		var req struct {
+			TxAsHex    string `json:"tx_as_hex"`
+			DoNotRelay bool   `json:"do_not_relay"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		if _, err := hex.DecodeString(req.TxAsHex); err != nil || req.TxAsHex == "" {
+			return map[string]interface{}{"status": "Failed", "reason": "Failed to parse hex representation of transaction data"}, nil
+		}
+		if tx, ok := s.txs[TxHash(req.TxAsHex)]; ok {
+			if !tx.InPool {
+				return map[string]interface{}{"status": "Failed", "double_spend": true, "reason": "double spend"}, nil
+			}
+			// resubmitting a transaction already in the pool is accepted
+			return map[string]interface{}{"status": s.status}, nil
+		}
+		s.addPoolTx(req.TxAsHex, 0, !req.DoNotRelay)
+		return map[string]interface{}{"status": s.status, "not_relayed": req.DoNotRelay}, nil
+	},
+	"get_transaction_pool": func(s *Server, params json.RawMessage) (interface{}, error) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		return map[string]interface{}{
+			"transactions": s.pool,
+			"status":       s.status,
+		}, nil
+	},
+}
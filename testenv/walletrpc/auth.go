@@ -0,0 +1,72 @@
+package walletrpc
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const realm = "monero-rpc"
+
+// SetLogin requires clients to authenticate using HTTP digest authentication, the
+// same as monero-wallet-rpc started with --rpc-login username:password
+func (s *Server) SetLogin(username, password string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.username = username
+	s.password = password
+}
+
+// authorized checks the digest authorization of the request, sending
+// a challenge if it is missing or invalid
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	s.mux.Lock()
+	username, password, nonce := s.username, s.password, s.nonce
+	s.mux.Unlock()
+	if username == "" {
+		return true
+	}
+	params := parseAuthorization(r.Header.Get("Authorization"))
+	if params != nil && params["username"] == username && params["nonce"] == nonce && params["uri"] == r.URL.RequestURI() {
+		ha1 := md5Hex(username, realm, password)
+		ha2 := md5Hex(r.Method, params["uri"])
+		expected := md5Hex(ha1, nonce, params["nc"], params["cnonce"], params["qop"], ha2)
+		if params["qop"] == "" {
+			expected = md5Hex(ha1, nonce, ha2)
+		}
+		if params["response"] == expected {
+			return true
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Digest qop="auth",algorithm=MD5,realm="`+realm+`",nonce="`+nonce+`",stale=false`)
+	w.WriteHeader(http.StatusUnauthorized)
+	return false
+}
+
+// ExpireNonce changes the nonce used for digest authentication, forcing clients to re-authenticate
+func (s *Server) ExpireNonce() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.nonce = randomHex(16)
+}
+
+func parseAuthorization(header string) map[string]string {
+	if !strings.HasPrefix(header, "Digest ") {
+		return nil
+	}
+	params := make(map[string]string)
+	for _, part := range strings.Split(header[len("Digest "):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+	return params
+}
+
+func md5Hex(parts ...string) string {
+	sum := md5.Sum([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(sum[:])
+}
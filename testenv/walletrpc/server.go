@@ -0,0 +1,614 @@
+// Package walletrpc provides a local stand-in for monero-wallet-rpc. It speaks the
+// JSON-RPC methods used by mychurnero, backing each wallet with a client.FakeWallet so
+// that chain state can be scripted and errors injected without running monerod
+package walletrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/bonedaddy/mychurnero/client"
+	"github.com/gorilla/rpc/v2/json2"
+	"github.com/monero-ecosystem/go-monero-rpc-client/wallet"
+)
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *json2.Error    `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// keyImageRequest is the request to freeze, thaw and frozen
+type keyImageRequest struct {
+	KeyImage string `json:"key_image"`
+}
+
+type injectedError struct {
+	err   *json2.Error
+	count int // number of calls left to fail, <= 0 means forever
+}
+
+type handler func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error)
+
+// Server is an http server emulating monero-wallet-rpc
+type Server struct {
+	srv *httptest.Server
+
+	mux     sync.Mutex
+	wallets map[string]*client.FakeWallet
+	opened  string
+	errors  map[string]*injectedError
+	delays  map[string]time.Duration
+	calls   map[string]int
+	// set to emulate monero-wallet-rpc started with --wallet-file
+	walletFile bool
+
+	username string
+	password string
+	nonce    string
+}
+
+// New starts a new server listening on a random local port
+func New() *Server {
+	s := newServer()
+	s.srv.Start()
+	return s
+}
+
+// NewTLS is like New but serves https using a self-signed certificate
+func NewTLS() *Server {
+	s := newServer()
+	s.srv.StartTLS()
+	return s
+}
+
+func newServer() *Server {
+	s := &Server{
+		wallets: make(map[string]*client.FakeWallet),
+		errors:  make(map[string]*injectedError),
+		delays:  make(map[string]time.Duration),
+		calls:   make(map[string]int),
+		nonce:   randomHex(16),
+	}
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Certificate returns the certificate of a server started with NewTLS
+func (s *Server) Certificate() *x509.Certificate {
+	return s.srv.Certificate()
+}
+
+// URL returns the json_rpc endpoint of the server
+func (s *Server) URL() string {
+	return s.srv.URL + "/json_rpc"
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// AddWallet creates a new wallet that can be opened with open_wallet, returning it
+// so that its chain state can be scripted. An existing wallet of the same name is returned as is
+func (s *Server) AddWallet(walletName string) *client.FakeWallet {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if fw, ok := s.wallets[walletName]; ok {
+		return fw
+	}
+	fw := client.NewFakeWallet(walletName)
+	s.wallets[walletName] = fw
+	return fw
+}
+
+// Wallet returns the named wallet, or nil if it does not exist
+func (s *Server) Wallet(walletName string) *client.FakeWallet {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.wallets[walletName]
+}
+
+// MineBlocks advances the chain of every wallet by count blocks
+func (s *Server) MineBlocks(count uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, fw := range s.wallets {
+		fw.MineBlocks(count)
+	}
+}
+
+// InjectError causes the next count calls to method to fail with the given wallet error.
+// A count of 0 or less fails every call until ClearErrors is called
+func (s *Server) InjectError(method string, code wallet.ErrorCode, message string, count int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.errors[method] = &injectedError{
+		err:   &json2.Error{Code: json2.ErrorCode(code), Message: message},
+		count: count,
+	}
+}
+
+// ClearErrors removes all injected errors
+func (s *Server) ClearErrors() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.errors = make(map[string]*injectedError)
+}
+
+// Delay holds every call to method for the given duration before handling it, emulating
+// a slow or hung wallet. A delay of 0 removes it
+func (s *Server) Delay(method string, delay time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if delay <= 0 {
+		delete(s.delays, method)
+		return
+	}
+	s.delays[method] = delay
+}
+
+// Calls returns the number of times method has been called
+func (s *Server) Calls(method string) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.calls[method]
+}
+
+// Opened returns the name of the currently opened wallet
+func (s *Server) Opened() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.opened
+}
+
+// SetWalletFile emulates monero-wallet-rpc started with --wallet-file, opening the
+// named wallet and rejecting all further open_wallet calls
+func (s *Server) SetWalletFile(walletName string) *client.FakeWallet {
+	fw := s.AddWallet(walletName)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.opened = walletName
+	s.walletFile = true
+	return fw
+}
+
+// CloseWallet closes the open wallet, as happens when monero-wallet-rpc is restarted
+func (s *Server) CloseWallet() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.opened = ""
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp := response{Version: "2.0", ID: req.ID}
+	result, err := s.handle(r.Context(), req.Method, req.Params)
+	if err != nil {
+		if jerr, ok := err.(*json2.Error); ok {
+			resp.Error = jerr
+		} else if rpcErr, ok := client.AsRPCError(err); ok {
+			resp.Error = &json2.Error{Code: json2.ErrorCode(rpcErr.Code), Message: rpcErr.Message}
+		} else {
+			resp.Error = &json2.Error{Code: json2.ErrorCode(wallet.ErrUnknown), Message: err.Error()}
+		}
+	} else {
+		resp.Result = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func (s *Server) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	s.mux.Lock()
+	s.calls[method]++
+	delay := s.delays[method]
+	if inj, ok := s.errors[method]; ok {
+		if inj.count > 0 {
+			inj.count--
+			if inj.count == 0 {
+				delete(s.errors, method)
+			}
+		}
+		s.mux.Unlock()
+		return nil, inj.err
+	}
+	s.mux.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	h, ok := handlers[method]
+	if !ok {
+		return nil, &json2.Error{Code: json2.E_NO_METHOD, Message: "Method not found"}
+	}
+	return h(ctx, s, params)
+}
+
+// current returns the opened wallet and its name
+func (s *Server) current() (*client.FakeWallet, string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	fw, ok := s.wallets[s.opened]
+	if !ok {
+		return nil, "", &json2.Error{Code: json2.ErrorCode(wallet.ErrNotOpen), Message: "No wallet file"}
+	}
+	return fw, s.opened, nil
+}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func decode(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &json2.Error{Code: json2.E_INVALID_REQ, Message: err.Error()}
+	}
+	return nil
+}
+
+func destinations(dests []*wallet.Destination) map[string]uint64 {
+	out := make(map[string]uint64, len(dests))
+	for _, dest := range dests {
+		out[dest.Address] += dest.Amount
+	}
+	return out
+}
+
+var handlers = map[string]handler{
+	"open_wallet": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestOpenWallet
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		if s.walletFile {
+			return nil, &json2.Error{Code: json2.ErrorCode(client.ErrCodeNoWalletDir), Message: "No wallet dir configured"}
+		}
+		if _, ok := s.wallets[req.Filename]; !ok {
+			return nil, &json2.Error{Code: json2.ErrorCode(wallet.ErrUnknown), Message: "Failed to open wallet"}
+		}
+		s.opened = req.Filename
+		return struct{}{}, nil
+	},
+	"create_wallet": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestCreateWallet
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		if s.walletFile {
+			return nil, &json2.Error{Code: json2.ErrorCode(client.ErrCodeNoWalletDir), Message: "No wallet dir configured"}
+		}
+		if _, ok := s.wallets[req.Filename]; ok {
+			return nil, &json2.Error{Code: json2.ErrorCode(client.ErrCodeWalletAlreadyExists), Message: "Cannot create wallet. Already exists."}
+		}
+		s.wallets[req.Filename] = client.NewFakeWallet(req.Filename)
+		s.opened = req.Filename
+		return struct{}{}, nil
+	},
+	"close_wallet": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		if _, _, err := s.current(); err != nil {
+			return nil, err
+		}
+		s.mux.Lock()
+		s.opened = ""
+		s.mux.Unlock()
+		return struct{}{}, nil
+	},
+	"store": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		if _, _, err := s.current(); err != nil {
+			return nil, err
+		}
+		return struct{}{}, nil
+	},
+	"start_mining": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		if _, _, err := s.current(); err != nil {
+			return nil, err
+		}
+		return struct{}{}, nil
+	},
+	"stop_mining": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		if _, _, err := s.current(); err != nil {
+			return nil, err
+		}
+		return struct{}{}, nil
+	},
+	"refresh": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		if _, _, err := s.current(); err != nil {
+			return nil, err
+		}
+		return &wallet.ResponseRefresh{}, nil
+	},
+	"get_height": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		fw, _, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return &wallet.ResponseGetHeight{Height: fw.Height()}, nil
+	},
+	"get_accounts": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.GetAccounts(ctx, name)
+	},
+	"get_address": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestGetAddress
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.GetAddress(ctx, name, req.AccountIndex, req.AddressIndex...)
+	},
+	"get_balance": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestGetBalance
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.Balance(ctx, name, req.AccountIndex, req.AddressIndices...)
+	},
+	"create_address": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestCreateAddress
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		addr, err := fw.NewAddress(ctx, name, req.AccountIndex)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := fw.GetAddress(ctx, name, req.AccountIndex)
+		if err != nil {
+			return nil, err
+		}
+		return &wallet.ResponseCreateAddress{
+			Address:      addr,
+			AddressIndex: uint64(len(resp.Addresses) - 1),
+		}, nil
+	},
+	"create_account": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestCreateAccount
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.NewAccount(ctx, name, req.Label)
+	},
+	"transfer": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestTransfer
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.Transfer(ctx, client.TransferOpts{
+			WalletName:     name,
+			Priority:       req.Priority,
+			Destinations:   destinations(req.Destinations),
+			AccountIndex:   req.AccountIndex,
+			SubaddrIndices: req.SubaddrIndices,
+			DoNotRelay:     req.DoNotRelay,
+			RingSize:       req.RingSize,
+		})
+	},
+	"transfer_split": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestTransferSplit
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.TransferSplit(ctx, client.TransferOpts{
+			WalletName:     name,
+			Priority:       req.Priority,
+			Destinations:   destinations(req.Destinations),
+			AccountIndex:   req.AccountIndex,
+			SubaddrIndices: req.SubaddrIndices,
+			DoNotRelay:     req.DoNotRelay,
+			RingSize:       req.RingSize,
+		})
+	},
+	"relay_tx": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestRelayTx
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := fw.Relay(ctx, name, req.Hex)
+		if err != nil {
+			return nil, err
+		}
+		return &wallet.ResponseRelayTx{TxHash: hash}, nil
+	},
+	"get_transfer_by_txid": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestGetTransferByTxID
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.GetTransferByTxID(ctx, name, req.TxID)
+	},
+	"get_transfers": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestGetTransfers
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := fw.GetTransfers(ctx, name, req.AccountIndex)
+		if err != nil {
+			return nil, err
+		}
+		if req.In {
+			resp.In = fw.Incoming(req.AccountIndex)
+		}
+		return resp, nil
+	},
+	"incoming_transfers": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestIncomingTransfers
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		outputs, err := fw.UnspentOutputs(ctx, name, req.AccountIndex)
+		if err != nil {
+			return nil, err
+		}
+		if !req.Verbose {
+			for i := range outputs {
+				outputs[i].KeyImage = ""
+			}
+		}
+		return &client.IncomingTransfers{Transfers: outputs}, nil
+	},
+	"freeze": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req keyImageRequest
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return struct{}{}, fw.Freeze(ctx, name, req.KeyImage)
+	},
+	"thaw": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req keyImageRequest
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return struct{}{}, fw.Thaw(ctx, name, req.KeyImage)
+	},
+	"frozen": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req keyImageRequest
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		frozen, err := fw.Frozen(ctx, name, req.KeyImage)
+		if err != nil {
+			return nil, err
+		}
+		return &client.ResponseFrozen{Frozen: frozen}, nil
+	},
+	"sweep_all": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestSweepAll
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.SweepAll(ctx, client.TransferOpts{
+			WalletName:     name,
+			Priority:       req.Priority,
+			Destinations:   map[string]uint64{req.Address: 0},
+			AccountIndex:   req.AccountIndex,
+			SubaddrIndices: req.SubaddrIndices,
+			DoNotRelay:     req.DoNotRelay,
+			RingSize:       req.RingSize,
+		})
+	},
+	"sweep_single": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		var req wallet.RequestSweepSingle
+		if err := decode(params, &req); err != nil {
+			return nil, err
+		}
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.SweepSingle(ctx, client.TransferOpts{
+			WalletName:   name,
+			Priority:     req.Priority,
+			Destinations: map[string]uint64{req.Address: 0},
+			AccountIndex: req.AccountIndex,
+			DoNotRelay:   req.DoNotRelay,
+			KeyImage:     req.KeyImage,
+			RingSize:     req.RingSize,
+		})
+	},
+	"sweep_dust": func(ctx context.Context, s *Server, params json.RawMessage) (interface{}, error) {
+		fw, name, err := s.current()
+		if err != nil {
+			return nil, err
+		}
+		return fw.SweepDust(ctx, name)
+	},
+}